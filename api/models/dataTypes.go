@@ -0,0 +1,472 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type PropertyType int64
+
+const (
+	STRING PropertyType = iota
+	LONG
+	DOUBLE
+	BOOLEAN
+	DATE
+)
+
+func (t PropertyType) String() string {
+	switch t {
+	case STRING:
+		return "String"
+	case LONG:
+		return "Long"
+	case DOUBLE:
+		return "Double"
+	case BOOLEAN:
+		return "Boolean"
+	case DATE:
+		return "Date"
+	}
+	return "Unknown"
+}
+
+var StringToPropertyTypeDict = map[string]PropertyType{
+	"string":  STRING,
+	"long":    LONG,
+	"double":  DOUBLE,
+	"boolean": BOOLEAN,
+	"date":    DATE,
+}
+
+// DataType describes the type of the values of a model property.
+// Strings can be restricted to a set of values (Enum) or a regular expression (Format),
+// Long and Double values can have a Unit. Arrays contain values of a single type.
+type DataType struct {
+	Type    PropertyType
+	IsArray bool
+	Enum    []interface{}
+	Format  string
+	Unit    string
+}
+
+// dataTypeJSON is the legacy model-service wire format of a data type that is not a simple type.
+type dataTypeJSON struct {
+	Type   string           `json:"type"`
+	Items  *json.RawMessage `json:"items,omitempty"`
+	Format *string          `json:"format,omitempty"`
+	Unit   *string          `json:"unit,omitempty"`
+	Enum   []interface{}    `json:"enum,omitempty"`
+}
+
+// MarshalJSON encodes the data type in the legacy model-service format.
+// Simple types are encoded as a string, e.g. "String", others as an object, e.g.
+// {"type": "array", "items": {"type": "Double", "unit": "kg"}}.
+func (d DataType) MarshalJSON() ([]byte, error) {
+	item := dataTypeJSON{Type: d.Type.String(), Enum: d.Enum}
+	if d.Format != "" {
+		item.Format = &d.Format
+	}
+	if d.Unit != "" {
+		item.Unit = &d.Unit
+	}
+
+	if !d.IsArray {
+		if item.Format == nil && item.Unit == nil && len(item.Enum) == 0 {
+			return json.Marshal(item.Type)
+		}
+		return json.Marshal(item)
+	}
+
+	items, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	raw := json.RawMessage(items)
+
+	arrayType := "array"
+	if len(d.Enum) > 0 {
+		arrayType = "enum"
+	}
+
+	return json.Marshal(dataTypeJSON{Type: arrayType, Items: &raw})
+}
+
+// UnmarshalJSON decodes a data type in the legacy model-service format.
+func (d *DataType) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		t, found := StringToPropertyTypeDict[strings.ToLower(name)]
+		if !found {
+			return fmt.Errorf("unknown data type: %s", name)
+		}
+		*d = DataType{Type: t}
+		return nil
+	}
+
+	var parsed dataTypeJSON
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return err
+	}
+
+	switch strings.ToLower(parsed.Type) {
+	case "array", "enum":
+		if parsed.Items == nil {
+			return fmt.Errorf("data type %s requires items", parsed.Type)
+		}
+
+		var items DataType
+		if err := json.Unmarshal(*parsed.Items, &items); err != nil {
+			return err
+		}
+		if items.IsArray {
+			return fmt.Errorf("nested arrays are not supported")
+		}
+
+		items.IsArray = true
+		*d = items
+		return nil
+	}
+
+	t, found := StringToPropertyTypeDict[strings.ToLower(parsed.Type)]
+	if !found {
+		return fmt.Errorf("unknown data type: %s", parsed.Type)
+	}
+
+	*d = DataType{Type: t, Enum: parsed.Enum}
+	if parsed.Format != nil {
+		d.Format = *parsed.Format
+	}
+	if parsed.Unit != nil {
+		d.Unit = *parsed.Unit
+	}
+
+	return nil
+}
+
+// Encode returns the representation of the data type that is stored on a ModelProperty node.
+func (d DataType) Encode() string {
+	encoded, _ := json.Marshal(d)
+
+	var name string
+	if err := json.Unmarshal(encoded, &name); err == nil {
+		return name
+	}
+	return string(encoded)
+}
+
+// ParseDataType returns the data type for the representation that is stored on a ModelProperty node.
+func ParseDataType(encoded string) (DataType, error) {
+	var d DataType
+
+	encoded = strings.TrimSpace(encoded)
+	if !strings.HasPrefix(encoded, "{") && !strings.HasPrefix(encoded, "\"") {
+		encoded = fmt.Sprintf("%q", encoded)
+	}
+
+	err := json.Unmarshal([]byte(encoded), &d)
+	return d, err
+}
+
+// Validate checks that the options of the data type are valid for its type.
+func (d DataType) Validate() error {
+	if d.Format != "" {
+		if d.Type != STRING {
+			return fmt.Errorf("format is only supported for String")
+		}
+		if _, err := regexp.Compile(d.Format); err != nil {
+			return fmt.Errorf("invalid format: %v", err)
+		}
+	}
+
+	if d.Unit != "" && d.Type != LONG && d.Type != DOUBLE {
+		return fmt.Errorf("unit is only supported for Long and Double")
+	}
+
+	if len(d.Enum) > 0 {
+		if d.Type != STRING && d.Type != LONG && d.Type != DOUBLE {
+			return fmt.Errorf("enum is only supported for String, Long and Double")
+		}
+
+		item := DataType{Type: d.Type}
+		for _, v := range d.Enum {
+			if _, err := item.Coerce(v); err != nil {
+				return fmt.Errorf("invalid enum value: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Coerce checks that a value is valid for the data type and returns the value as it is stored in the graph.
+// Long values are returned as int64, Double values as float64 and Date values as time.Time.
+func (d DataType) Coerce(value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	if !d.IsArray {
+		return d.coerceScalar(value)
+	}
+
+	values, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected array of %s, got %s", d.Type, jsonTypeName(value))
+	}
+
+	result := make([]interface{}, len(values))
+	for i, v := range values {
+		c, err := d.coerceScalar(v)
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %v", i, err)
+		}
+		result[i] = c
+	}
+
+	return result, nil
+}
+
+func (d DataType) coerceScalar(value interface{}) (interface{}, error) {
+	var result interface{}
+
+	switch d.Type {
+	case STRING:
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected String, got %s", jsonTypeName(value))
+		}
+		if d.Format != "" {
+			r, err := regexp.Compile("^(?:" + d.Format + ")$")
+			if err != nil || !r.MatchString(s) {
+				return nil, fmt.Errorf("value %q does not match format %s", s, d.Format)
+			}
+		}
+		result = s
+	case LONG:
+		switch v := value.(type) {
+		case float64:
+			if v != math.Trunc(v) {
+				return nil, fmt.Errorf("expected Long, got decimal number %v", v)
+			}
+			result = int64(v)
+		case int:
+			result = int64(v)
+		case int64:
+			result = v
+		default:
+			return nil, fmt.Errorf("expected Long, got %s", jsonTypeName(value))
+		}
+	case DOUBLE:
+		switch v := value.(type) {
+		case float64:
+			result = v
+		case int:
+			result = float64(v)
+		case int64:
+			result = float64(v)
+		default:
+			return nil, fmt.Errorf("expected Double, got %s", jsonTypeName(value))
+		}
+	case BOOLEAN:
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("expected Boolean, got %s", jsonTypeName(value))
+		}
+		result = b
+	case DATE:
+		switch v := value.(type) {
+		case time.Time:
+			result = v
+		case string:
+			t, err := ParseDate(v)
+			if err != nil {
+				return nil, err
+			}
+			result = t
+		default:
+			return nil, fmt.Errorf("expected Date, got %s", jsonTypeName(value))
+		}
+	default:
+		return nil, fmt.Errorf("unsupported data type: %s", d.Type)
+	}
+
+	if len(d.Enum) > 0 {
+		item := DataType{Type: d.Type}
+		for _, e := range d.Enum {
+			if c, err := item.coerceScalar(e); err == nil && c == result {
+				return result, nil
+			}
+		}
+		return nil, fmt.Errorf("value %v is not one of %v", value, d.Enum)
+	}
+
+	return result, nil
+}
+
+// ArrayDelimiter separates the items of an array value in a delimited text file.
+const ArrayDelimiter = ";"
+
+// ParseString converts a value from a delimited text file to the data type and returns the value as it is stored
+// in the graph. Empty values are returned as nil, and the items of array values are separated by ArrayDelimiter.
+func (d DataType) ParseString(value string) (interface{}, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+
+	if !d.IsArray {
+		return d.parseScalarString(value)
+	}
+
+	var result []interface{}
+	for i, item := range strings.Split(value, ArrayDelimiter) {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		c, err := d.parseScalarString(item)
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %v", i, err)
+		}
+		result = append(result, c)
+	}
+
+	return result, nil
+}
+
+func (d DataType) parseScalarString(value string) (interface{}, error) {
+	var parsed interface{} = value
+
+	switch d.Type {
+	case LONG:
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			parsed = i
+		} else if f, err := strconv.ParseFloat(value, 64); err == nil {
+			parsed = f
+		}
+	case DOUBLE:
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			parsed = f
+		}
+	case BOOLEAN:
+		switch strings.ToLower(value) {
+		case "true", "t", "yes", "y", "1":
+			parsed = true
+		case "false", "f", "no", "n", "0":
+			parsed = false
+		}
+	}
+
+	c, err := d.coerceScalar(parsed)
+	if err != nil {
+		if s, isString := parsed.(string); isString && d.Type != STRING && d.Type != DATE {
+			return nil, fmt.Errorf("expected %s, got %q", d.Type, s)
+		}
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// InferDataType returns the most specific simple data type that can represent all provided values from a
+// delimited text file. Empty values are ignored, and String is returned when no other type fits.
+func InferDataType(values []string) DataType {
+	for _, t := range []PropertyType{LONG, DOUBLE, BOOLEAN, DATE} {
+		d := DataType{Type: t}
+
+		fits, hasValue := true, false
+		for _, v := range values {
+			v = strings.TrimSpace(v)
+			if v == "" {
+				continue
+			}
+			hasValue = true
+			if _, err := d.parseScalarString(v); err != nil {
+				fits = false
+				break
+			}
+		}
+
+		if fits && hasValue {
+			return d
+		}
+	}
+
+	return DataType{Type: STRING}
+}
+
+// ParseDate parses an ISO-8601 date or date-time.
+func ParseDate(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("expected Date, got %q", value)
+}
+
+// jsonTypeName returns the JSON type of a decoded JSON value for use in error messages.
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case float64, int, int64:
+		return "number"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// ValidateRecordProps checks the values of a record against the properties of its model, and that the
+// model title property has a value. It returns the values as they should be stored, or a RecordValidationError with an entry per invalid property.
+func ValidateRecordProps(values map[string]interface{}, modelProps []ModelProperty) (map[string]interface{}, error) {
+	propMap := make(map[string]ModelProperty)
+	for _, p := range modelProps {
+		propMap[p.Name] = p
+	}
+
+	result := make(map[string]interface{})
+	var details []ValidationErrorDetail
+	for _, p := range modelProps {
+		if p.IsModelTitle && values[p.Name] == nil {
+			details = append(details, ValidationErrorDetail{Property: p.Name, Message: "model title is required"})
+		}
+	}
+
+	for name, value := range values {
+		p, found := propMap[name]
+		if !found {
+			details = append(details, ValidationErrorDetail{Property: name, Message: "unknown property"})
+			continue
+		}
+
+		c, err := p.DataType.Coerce(value)
+		if err != nil {
+			details = append(details, ValidationErrorDetail{Property: name, Message: err.Error()})
+			continue
+		}
+		if c != nil {
+			result[name] = c
+		}
+	}
+
+	if len(details) > 0 {
+		sort.Slice(details, func(i, j int) bool { return details[i].Property < details[j].Property })
+		return nil, &RecordValidationError{Details: details}
+	}
+
+	return result, nil
+}
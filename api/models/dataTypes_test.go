@@ -0,0 +1,114 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestDataTypes(t *testing.T) {
+	for scenario, fn := range map[string]func(
+		tt *testing.T,
+	){
+		"encode and decode legacy wire format": testDataTypeCodec,
+		"coerce values to data type":           testDataTypeCoerce,
+		"validate record properties":           testValidateRecordProps,
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			fn(t)
+		})
+	}
+}
+
+func testDataTypeCodec(t *testing.T) {
+	tests := map[string]DataType{
+		`"String"`:                                 {Type: STRING},
+		`"Date"`:                                   {Type: DATE},
+		`{"type":"String","format":"[A-Z]+"}`:      {Type: STRING, Format: "[A-Z]+"},
+		`{"type":"Double","unit":"kg"}`:            {Type: DOUBLE, Unit: "kg"},
+		`{"type":"array","items":{"type":"Long"}}`: {Type: LONG, IsArray: true},
+		`{"type":"enum","items":{"type":"String","enum":["a","b"]}}`:      {Type: STRING, IsArray: true, Enum: []interface{}{"a", "b"}},
+		`{"type":"String","enum":["left","right"]}`:                       {Type: STRING, Enum: []interface{}{"left", "right"}},
+		`{"type":"array","items":{"type":"Double","unit":"m"}}`:           {Type: DOUBLE, IsArray: true, Unit: "m"},
+		`{"type":"array","items":{"type":"Boolean"}}`:                     {Type: BOOLEAN, IsArray: true},
+		`{"type":"enum","items":{"type":"Long","enum":[1,2],"unit":"s"}}`: {Type: LONG, IsArray: true, Enum: []interface{}{1.0, 2.0}, Unit: "s"},
+	}
+
+	for encoded, expected := range tests {
+		var d DataType
+		err := json.Unmarshal([]byte(encoded), &d)
+		assert.NoError(t, err, encoded)
+		assert.Equal(t, expected, d, encoded)
+
+		roundTrip, err := json.Marshal(d)
+		assert.NoError(t, err)
+		assert.JSONEq(t, encoded, string(roundTrip))
+
+		parsed, err := ParseDataType(d.Encode())
+		assert.NoError(t, err)
+		assert.Equal(t, expected, parsed)
+	}
+
+	assert.Equal(t, "Long", DataType{Type: LONG}.Encode())
+
+	var d DataType
+	assert.Error(t, json.Unmarshal([]byte(`"Integer"`), &d))
+	assert.Error(t, json.Unmarshal([]byte(`{"type":"array"}`), &d))
+}
+
+func testDataTypeCoerce(t *testing.T) {
+	v, err := DataType{Type: LONG}.Coerce(30.0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(30), v)
+
+	_, err = DataType{Type: LONG}.Coerce(30.5)
+	assert.Error(t, err)
+
+	_, err = DataType{Type: LONG}.Coerce("30")
+	assert.EqualError(t, err, "expected Long, got string")
+
+	v, err = DataType{Type: DATE}.Coerce("2022-01-31")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2022, 1, 31, 0, 0, 0, 0, time.UTC), v)
+
+	_, err = DataType{Type: STRING, Format: "[A-Z]+"}.Coerce("abc")
+	assert.Error(t, err)
+
+	_, err = DataType{Type: STRING, Enum: []interface{}{"left", "right"}}.Coerce("up")
+	assert.Error(t, err)
+
+	v, err = DataType{Type: DOUBLE, IsArray: true}.Coerce([]interface{}{1.0, 2.5})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{1.0, 2.5}, v)
+
+	_, err = DataType{Type: BOOLEAN, IsArray: true}.Coerce([]interface{}{true, "false"})
+	assert.EqualError(t, err, "item 1: expected Boolean, got string")
+
+	assert.Error(t, DataType{Type: BOOLEAN, Unit: "kg"}.Validate())
+	assert.Error(t, DataType{Type: STRING, Format: "("}.Validate())
+	assert.NoError(t, DataType{Type: LONG, Enum: []interface{}{1.0, 2.0}}.Validate())
+}
+
+func testValidateRecordProps(t *testing.T) {
+	modelProps := []ModelProperty{
+		{Name: "name", DataType: DataType{Type: STRING}, IsModelTitle: true},
+		{Name: "age", DataType: DataType{Type: LONG}},
+	}
+
+	values, err := ValidateRecordProps(map[string]interface{}{"name": "Joe", "age": 42.0}, modelProps)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "Joe", "age": int64(42)}, values)
+
+	_, err = ValidateRecordProps(map[string]interface{}{"name": 1.0, "age": "old", "height": 2.0}, modelProps)
+	assert.Equal(t, &RecordValidationError{Details: []ValidationErrorDetail{
+		{Property: "age", Message: "expected Long, got string"},
+		{Property: "height", Message: "unknown property"},
+		{Property: "name", Message: "expected String, got number"},
+	}}, err)
+
+	_, err = ValidateRecordProps(map[string]interface{}{"age": 42.0}, modelProps)
+	assert.Equal(t, &RecordValidationError{Details: []ValidationErrorDetail{
+		{Property: "name", Message: "model title is required"},
+	}}, err)
+}
@@ -1,6 +1,9 @@
 package models
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 type UnknownModelError struct {
 	Model string
@@ -18,6 +21,14 @@ func (e *UnsupportedOperatorError) Error() string {
 	return "Unsupported Operator: " + e.Operator
 }
 
+type UnknownRecordError struct {
+	ID string
+}
+
+func (e *UnknownRecordError) Error() string {
+	return "Unknown record: " + e.ID
+}
+
 type UnknownModelPropertyError struct {
 	PropName string
 }
@@ -48,6 +59,14 @@ func (e *ValidationError) Error() string {
 	return "Name must start with [a-zA-Z] or '_'' and only contain [a-zA-Z0-9_] " + e.Name
 }
 
+type ReservedNameError struct {
+	Name string
+}
+
+func (e *ReservedNameError) Error() string {
+	return fmt.Sprintf("%s is a reserved name.", e.Name)
+}
+
 type ModelNameCountError struct {
 	Name string
 }
@@ -55,3 +74,216 @@ type ModelNameCountError struct {
 func (e *ModelNameCountError) Error() string {
 	return fmt.Sprintf("A model with name %s already exists.", e.Name)
 }
+
+type ModelHasRecordsError struct {
+	Name  string
+	Count int64
+}
+
+func (e *ModelHasRecordsError) Error() string {
+	return fmt.Sprintf("Model %s has %d records. Delete the records first or set cascade.", e.Name, e.Count)
+}
+
+type ModelTitleError struct {
+	Count int
+}
+
+func (e *ModelTitleError) Error() string {
+	return fmt.Sprintf("A model must have exactly one model-title property, found %d", e.Count)
+}
+
+type InvalidPropertyError struct {
+	PropName string
+	Reason   string
+}
+
+func (e *InvalidPropertyError) Error() string {
+	return fmt.Sprintf("Invalid property %s: %s", e.PropName, e.Reason)
+}
+
+type PropertyInUseError struct {
+	PropName string
+	Count    int64
+}
+
+func (e *PropertyInUseError) Error() string {
+	return fmt.Sprintf("Property %s is used by %d records. Set migrate to update existing records.", e.PropName, e.Count)
+}
+
+// PropertyConversionError is returned when a property changes data type and the values of records cannot be
+// converted to the new data type. The values are kept, and the data type is not changed.
+type PropertyConversionError struct {
+	PropName string
+	DataType PropertyType
+	Count    int64
+}
+
+func (e *PropertyConversionError) Error() string {
+	return fmt.Sprintf("Property %s has %d values that cannot be converted to %s.", e.PropName, e.Count, e.DataType)
+}
+
+type ValidationErrorDetail struct {
+	Property string `json:"property"`
+	Message  string `json:"message"`
+}
+
+type RecordValidationError struct {
+	Details []ValidationErrorDetail
+}
+
+func (e *RecordValidationError) Error() string {
+	var messages []string
+	for _, d := range e.Details {
+		messages = append(messages, fmt.Sprintf("%s: %s", d.Property, d.Message))
+	}
+	return "Invalid record: " + strings.Join(messages, ", ")
+}
+
+type ImportError struct {
+	Reason string
+}
+
+func (e *ImportError) Error() string {
+	return "Invalid import: " + e.Reason
+}
+
+type InvalidFilterError struct {
+	Reason string
+}
+
+func (e *InvalidFilterError) Error() string {
+	return "Invalid filter: " + e.Reason
+}
+
+type InvalidAggregateError struct {
+	Reason string
+}
+
+func (e *InvalidAggregateError) Error() string {
+	return "Invalid aggregate: " + e.Reason
+}
+
+type InvalidOrderByError struct {
+	Reason string
+}
+
+func (e *InvalidOrderByError) Error() string {
+	return "Invalid order: " + e.Reason
+}
+
+type InvalidCursorError struct{}
+
+func (e *InvalidCursorError) Error() string {
+	return "Invalid cursor"
+}
+
+type UnknownSavedQueryError struct {
+	ID string
+}
+
+func (e *UnknownSavedQueryError) Error() string {
+	return "Unknown saved query: " + e.ID
+}
+
+type SavedQueryCreatorError struct {
+	ID string
+}
+
+func (e *SavedQueryCreatorError) Error() string {
+	return fmt.Sprintf("Saved query %s can only be changed by its creator or a dataset manager.", e.ID)
+}
+
+type SavedQueryNameCountError struct {
+	Name string
+}
+
+func (e *SavedQueryNameCountError) Error() string {
+	return fmt.Sprintf("A saved query with name %s already exists.", e.Name)
+}
+
+type UnknownModelRelationshipError struct {
+	ID string
+}
+
+func (e *UnknownModelRelationshipError) Error() string {
+	return "Unknown model relationship: " + e.ID
+}
+
+type ModelRelationshipExistsError struct {
+	Name string
+}
+
+func (e *ModelRelationshipExistsError) Error() string {
+	return fmt.Sprintf("A relationship with name %s already exists between the models.", e.Name)
+}
+
+type ModelRelationshipInUseError struct {
+	Type  string
+	Count int64
+}
+
+func (e *ModelRelationshipInUseError) Error() string {
+	return fmt.Sprintf("Relationship %s is used by %d record relationships. Delete the record relationships first.",
+		e.Type, e.Count)
+}
+
+type InvalidRecordRelationshipsError struct {
+	Reason string
+}
+
+func (e *InvalidRecordRelationshipsError) Error() string {
+	return "Invalid record relationships: " + e.Reason
+}
+
+type InvalidCardinalityError struct {
+	Cardinality string
+}
+
+func (e *InvalidCardinalityError) Error() string {
+	return "Unsupported cardinality: " + e.Cardinality
+}
+
+type CardinalityError struct {
+	Relationship string
+	Cardinality  string
+	Violations   []CardinalityViolation
+}
+
+func (e *CardinalityError) Error() string {
+	return fmt.Sprintf("%d record pairs violate the %s cardinality of relationship %s", len(e.Violations),
+		e.Cardinality, e.Relationship)
+}
+
+type TooManyRecordRelationshipsError struct {
+	Count int
+	Max   int
+}
+
+func (e *TooManyRecordRelationshipsError) Error() string {
+	return fmt.Sprintf("Request relates %d pairs of records, which is more than the maximum of %d", e.Count, e.Max)
+}
+
+type UnknownPackageError struct {
+	NodeID string
+}
+
+func (e *UnknownPackageError) Error() string {
+	return "Unknown package: " + e.NodeID
+}
+
+type PackageNotInDatasetError struct {
+	NodeID string
+}
+
+func (e *PackageNotInDatasetError) Error() string {
+	return fmt.Sprintf("Package %s does not belong to the dataset", e.NodeID)
+}
+
+type UnknownRecordPackageError struct {
+	RecordID      string
+	PackageNodeID string
+}
+
+func (e *UnknownRecordPackageError) Error() string {
+	return fmt.Sprintf("Record %s is not attached to package %s", e.RecordID, e.PackageNodeID)
+}
@@ -1,10 +1,10 @@
 package models
 
-import "fmt"
+import "strings"
 
+// Operator is an operator of a filter on a property. Operators are named, e.g. "GREATER_THAN"; the Cypher
+// symbols of the legacy API, e.g. ">", are accepted for backward compatibility, see ParseOperator.
 type Operator int64
-type GraphValue interface {
-}
 
 const (
 	IS Operator = iota
@@ -17,6 +17,17 @@ const (
 	GREATER_THAN_EQUALS
 	STARTS_WITH
 	CONTAINS
+	ENDS_WITH
+	MATCHES
+	IN
+	NOT_IN
+	IS_NULL
+	IS_NOT_NULL
+	BETWEEN
+	EQUALS_IGNORE_CASE
+	STARTS_WITH_IGNORE_CASE
+	ENDS_WITH_IGNORE_CASE
+	CONTAINS_IGNORE_CASE
 )
 
 func (o Operator) String() string {
@@ -41,37 +52,136 @@ func (o Operator) String() string {
 		return "STARTS_WITH"
 	case CONTAINS:
 		return "CONTAINS"
+	case ENDS_WITH:
+		return "ENDS_WITH"
+	case MATCHES:
+		return "MATCHES"
+	case IN:
+		return "IN"
+	case NOT_IN:
+		return "NOT_IN"
+	case IS_NULL:
+		return "IS_NULL"
+	case IS_NOT_NULL:
+		return "IS_NOT_NULL"
+	case BETWEEN:
+		return "BETWEEN"
+	case EQUALS_IGNORE_CASE:
+		return "EQUALS_IGNORE_CASE"
+	case STARTS_WITH_IGNORE_CASE:
+		return "STARTS_WITH_IGNORE_CASE"
+	case ENDS_WITH_IGNORE_CASE:
+		return "ENDS_WITH_IGNORE_CASE"
+	case CONTAINS_IGNORE_CASE:
+		return "CONTAINS_IGNORE_CASE"
 	}
 	return "UKNOWN"
 }
 
-var StringToOperatorDict = map[string]Operator{
-	"IS":                  IS,
-	"IS_NOT":              IS_NOT,
-	"EQUALS":              EQUALS,
-	"NOT_EQUALS":          NOT_EQUALS,
-	"LESS_THAN":           LESS_THAN,
-	"LESS_THAN_EQUALS":    LESS_THAN_EQUALS,
-	"GREATER_THAN":        GREATER_THAN,
-	"GREATER_THAN_EQUALS": GREATER_THAN_EQUALS,
-	"STARTS_WITH":         STARTS_WITH,
-	"CONTAINS":            CONTAINS,
+// Cypher returns the Cypher operator that compares a property with the value of a filter. NOT_IN returns the
+// operator of IN, and is negated by the query engine. BETWEEN has no single Cypher operator.
+func (o Operator) Cypher() string {
+	switch o {
+	case IS, EQUALS, EQUALS_IGNORE_CASE:
+		return "="
+	case IS_NOT, NOT_EQUALS:
+		return "<>"
+	case LESS_THAN:
+		return "<"
+	case LESS_THAN_EQUALS:
+		return "<="
+	case GREATER_THAN:
+		return ">"
+	case GREATER_THAN_EQUALS:
+		return ">="
+	case STARTS_WITH, STARTS_WITH_IGNORE_CASE:
+		return "STARTS WITH"
+	case ENDS_WITH, ENDS_WITH_IGNORE_CASE:
+		return "ENDS WITH"
+	case CONTAINS, CONTAINS_IGNORE_CASE:
+		return "CONTAINS"
+	case MATCHES:
+		return "=~"
+	case IN, NOT_IN:
+		return "IN"
+	case IS_NULL:
+		return "IS NULL"
+	case IS_NOT_NULL:
+		return "IS NOT NULL"
+	}
+	return ""
+}
+
+// IsStringOperator reports whether the operator only applies to String properties.
+func (o Operator) IsStringOperator() bool {
+	switch o {
+	case STARTS_WITH, ENDS_WITH, CONTAINS, MATCHES:
+		return true
+	}
+	return o.IgnoresCase()
 }
 
-type Predicate struct {
-	field    string
-	op       Operator
-	argument GraphValue
+// IgnoresCase reports whether the operator compares strings case-insensitively.
+func (o Operator) IgnoresCase() bool {
+	switch o {
+	case EQUALS_IGNORE_CASE, STARTS_WITH_IGNORE_CASE, ENDS_WITH_IGNORE_CASE, CONTAINS_IGNORE_CASE:
+		return true
+	}
+	return false
 }
 
-func (p Predicate) cql(i int, modelName string) string {
-	return fmt.Sprintf(" %s[%s] %s %s", modelName, p.predicateField(i), p.op.String(), p.predicateValue(i))
+// TakesList reports whether the value of a filter with the operator is a list of values.
+func (o Operator) TakesList() bool {
+	return o == IN || o == NOT_IN || o == BETWEEN
 }
 
-func (p Predicate) predicateField(i int) string {
-	return fmt.Sprintf("predicate_%d_field", i)
+// TakesValue reports whether a filter with the operator has a value.
+func (o Operator) TakesValue() bool {
+	return o != IS_NULL && o != IS_NOT_NULL
 }
 
-func (p Predicate) predicateValue(i int) string {
-	return fmt.Sprintf("predicate_%d_value", i)
+var StringToOperatorDict = map[string]Operator{
+	"IS":                      IS,
+	"IS_NOT":                  IS_NOT,
+	"EQUALS":                  EQUALS,
+	"NOT_EQUALS":              NOT_EQUALS,
+	"LESS_THAN":               LESS_THAN,
+	"LESS_THAN_EQUALS":        LESS_THAN_EQUALS,
+	"GREATER_THAN":            GREATER_THAN,
+	"GREATER_THAN_EQUALS":     GREATER_THAN_EQUALS,
+	"STARTS_WITH":             STARTS_WITH,
+	"CONTAINS":                CONTAINS,
+	"ENDS_WITH":               ENDS_WITH,
+	"MATCHES":                 MATCHES,
+	"IN":                      IN,
+	"NOT_IN":                  NOT_IN,
+	"IS_NULL":                 IS_NULL,
+	"IS_NOT_NULL":             IS_NOT_NULL,
+	"BETWEEN":                 BETWEEN,
+	"EQUALS_IGNORE_CASE":      EQUALS_IGNORE_CASE,
+	"STARTS_WITH_IGNORE_CASE": STARTS_WITH_IGNORE_CASE,
+	"ENDS_WITH_IGNORE_CASE":   ENDS_WITH_IGNORE_CASE,
+	"CONTAINS_IGNORE_CASE":    CONTAINS_IGNORE_CASE,
+}
+
+// legacyOperatorDict maps the Cypher symbols that the legacy API accepted as operators onto named operators.
+var legacyOperatorDict = map[string]Operator{
+	"=":  EQUALS,
+	"<>": NOT_EQUALS,
+	"<":  LESS_THAN,
+	"<=": LESS_THAN_EQUALS,
+	">":  GREATER_THAN,
+	">=": GREATER_THAN_EQUALS,
+	"=~": MATCHES,
+}
+
+// ParseOperator returns the operator for a named operator, e.g. "greater_than", or for a legacy Cypher symbol,
+// e.g. ">" or "STARTS WITH".
+func ParseOperator(op string) (Operator, bool) {
+	if o, found := legacyOperatorDict[op]; found {
+		return o, true
+	}
+
+	o, found := StringToOperatorDict[strings.ReplaceAll(strings.ToUpper(op), " ", "_")]
+	return o, found
 }
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestOperators(t *testing.T) {
+	for scenario, fn := range map[string]func(
+		tt *testing.T,
+	){
+		"parse named and legacy operators": testParseOperator,
+		"translate operators to Cypher":    testOperatorCypher,
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			fn(t)
+		})
+	}
+}
+
+func testParseOperator(t *testing.T) {
+	for op, expected := range map[string]Operator{
+		"GREATER_THAN":         GREATER_THAN,
+		"not_in":               NOT_IN,
+		"contains_ignore_case": CONTAINS_IGNORE_CASE,
+		">=":                   GREATER_THAN_EQUALS,
+		"<>":                   NOT_EQUALS,
+		"=~":                   MATCHES,
+		"STARTS WITH":          STARTS_WITH,
+		"ENDS WITH":            ENDS_WITH,
+	} {
+		o, found := ParseOperator(op)
+		assert.True(t, found, op)
+		assert.Equal(t, expected, o, op)
+	}
+
+	for _, op := range []string{"", "==", "STARTS_WITH OR 1 =", "LIKE"} {
+		_, found := ParseOperator(op)
+		assert.False(t, found, op)
+	}
+
+	for name, o := range StringToOperatorDict {
+		assert.Equal(t, name, o.String())
+	}
+}
+
+func testOperatorCypher(t *testing.T) {
+	assert.Equal(t, "=", IS.Cypher())
+	assert.Equal(t, "<>", IS_NOT.Cypher())
+	assert.Equal(t, "STARTS WITH", STARTS_WITH_IGNORE_CASE.Cypher())
+	assert.Equal(t, "IN", NOT_IN.Cypher())
+
+	assert.True(t, CONTAINS.IsStringOperator())
+	assert.True(t, EQUALS_IGNORE_CASE.IsStringOperator())
+	assert.False(t, EQUALS.IsStringOperator())
+	assert.True(t, BETWEEN.TakesList())
+	assert.False(t, IS_NULL.TakesValue())
+}
@@ -0,0 +1,159 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ImportOptions controls how the rows of a delimited text file are imported as records of a model.
+// Mapping maps column headers to property names; an empty property name skips the column. Columns that are not
+// in the mapping are matched to properties by name or display name, and columns with a header starting with "@",
+// such as the record ids of an export, are skipped.
+type ImportOptions struct {
+	Mapping          map[string]string `json:"mapping"`
+	CreateProperties bool              `json:"create_properties"`
+	DryRun           bool              `json:"dry_run"`
+	Upsert           bool              `json:"upsert"`
+}
+
+// ImportSource references an object in S3 that contains the file to import. The key of the object starts with the
+// ids of the organization and the dataset, as in "<organizationId>/<datasetId>/file.csv".
+type ImportSource struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+}
+
+// ImportRecordsRequestBody contains a CSV or TSV file to import, either inline in Content or as a reference to
+// an object in S3.
+type ImportRecordsRequestBody struct {
+	ImportOptions
+	Format  string        `json:"format"`
+	Content string        `json:"content"`
+	Source  *ImportSource `json:"source"`
+}
+
+// ImportRecordsResponse contains the result per row of an import. In a dry run nothing is written; the
+// results report which rows would be created or updated, and the properties that would be created.
+type ImportRecordsResponse struct {
+	BatchRecordResponse
+	DryRun            bool            `json:"dry_run"`
+	CreatedProperties []ModelProperty `json:"created_properties"`
+	IgnoredColumns    []string        `json:"ignored_columns"`
+}
+
+// ImportColumn describes how a column of an imported file maps onto a model property.
+// Property is empty for columns that are skipped, and Exists is false for properties that the model does not have.
+type ImportColumn struct {
+	Header   string
+	Property string
+	Exists   bool
+	Mapped   bool
+}
+
+var invalidPropertyNameChars = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+// PropertyNameFromHeader returns a valid property name for a column header, e.g. "Body Weight (kg)" becomes
+// "Body_Weight_kg".
+func PropertyNameFromHeader(header string) string {
+	name := strings.Trim(invalidPropertyNameChars.ReplaceAllString(strings.TrimSpace(header), "_"), "_")
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+// MapImportColumns maps the columns of an imported file onto the properties of a model.
+func MapImportColumns(header []string, props []ModelProperty, mapping map[string]string) ([]ImportColumn, error) {
+	propMap := make(map[string]ModelProperty)
+	for _, p := range props {
+		propMap[p.Name] = p
+	}
+
+	headers := make(map[string]bool)
+	for _, h := range header {
+		headers[h] = true
+	}
+
+	var unknown []string
+	for h := range mapping {
+		if !headers[h] {
+			unknown = append(unknown, h)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, &ImportError{Reason: "mapping contains unknown columns: " + strings.Join(unknown, ", ")}
+	}
+
+	columns := make([]ImportColumn, len(header))
+	used := make(map[string]string)
+	for i, h := range header {
+		column := ImportColumn{Header: h}
+
+		if target, mapped := mapping[h]; mapped {
+			column.Mapped = true
+			column.Property = target
+		} else if strings.HasPrefix(strings.TrimSpace(h), "@") {
+			column.Property = ""
+		} else if _, exists := propMap[h]; exists {
+			column.Property = h
+		} else {
+			for _, p := range props {
+				if strings.EqualFold(p.Name, strings.TrimSpace(h)) || strings.EqualFold(p.DisplayName, strings.TrimSpace(h)) {
+					column.Property = p.Name
+					break
+				}
+			}
+			if column.Property == "" {
+				column.Property = PropertyNameFromHeader(h)
+			}
+		}
+
+		if column.Property != "" {
+			if first, exists := used[column.Property]; exists {
+				return nil, &ImportError{Reason: fmt.Sprintf("columns %q and %q both map to property %s",
+					first, h, column.Property)}
+			}
+			used[column.Property] = h
+			_, column.Exists = propMap[column.Property]
+		}
+
+		columns[i] = column
+	}
+
+	return columns, nil
+}
+
+// ParseImportRow converts the values of a row of an imported file to the data types of the mapped properties.
+// It returns the values by property name, or the conversion errors per property.
+func ParseImportRow(columns []ImportColumn, row []string, props []ModelProperty) (map[string]interface{}, []ValidationErrorDetail) {
+	propMap := make(map[string]ModelProperty)
+	for _, p := range props {
+		propMap[p.Name] = p
+	}
+
+	values := make(map[string]interface{})
+	var details []ValidationErrorDetail
+	for i, c := range columns {
+		p, found := propMap[c.Property]
+		if c.Property == "" || !found || i >= len(row) {
+			continue
+		}
+
+		v, err := p.DataType.ParseString(row[i])
+		if err != nil {
+			details = append(details, ValidationErrorDetail{Property: p.Name, Message: err.Error()})
+			continue
+		}
+		if v != nil {
+			values[p.Name] = v
+		}
+	}
+
+	return values, details
+}
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestImports(t *testing.T) {
+	for scenario, fn := range map[string]func(
+		tt *testing.T,
+	){
+		"parse delimited text values":   testParseString,
+		"infer data type of a column":   testInferDataType,
+		"map columns onto properties":   testMapImportColumns,
+		"parse row of an imported file": testParseImportRow,
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			fn(t)
+		})
+	}
+}
+
+func testParseString(t *testing.T) {
+	v, err := DataType{Type: LONG}.ParseString(" 42 ")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), v)
+
+	_, err = DataType{Type: LONG}.ParseString("4.2")
+	assert.EqualError(t, err, "expected Long, got decimal number 4.2")
+
+	_, err = DataType{Type: LONG}.ParseString("old")
+	assert.EqualError(t, err, `expected Long, got "old"`)
+
+	v, err = DataType{Type: BOOLEAN}.ParseString("Yes")
+	assert.NoError(t, err)
+	assert.Equal(t, true, v)
+
+	v, err = DataType{Type: DATE}.ParseString("2022-01-31")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2022, 1, 31, 0, 0, 0, 0, time.UTC), v)
+
+	v, err = DataType{Type: DOUBLE, IsArray: true}.ParseString("1.5; 2;")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{1.5, 2.0}, v)
+
+	v, err = DataType{Type: STRING}.ParseString("")
+	assert.NoError(t, err)
+	assert.Nil(t, v)
+
+	_, err = DataType{Type: STRING, Enum: []interface{}{"left", "right"}}.ParseString("up")
+	assert.Error(t, err)
+}
+
+func testInferDataType(t *testing.T) {
+	assert.Equal(t, DataType{Type: LONG}, InferDataType([]string{"1", "", "20"}))
+	assert.Equal(t, DataType{Type: DOUBLE}, InferDataType([]string{"1", "2.5"}))
+	assert.Equal(t, DataType{Type: BOOLEAN}, InferDataType([]string{"true", "no"}))
+	assert.Equal(t, DataType{Type: DATE}, InferDataType([]string{"2022-01-31", "2022-02-01T10:00:00Z"}))
+	assert.Equal(t, DataType{Type: STRING}, InferDataType([]string{"1", "a"}))
+	assert.Equal(t, DataType{Type: STRING}, InferDataType([]string{"", " "}))
+}
+
+func testMapImportColumns(t *testing.T) {
+	props := []ModelProperty{
+		{Name: "name", DisplayName: "Subject Name", DataType: DataType{Type: STRING}, IsModelTitle: true},
+		{Name: "age", DisplayName: "Age", DataType: DataType{Type: LONG}},
+	}
+
+	columns, err := MapImportColumns([]string{"@id", "Subject Name", "AGE", "Body Weight (kg)", "notes"}, props,
+		map[string]string{"notes": ""})
+	assert.NoError(t, err)
+	assert.Equal(t, []ImportColumn{
+		{Header: "@id"},
+		{Header: "Subject Name", Property: "name", Exists: true},
+		{Header: "AGE", Property: "age", Exists: true},
+		{Header: "Body Weight (kg)", Property: "Body_Weight_kg"},
+		{Header: "notes", Mapped: true},
+	}, columns)
+
+	columns, err = MapImportColumns([]string{"id", "years"}, props, map[string]string{"id": "name", "years": "age"})
+	assert.NoError(t, err)
+	assert.Equal(t, "name", columns[0].Property)
+	assert.Equal(t, "age", columns[1].Property)
+
+	_, err = MapImportColumns([]string{"name"}, props, map[string]string{"label": "name"})
+	assert.Equal(t, &ImportError{Reason: "mapping contains unknown columns: label"}, err)
+
+	_, err = MapImportColumns([]string{"name", "Name"}, props, nil)
+	assert.Equal(t, &ImportError{Reason: `columns "name" and "Name" both map to property name`}, err)
+
+	assert.Equal(t, "_1st_visit", PropertyNameFromHeader("1st visit"))
+}
+
+func testParseImportRow(t *testing.T) {
+	props := []ModelProperty{
+		{Name: "name", DataType: DataType{Type: STRING}, IsModelTitle: true},
+		{Name: "age", DataType: DataType{Type: LONG}},
+	}
+	columns := []ImportColumn{
+		{Header: "name", Property: "name", Exists: true},
+		{Header: "age", Property: "age", Exists: true},
+		{Header: "notes"},
+	}
+
+	values, details := ParseImportRow(columns, []string{"Joe", "42", "skipped"}, props)
+	assert.Empty(t, details)
+	assert.Equal(t, map[string]interface{}{"name": "Joe", "age": int64(42)}, values)
+
+	values, details = ParseImportRow(columns, []string{"Joe", "", ""}, props)
+	assert.Empty(t, details)
+	assert.Equal(t, map[string]interface{}{"name": "Joe"}, values)
+
+	_, details = ParseImportRow(columns, []string{"Joe", "old", ""}, props)
+	assert.Equal(t, []ValidationErrorDetail{{Property: "age", Message: `expected Long, got "old"`}}, details)
+}
@@ -20,16 +20,49 @@ type Model struct {
 	UpdatedBy     string      `json:"updatedBy"`
 }
 
+type CreateModelRequestBody struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	Description string `json:"description"`
+}
+
+// UpdateModelRequestBody contains the model attributes that can be updated; nil values are left unchanged.
+type UpdateModelRequestBody struct {
+	DisplayName *string `json:"displayName"`
+	Description *string `json:"description"`
+}
+
 type ModelProperty struct {
 	ID           string      `json:"id"`
-	DataType     interface{} `json:"data_type"`
+	DataType     DataType    `json:"data_type"`
 	DefaultValue interface{} `json:"default"`
 	DisplayName  string      `json:"display_name"`
+	Description  string      `json:"description"`
 	Name         string      `json:"name"`
 	IsModelTitle bool        `json:"model_title"`
 	Index        int64       `json:"index"`
 }
 
+// UpdateModelPropertiesRequestBody adds or replaces properties by name, and removes properties in the remove list.
+// Properties that are removed or change data type while being used by records require migrate to be set.
+type UpdateModelPropertiesRequestBody struct {
+	Properties []ModelPropertyRequest `json:"properties"`
+	Remove     []string               `json:"remove"`
+	Migrate    bool                   `json:"migrate"`
+}
+
+// ModelPropertyRequest describes a property in an UpdateModelPropertiesRequestBody.
+// A nil Index keeps the current position of an existing property and appends a new property.
+type ModelPropertyRequest struct {
+	Name         string      `json:"name"`
+	DisplayName  string      `json:"display_name"`
+	Description  string      `json:"description"`
+	DataType     *DataType   `json:"data_type"`
+	DefaultValue interface{} `json:"default"`
+	IsModelTitle bool        `json:"model_title"`
+	Index        *int64      `json:"index"`
+}
+
 // String returns a string representation of the model.
 func (m Model) String() string {
 	return fmt.Sprintf("Model -- name: %s, id: %s", m.Name, m.ID)
@@ -1,10 +1,13 @@
 package models
 
-import "database/sql"
+import (
+	"database/sql"
+	"time"
+)
 
 type PackageAncestorsResponse struct {
-	id        string            `json:"id"`
-	ancestors []PackageAncestor `json:"ancestors"`
+	ID        string            `json:"id"`
+	Ancestors []PackageAncestor `json:"ancestors"`
 }
 
 type PackageAncestor struct {
@@ -13,3 +16,24 @@ type PackageAncestor struct {
 	Name     string         `json:"name"`
 	ParentId sql.NullString `json:"parent_id"`
 }
+
+// Package is a Pennsieve package in Postgres that records can be attached to.
+type Package struct {
+	ID        int64  `json:"id"`
+	NodeID    string `json:"node_id"`
+	Name      string `json:"name"`
+	DatasetID int64  `json:"dataset_id"`
+	State     string `json:"state"`
+}
+
+// RecordPackage is a proxy relationship that attaches a record to a package.
+type RecordPackage struct {
+	ID            string    `json:"id"`
+	RecordID      string    `json:"record_id"`
+	PackageID     int64     `json:"package_id"`
+	PackageNodeID string    `json:"package_node_id"`
+	CreatedAt     time.Time `json:"createdAt"`
+	CreatedBy     string    `json:"createdBy"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+	UpdatedBy     string    `json:"updatedBy"`
+}
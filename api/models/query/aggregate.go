@@ -0,0 +1,145 @@
+package query
+
+import "github.com/pennsieve/model-service-serverless/api/models"
+
+type AggregateFunction int64
+
+const (
+	AGG_COUNT AggregateFunction = iota
+	AGG_COUNT_DISTINCT
+	AGG_MIN
+	AGG_MAX
+	AGG_AVG
+	AGG_SUM
+)
+
+func (f AggregateFunction) String() string {
+	switch f {
+	case AGG_COUNT:
+		return "count"
+	case AGG_COUNT_DISTINCT:
+		return "count_distinct"
+	case AGG_MIN:
+		return "min"
+	case AGG_MAX:
+		return "max"
+	case AGG_AVG:
+		return "avg"
+	case AGG_SUM:
+		return "sum"
+	}
+	return "unknown"
+}
+
+// AppliesTo reports whether the function can aggregate the values of a property with the data type.
+// Counts apply to all properties, min and max to all scalar properties, and avg and sum to numeric properties.
+func (f AggregateFunction) AppliesTo(d models.DataType) bool {
+	switch f {
+	case AGG_COUNT, AGG_COUNT_DISTINCT:
+		return true
+	case AGG_MIN, AGG_MAX:
+		return !d.IsArray && d.Type != models.BOOLEAN
+	case AGG_AVG, AGG_SUM:
+		return !d.IsArray && (d.Type == models.LONG || d.Type == models.DOUBLE)
+	}
+	return false
+}
+
+// ResultType returns the data type of the result of the function over a property with the data type.
+func (f AggregateFunction) ResultType(d models.DataType) models.DataType {
+	switch f {
+	case AGG_COUNT, AGG_COUNT_DISTINCT:
+		return models.DataType{Type: models.LONG}
+	case AGG_AVG:
+		return models.DataType{Type: models.DOUBLE}
+	}
+	return models.DataType{Type: d.Type, Unit: d.Unit}
+}
+
+var StringToAggregateFunctionDict = map[string]AggregateFunction{
+	"count":          AGG_COUNT,
+	"count_distinct": AGG_COUNT_DISTINCT,
+	"min":            AGG_MIN,
+	"max":            AGG_MAX,
+	"avg":            AGG_AVG,
+	"sum":            AGG_SUM,
+}
+
+// PropertyRef references a property of the queried model or of a related model. An empty Model references the
+// queried model.
+type PropertyRef struct {
+	Model    string `json:"model"`
+	Property string `json:"property"`
+}
+
+// Aggregation applies a function, e.g. "avg", to the values of a property. A count without a property counts
+// the records of the model.
+type Aggregation struct {
+	PropertyRef
+	Function string `json:"function"`
+}
+
+// Aggregate groups the records that match a query by the values of the GroupBy properties, and computes the
+// aggregations per group. Without GroupBy properties, all records are a single group. Properties of related
+// models are joined through the same paths as filters, and each distinct combination of records of the
+// referenced models is aggregated once.
+type Aggregate struct {
+	Aggregations []Aggregation `json:"aggregations"`
+	GroupBy      []PropertyRef `json:"group_by"`
+}
+
+// WithModel returns the aggregate in which references without a model reference the provided model.
+func (a Aggregate) WithModel(model string) Aggregate {
+	result := Aggregate{
+		Aggregations: make([]Aggregation, len(a.Aggregations)),
+		GroupBy:      make([]PropertyRef, len(a.GroupBy)),
+	}
+	for i, ag := range a.Aggregations {
+		if ag.Model == "" {
+			ag.Model = model
+		}
+		result.Aggregations[i] = ag
+	}
+	for i, g := range a.GroupBy {
+		if g.Model == "" {
+			g.Model = model
+		}
+		result.GroupBy[i] = g
+	}
+	return result
+}
+
+// Models returns the names of the models that are referenced in the aggregate.
+func (a Aggregate) Models() []string {
+	var names []string
+	for _, ag := range a.Aggregations {
+		names = append(names, ag.Model)
+	}
+	for _, g := range a.GroupBy {
+		names = append(names, g.Model)
+	}
+	return names
+}
+
+// AggregateColumn describes a group-by property or an aggregation in an AggregateResponse, and the data type of its
+// values.
+type AggregateColumn struct {
+	Model    string          `json:"model"`
+	Property string          `json:"property,omitempty"`
+	Function string          `json:"function,omitempty"`
+	DataType models.DataType `json:"data_type"`
+}
+
+// AggregateGroup contains the values of the group-by properties of a group in Keys, and the results of the
+// aggregations for the group in Values, in the order of the columns of the response.
+type AggregateGroup struct {
+	Keys   []interface{} `json:"keys"`
+	Values []interface{} `json:"values"`
+}
+
+type AggregateResponse struct {
+	ModelName    string            `json:"model"`
+	GroupBy      []AggregateColumn `json:"group_by"`
+	Aggregations []AggregateColumn `json:"aggregations"`
+	Groups       []AggregateGroup  `json:"groups"`
+}
@@ -0,0 +1,63 @@
+package query
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/pennsieve/model-service-serverless/api/models"
+)
+
+const (
+	// DefaultPageSize is the number of records in a page of query results when the request does not set a limit.
+	DefaultPageSize = 50
+
+	// MaxPageSize is the maximum number of records in a page of query results.
+	MaxPageSize = 1000
+
+	// MaxLinkedRecords is the maximum number of linked records of the included models that are returned with a
+	// record in a page of query results.
+	MaxLinkedRecords = 100
+)
+
+// PageLimit returns the number of records to return in a page of results of the query.
+func (q QueryRequestBody) PageLimit() int {
+	switch {
+	case q.Limit <= 0:
+		return DefaultPageSize
+	case q.Limit > MaxPageSize:
+		return MaxPageSize
+	}
+	return q.Limit
+}
+
+// Cursor is the position of a record in the results of a query. Order describes the order of the results, and Keys
+// are the values by which the record is ordered, which end with the sort key of the record. Numbers are decoded as
+// json.Number.
+type Cursor struct {
+	Order string        `json:"o"`
+	Keys  []interface{} `json:"k"`
+}
+
+// Encode returns the cursor as an opaque string that can be used in URLs.
+func (c Cursor) Encode() string {
+	// The cursor only contains values of record properties, which are valid JSON values
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor returns the cursor that was encoded by Cursor.Encode.
+func DecodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, &models.InvalidCursorError{}
+	}
+
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+
+	var c Cursor
+	if err = d.Decode(&c); err != nil || c.Order == "" || len(c.Keys) == 0 {
+		return nil, &models.InvalidCursorError{}
+	}
+	return &c, nil
+}
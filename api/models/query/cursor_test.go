@@ -0,0 +1,27 @@
+package query
+
+import (
+	"encoding/json"
+	"github.com/pennsieve/model-service-serverless/api/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCursor(t *testing.T) {
+	c := Cursor{Order: "patient.age desc", Keys: []interface{}{nil, "LIM031", int64(9007199254740993)}}
+
+	decoded, err := DecodeCursor(c.Encode())
+	assert.NoError(t, err)
+	assert.Equal(t, &Cursor{Order: c.Order, Keys: []interface{}{nil, "LIM031", json.Number("9007199254740993")}}, decoded)
+
+	for _, invalid := range []string{"", "not a cursor", Cursor{Order: "patient.age desc"}.Encode()} {
+		_, err = DecodeCursor(invalid)
+		assert.IsType(t, &models.InvalidCursorError{}, err, invalid)
+	}
+}
+
+func TestPageLimit(t *testing.T) {
+	assert.Equal(t, DefaultPageSize, QueryRequestBody{}.PageLimit())
+	assert.Equal(t, 20, QueryRequestBody{Limit: 20}.PageLimit())
+	assert.Equal(t, MaxPageSize, QueryRequestBody{Limit: MaxPageSize + 1}.PageLimit())
+}
@@ -0,0 +1,35 @@
+package query
+
+import "github.com/pennsieve/model-service-serverless/api/models"
+
+// ExplainRequestBody is a query of which the generated Cypher is returned instead of the results. When Plan is set,
+// the execution plan of the query is returned as well. The query is not run.
+type ExplainRequestBody struct {
+	QueryRequestBody
+	Plan bool `json:"plan"`
+}
+
+// ExplainResponse describes how a query is run: the queried model, the shortest paths from the queried model to the
+// models in the query, and the Cypher of the query that returns the page of records, or the groups of an aggregate
+// query, with its parameters.
+type ExplainResponse struct {
+	Model  models.Model           `json:"model"`
+	Paths  []ModelPath            `json:"paths"`
+	Cypher string                 `json:"cypher"`
+	Params map[string]interface{} `json:"params"`
+	Plan   *Plan                  `json:"plan,omitempty"`
+}
+
+// ModelPath is a path between models. Relationships[i] relates Models[i] and Models[i+1].
+type ModelPath struct {
+	Models        []string `json:"models"`
+	Relationships []string `json:"relationships"`
+}
+
+// Plan is a step in the execution plan of a query, which gets its input rows from its children.
+type Plan struct {
+	Operator    string                 `json:"operator"`
+	Arguments   map[string]interface{} `json:"arguments,omitempty"`
+	Identifiers []string               `json:"identifiers,omitempty"`
+	Children    []Plan                 `json:"children,omitempty"`
+}
@@ -0,0 +1,170 @@
+package query
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/pennsieve/model-service-serverless/api/models"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+type ExportFormat int64
+
+const (
+	JSON ExportFormat = iota
+	CSV
+	TSV
+	NDJSON
+)
+
+func (f ExportFormat) String() string {
+	switch f {
+	case JSON:
+		return "json"
+	case CSV:
+		return "csv"
+	case TSV:
+		return "tsv"
+	case NDJSON:
+		return "ndjson"
+	}
+	return "unknown"
+}
+
+// ContentType returns the media type of an export in the format.
+func (f ExportFormat) ContentType() string {
+	switch f {
+	case CSV:
+		return "text/csv"
+	case TSV:
+		return "text/tab-separated-values"
+	case NDJSON:
+		return "application/x-ndjson"
+	}
+	return "application/json"
+}
+
+var StringToExportFormatDict = map[string]ExportFormat{
+	"json":   JSON,
+	"csv":    CSV,
+	"tsv":    TSV,
+	"ndjson": NDJSON,
+}
+
+var MediaTypeToExportFormatDict = map[string]ExportFormat{
+	"application/json":          JSON,
+	"text/csv":                  CSV,
+	"text/tab-separated-values": TSV,
+	"application/x-ndjson":      NDJSON,
+	"application/ndjson":        NDJSON,
+}
+
+// ExportIdColumn is the header of the column that contains the record ids in CSV and TSV exports.
+const ExportIdColumn = "@id"
+
+// RecordWriter writes the records of a model as rows of a CSV, TSV or NDJSON export.
+// CSV and TSV exports have a column per property, ordered by the index of the property, and array values are
+// joined with models.ArrayDelimiter. TSV exports start with a byte order mark and use CRLF line endings so
+// spreadsheet applications detect the encoding. Cells that spreadsheet applications would evaluate as formulas are
+// escaped with escapeFormula.
+type RecordWriter struct {
+	columns []models.ModelProperty
+	csv     *csv.Writer
+	json    *json.Encoder
+}
+
+// NewRecordWriter returns a RecordWriter for records with the provided properties, and writes the header of the export.
+func NewRecordWriter(w io.Writer, format ExportFormat, props []models.ModelProperty) (*RecordWriter, error) {
+	rw := &RecordWriter{}
+
+	switch format {
+	case NDJSON:
+		rw.json = json.NewEncoder(w)
+		return rw, nil
+	case CSV:
+		rw.csv = csv.NewWriter(w)
+	case TSV:
+		if _, err := w.Write([]byte("\xef\xbb\xbf")); err != nil {
+			return nil, err
+		}
+		rw.csv = csv.NewWriter(w)
+		rw.csv.Comma = '\t'
+		rw.csv.UseCRLF = true
+	default:
+		return nil, fmt.Errorf("unsupported export format: %s", format)
+	}
+
+	rw.columns = append(rw.columns, props...)
+	sort.SliceStable(rw.columns, func(i, j int) bool { return rw.columns[i].Index < rw.columns[j].Index })
+
+	header := []string{escapeFormula(ExportIdColumn)}
+	for _, p := range rw.columns {
+		header = append(header, escapeFormula(p.Name))
+	}
+
+	return rw, rw.csv.Write(header)
+}
+
+// Write writes a record as a row of the export.
+func (rw *RecordWriter) Write(record models.Record) error {
+	if rw.json != nil {
+		return rw.json.Encode(record)
+	}
+
+	row := []string{escapeFormula(record.ID)}
+	for _, p := range rw.columns {
+		value := record.Props[p.Name]
+		switch value.(type) {
+		case int64, float64:
+			// Negative numbers are numbers, not formulas
+			row = append(row, formatExportValue(value))
+		default:
+			row = append(row, escapeFormula(formatExportValue(value)))
+		}
+	}
+
+	return rw.csv.Write(row)
+}
+
+// Flush writes any buffered rows to the underlying writer.
+func (rw *RecordWriter) Flush() error {
+	if rw.csv == nil {
+		return nil
+	}
+
+	rw.csv.Flush()
+	return rw.csv.Error()
+}
+
+// formatExportValue returns the text representation of a record value in a CSV or TSV export.
+func formatExportValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case interface{ Time() time.Time }:
+		return v.Time().Format(time.RFC3339Nano)
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = formatExportValue(item)
+		}
+		return strings.Join(items, models.ArrayDelimiter)
+	}
+	return fmt.Sprint(value)
+}
+
+// escapeFormula prefixes a cell that starts with a character that makes spreadsheet applications evaluate the cell
+// as a formula with a single quote, so the cell is shown as text.
+func escapeFormula(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
@@ -0,0 +1,71 @@
+package query
+
+import (
+	"bytes"
+	"github.com/pennsieve/model-service-serverless/api/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRecordWriter(t *testing.T) {
+	props := []models.ModelProperty{
+		{Name: "tags", DataType: models.DataType{Type: models.STRING, IsArray: true}, Index: 2},
+		{Name: "name", DataType: models.DataType{Type: models.STRING}, IsModelTitle: true, Index: 0},
+		{Name: "visit", DataType: models.DataType{Type: models.DATE}, Index: 1},
+	}
+	record := models.Record{
+		ID:    "1",
+		Model: "patient",
+		Props: map[string]interface{}{
+			"name":  "Doe, Jane",
+			"visit": time.Date(2022, 1, 31, 0, 0, 0, 0, time.UTC),
+			"tags":  []interface{}{"a", "b"},
+		},
+	}
+
+	for format, expected := range map[ExportFormat]string{
+		CSV:    "'@id,name,visit,tags\n1,\"Doe, Jane\",2022-01-31T00:00:00Z,a;b\n",
+		TSV:    "\xef\xbb\xbf'@id\tname\tvisit\ttags\r\n1\tDoe, Jane\t2022-01-31T00:00:00Z\ta;b\r\n",
+		NDJSON: `{"id":"1","model":"patient","props":{"name":"Doe, Jane","tags":["a","b"],"visit":"2022-01-31T00:00:00Z"}}` + "\n",
+	} {
+		var buf bytes.Buffer
+		w, err := NewRecordWriter(&buf, format, props)
+		assert.NoError(t, err)
+		assert.NoError(t, w.Write(record))
+		assert.NoError(t, w.Flush())
+		assert.Equal(t, expected, buf.String(), format.String())
+	}
+
+	_, err := NewRecordWriter(&bytes.Buffer{}, JSON, props)
+	assert.EqualError(t, err, "unsupported export format: json")
+}
+
+func TestRecordWriterEscapesFormulas(t *testing.T) {
+	props := []models.ModelProperty{
+		{Name: "name", DataType: models.DataType{Type: models.STRING}, IsModelTitle: true, Index: 0},
+		{Name: "=label", DataType: models.DataType{Type: models.STRING, IsArray: true}, Index: 1},
+		{Name: "change", DataType: models.DataType{Type: models.LONG}, Index: 2},
+	}
+	record := models.Record{
+		ID: "1",
+		Props: map[string]interface{}{
+			"name":   "=HYPERLINK(\"http://example.com\")",
+			"=label": []interface{}{"+a", "b"},
+			"change": int64(-5),
+		},
+	}
+
+	var buf bytes.Buffer
+	w, err := NewRecordWriter(&buf, CSV, props)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Write(record))
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, "'@id,name,'=label,change\n1,\"'=HYPERLINK(\"\"http://example.com\"\")\",'+a;b,-5\n", buf.String())
+
+	for cell, expected := range map[string]string{
+		"-1": "'-1", "@SUM(A1)": "'@SUM(A1)", "\tx": "'\tx", "\rx": "'\rx", "a=b": "a=b", "": "",
+	} {
+		assert.Equal(t, expected, escapeFormula(cell))
+	}
+}
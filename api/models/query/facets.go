@@ -0,0 +1,41 @@
+package query
+
+const (
+	// DefaultFacetSize is the number of values of a facet when the request does not set a size.
+	DefaultFacetSize = 10
+
+	// MaxFacetSize is the maximum number of values of a facet.
+	MaxFacetSize = 100
+)
+
+// Facet requests the Size most frequent values of a property of the queried model or of a related model, with the
+// number of matching records per value. Values are counted under all filters of the query except the filters on
+// the property itself, so the counts show how the results change when the filter on the property changes. Items of
+// array properties are counted separately.
+type Facet struct {
+	PropertyRef
+	Size int `json:"size"`
+}
+
+// Limit returns the number of values to return for the facet.
+func (f Facet) Limit() int {
+	switch {
+	case f.Size <= 0:
+		return DefaultFacetSize
+	case f.Size > MaxFacetSize:
+		return MaxFacetSize
+	}
+	return f.Size
+}
+
+type FacetValue struct {
+	Value interface{} `json:"value"`
+	Count int64       `json:"count"`
+}
+
+// FacetResult contains the most frequent values of a property, ordered by the number of records.
+type FacetResult struct {
+	Model    string       `json:"model"`
+	Property string       `json:"property"`
+	Values   []FacetValue `json:"values"`
+}
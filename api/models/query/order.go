@@ -0,0 +1,68 @@
+package query
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+const (
+	ASCENDING  = "asc"
+	DESCENDING = "desc"
+)
+
+// OrderBy orders the records of a query by the values of a property of the queried model or of a related model.
+// Direction is "asc", the default, or "desc". Records without a value are ordered last in ascending order and
+// first in descending order. Records that are related to multiple records of a model are ordered by the lowest
+// value in ascending order and by the highest value in descending order.
+type OrderBy struct {
+	PropertyRef
+	Direction string `json:"direction"`
+}
+
+// Descending reports whether the records are ordered by descending values.
+func (o OrderBy) Descending() bool {
+	return strings.ToLower(o.Direction) == DESCENDING
+}
+
+// OrderByList orders the records of a query by the first entry, and records with the same values by the next
+// entries. For backward compatibility, it can be decoded from the name of a property of the queried model.
+type OrderByList []OrderBy
+
+func (l *OrderByList) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*l = nil
+		if name != "" {
+			*l = OrderByList{{PropertyRef: PropertyRef{Property: name}}}
+		}
+		return nil
+	}
+
+	var entries []OrderBy
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	*l = entries
+	return nil
+}
+
+// WithModel returns the entries in which references without a model reference the provided model.
+func (l OrderByList) WithModel(model string) OrderByList {
+	var result OrderByList
+	for _, o := range l {
+		if o.Model == "" {
+			o.Model = model
+		}
+		result = append(result, o)
+	}
+	return result
+}
+
+// Models returns the names of the models that are referenced in the entries.
+func (l OrderByList) Models() []string {
+	var names []string
+	for _, o := range l {
+		names = append(names, o.Model)
+	}
+	return names
+}
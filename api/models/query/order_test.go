@@ -0,0 +1,31 @@
+package query
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestOrderByList(t *testing.T) {
+	var req QueryRequestBody
+	assert.NoError(t, json.Unmarshal([]byte(`{"order_by": "age"}`), &req))
+	assert.Equal(t, OrderByList{{PropertyRef: PropertyRef{Property: "age"}}}, req.OrderBy)
+
+	req = QueryRequestBody{}
+	assert.NoError(t, json.Unmarshal([]byte(`{"order_by": ""}`), &req))
+	assert.Nil(t, req.OrderBy)
+
+	req = QueryRequestBody{}
+	assert.NoError(t, json.Unmarshal([]byte(
+		`{"order_by": [{"model": "visits", "property": "date", "direction": "DESC"}, {"property": "age"}]}`), &req))
+	orderBy := req.OrderBy.WithModel("patient")
+	assert.Equal(t, OrderByList{
+		{PropertyRef: PropertyRef{Model: "visits", Property: "date"}, Direction: "DESC"},
+		{PropertyRef: PropertyRef{Model: "patient", Property: "age"}},
+	}, orderBy)
+	assert.True(t, orderBy[0].Descending())
+	assert.False(t, orderBy[1].Descending())
+	assert.Equal(t, []string{"visits", "patient"}, orderBy.Models())
+
+	assert.Error(t, json.Unmarshal([]byte(`{"order_by": 1}`), &req))
+}
@@ -2,34 +2,96 @@ package query
 
 import "github.com/pennsieve/model-service-serverless/api/models"
 
+// QueryRequestBody describes a query for records of a model. Records match all Filters and the Where filter tree.
+// A Format other than "json" exports all pages of results, see ExportFormat. When Aggregate is set, the query
+// returns aggregations over the matching records instead, see AggregateResponse. Facets adds the most frequent
+// values of properties to the response, see Facet. Include lists related models of which the linked records are
+// returned with each record, see models.Record; exports do not include linked records. Pages of results start
+// after the Cursor of the previous page, see QueryResponse, or at Offset when there is no cursor. Records are
+// ordered by the OrderBy entries, see OrderByList. SkipTotal skips counting the matching records.
 type QueryRequestBody struct {
-	Model   string    `json:"model"`
-	Filters []Filters `json:"filters"`
-	OrderBy string    `json:"order_by"`
-	Limit   int       `json:"limit"`
-	Offset  int       `json:"offset"`
+	Model     string       `json:"model"`
+	Filters   []Filters    `json:"filters"`
+	Where     *FilterGroup `json:"where"`
+	OrderBy   OrderByList  `json:"order_by"`
+	Limit     int          `json:"limit"`
+	Offset    int          `json:"offset"`
+	Format    string       `json:"format"`
+	Aggregate *Aggregate   `json:"aggregate"`
+	Facets    []Facet      `json:"facets"`
+	Include   []string     `json:"include"`
+	Cursor    string       `json:"cursor"`
+	SkipTotal bool         `json:"skip_total"`
 }
 
+// Filters is a filter on a property of a model. Operator is a named models.Operator, e.g. "GREATER_THAN", or a legacy
+// Cypher symbol, e.g. ">". Value is a JSON value of the data type of the property, e.g. a number for Long and Double
+// properties or an ISO-8601 string for Date properties, or a list of values for IN, NOT_IN and BETWEEN. For EQUALS
+// and NOT_EQUALS a list value matches an array property as a whole; other values match when any item matches.
 type Filters struct {
-	Model    string `json:"model"`
-	Property string `json:"property"`
-	Operator string `json:"operator"`
-	Value    string `json:"value"`
+	Model    string      `json:"model"`
+	Property string      `json:"property"`
+	Operator string      `json:"operator"`
+	Value    interface{} `json:"value"`
 }
 
+// IsZero reports whether none of the fields of the filter are set.
+func (f Filters) IsZero() bool {
+	return f.Model == "" && f.Property == "" && f.Operator == "" && f.Value == nil
+}
+
+// FilterGroup is a node in a boolean filter tree. A node either combines child nodes with And, Or or Not,
+// or is a single filter, e.g.
+// {"or": [{"model": "patient", "property": "age", "operator": ">", "value": 60}, {"not": {...}}]}.
+type FilterGroup struct {
+	Filters
+	And []FilterGroup `json:"and"`
+	Or  []FilterGroup `json:"or"`
+	Not *FilterGroup  `json:"not"`
+}
+
+// Leaves returns the filters in the tree.
+func (g *FilterGroup) Leaves() []Filters {
+	if g == nil {
+		return nil
+	}
+
+	var leaves []Filters
+	switch {
+	case g.And != nil || g.Or != nil:
+		for _, c := range g.And {
+			leaves = append(leaves, c.Leaves()...)
+		}
+		for _, c := range g.Or {
+			leaves = append(leaves, c.Leaves()...)
+		}
+	case g.Not != nil:
+		leaves = g.Not.Leaves()
+	default:
+		leaves = []Filters{g.Filters}
+	}
+
+	return leaves
+}
+
+// QueryResponse contains a page of records that match a query. NextCursor is set when the page is full, and is the
+// cursor of the next page. Total is the number of records that match the query, unless the query skips the total.
 type QueryResponse struct {
-	ModelName string          `json:"model"`
-	Limit     int             `json:"limit"`
-	Offset    int             `json:"offset"`
-	Total     int             `json:"total"s`
-	Records   []models.Record `json:"records"`
+	ModelName  string          `json:"model"`
+	Limit      int             `json:"limit"`
+	Offset     int             `json:"offset"`
+	Total      *int            `json:"total,omitempty"`
+	Records    []models.Record `json:"records"`
+	Facets     []FacetResult   `json:"facets,omitempty"`
+	NextCursor string          `json:"next_cursor,omitempty"`
 }
 
 type AutocompleteRequestBody struct {
-	Model    string    `json:"model"`
-	Property string    `json:"property"`
-	Text     string    `json:"text"`
-	Filters  []Filters `json:"filters"`
+	Model    string       `json:"model"`
+	Property string       `json:"property"`
+	Text     string       `json:"text"`
+	Filters  []Filters    `json:"filters"`
+	Where    *FilterGroup `json:"where"`
 }
 
 type AutocompleteResponse struct {
@@ -46,6 +108,10 @@ type AutoCompleteParams struct {
 type FormatParams struct {
 	ResultType         FormatType
 	AutoCompleteParams AutoCompleteParams
+	Aggregate          Aggregate
+	Facet              Facet
+	Include            []models.Model
+	After              *Cursor
 }
 
 type FormatType int64
@@ -54,6 +120,8 @@ const (
 	RESULTS FormatType = iota
 	COUNT
 	AUTOCOMPLETE
+	AGGREGATE
+	FACET
 )
 
 func (q FormatType) String() string {
@@ -64,6 +132,10 @@ func (q FormatType) String() string {
 		return "COUNT"
 	case AUTOCOMPLETE:
 		return "AUTOCOMPLETE"
+	case AGGREGATE:
+		return "AGGREGATE"
+	case FACET:
+		return "FACET"
 	}
 	return "UNKNOWN"
 }
@@ -0,0 +1,129 @@
+package query
+
+import (
+	"fmt"
+	"github.com/pennsieve/model-service-serverless/api/models"
+	"time"
+)
+
+// SavedQuery is a named query that is stored with a dataset, so it can be run again by the users of the dataset.
+type SavedQuery struct {
+	ID          string           `json:"id"`
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Query       QueryRequestBody `json:"query"`
+	CreatedAt   time.Time        `json:"createdAt"`
+	CreatedBy   string           `json:"createdBy"`
+	UpdatedAt   time.Time        `json:"updatedAt"`
+	UpdatedBy   string           `json:"updatedBy"`
+}
+
+type CreateSavedQueryRequestBody struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Query       QueryRequestBody `json:"query"`
+}
+
+// UpdateSavedQueryRequestBody replaces the fields of a saved query that are set.
+type UpdateSavedQueryRequestBody struct {
+	Name        *string           `json:"name"`
+	Description *string           `json:"description"`
+	Query       *QueryRequestBody `json:"query"`
+}
+
+// RunSavedQueryRequestBody overrides the page and format of a saved query when it is run. Values replace the value
+// of the filters of the saved query on the same model and property, and with the same operator when it is set.
+type RunSavedQueryRequestBody struct {
+	Limit     *int      `json:"limit"`
+	Offset    *int      `json:"offset"`
+	Cursor    string    `json:"cursor"`
+	SkipTotal *bool     `json:"skip_total"`
+	Format    string    `json:"format"`
+	Values    []Filters `json:"values"`
+}
+
+// WithOverrides returns the query with the overrides of a request to run it. Filters without a model filter on the
+// queried model. It returns an InvalidFilterError when a value does not match a filter of the query.
+func (q QueryRequestBody) WithOverrides(o RunSavedQueryRequestBody) (QueryRequestBody, error) {
+	if o.Limit != nil {
+		q.Limit = *o.Limit
+	}
+	if o.Offset != nil {
+		q.Offset = *o.Offset
+	}
+	if o.SkipTotal != nil {
+		q.SkipTotal = *o.SkipTotal
+	}
+	if o.Cursor != "" {
+		q.Cursor = o.Cursor
+	}
+	if o.Format != "" {
+		q.Format = o.Format
+	}
+
+	for _, v := range o.Values {
+		if v.Model == "" {
+			v.Model = q.Model
+		}
+
+		found := false
+		filters := make([]Filters, len(q.Filters))
+		for i, f := range q.Filters {
+			filters[i], found = withValue(f, v, q.Model, found)
+		}
+		q.Filters = filters
+
+		if q.Where != nil {
+			where := q.Where.withValue(v, q.Model, &found)
+			q.Where = &where
+		}
+
+		if !found {
+			return q, &models.InvalidFilterError{
+				Reason: fmt.Sprintf("no filter on property %s of model %s to override", v.Property, v.Model)}
+		}
+	}
+
+	return q, nil
+}
+
+// withValue returns the filter group with the value of the filters that match the override replaced.
+func (g FilterGroup) withValue(v Filters, model string, found *bool) FilterGroup {
+	if !g.Filters.IsZero() {
+		g.Filters, *found = withValue(g.Filters, v, model, *found)
+	}
+
+	children := func(groups []FilterGroup) []FilterGroup {
+		if groups == nil {
+			return nil
+		}
+		result := make([]FilterGroup, len(groups))
+		for i, c := range groups {
+			result[i] = c.withValue(v, model, found)
+		}
+		return result
+	}
+	g.And = children(g.And)
+	g.Or = children(g.Or)
+	if g.Not != nil {
+		not := g.Not.withValue(v, model, found)
+		g.Not = &not
+	}
+
+	return g
+}
+
+// withValue returns the filter with the value of the override when the override matches the filter, and whether the
+// override matched the filter or an earlier filter.
+func withValue(f Filters, v Filters, model string, found bool) (Filters, bool) {
+	filterModel := f.Model
+	if filterModel == "" {
+		filterModel = model
+	}
+	if filterModel != v.Model || f.Property != v.Property || (v.Operator != "" && v.Operator != f.Operator) {
+		return f, found
+	}
+
+	f.Value = v.Value
+	return f, true
+}
@@ -0,0 +1,60 @@
+package query
+
+import (
+	"encoding/json"
+	"github.com/pennsieve/model-service-serverless/api/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestWithOverrides(t *testing.T) {
+	saved := QueryRequestBody{
+		Model:   "patient",
+		Filters: []Filters{{Property: "age", Operator: ">", Value: 60}},
+		Where: &FilterGroup{Or: []FilterGroup{
+			{Filters: Filters{Model: "visits", Property: "site", Operator: "=", Value: "A"}},
+			{Not: &FilterGroup{Filters: Filters{Model: "patient", Property: "age", Operator: "<", Value: 20}}},
+		}},
+		Limit: 10,
+	}
+
+	limit, skipTotal := 100, true
+	req, err := saved.WithOverrides(RunSavedQueryRequestBody{
+		Limit:     &limit,
+		SkipTotal: &skipTotal,
+		Cursor:    "abc",
+		Values: []Filters{
+			{Property: "age", Operator: ">", Value: 70},
+			{Model: "visits", Property: "site", Value: "B"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 100, req.Limit)
+	assert.Equal(t, 0, req.Offset)
+	assert.True(t, req.SkipTotal)
+	assert.Equal(t, "abc", req.Cursor)
+	assert.Equal(t, 70, req.Filters[0].Value)
+	assert.Equal(t, "B", req.Where.Or[0].Value)
+	assert.Equal(t, 20, req.Where.Or[1].Not.Value)
+
+	// The saved query is not changed
+	assert.Equal(t, 60, saved.Filters[0].Value)
+	assert.Equal(t, "A", saved.Where.Or[0].Value)
+
+	// Without an operator, the value replaces the value of all filters on the property
+	req, err = saved.WithOverrides(RunSavedQueryRequestBody{Values: []Filters{{Property: "age", Value: 50}}})
+	assert.NoError(t, err)
+	assert.Equal(t, 50, req.Filters[0].Value)
+	assert.Equal(t, 50, req.Where.Or[1].Not.Value)
+
+	_, err = saved.WithOverrides(RunSavedQueryRequestBody{Values: []Filters{{Property: "weight", Value: 1}}})
+	assert.IsType(t, &models.InvalidFilterError{}, err)
+
+	// A saved query survives the round trip through its stored form
+	b, err := json.Marshal(saved)
+	assert.NoError(t, err)
+	var decoded QueryRequestBody
+	assert.NoError(t, json.Unmarshal(b, &decoded))
+	assert.Equal(t, saved.Model, decoded.Model)
+	assert.Equal(t, "visits", decoded.Where.Or[0].Model)
+}
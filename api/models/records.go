@@ -1,10 +1,29 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
+const (
+	// LinkPairwise relates the records in the same position of the From and To lists.
+	LinkPairwise = "pairwise"
+	// LinkOneToMany relates the single record in the From list to each record in the To list.
+	LinkOneToMany = "one_to_many"
+	// LinkManyToOne relates each record in the From list to the single record in the To list.
+	LinkManyToOne = "many_to_one"
+	// LinkCrossProduct relates each record in the From list to each record in the To list.
+	LinkCrossProduct = "cross_product"
+)
+
+// PostRecordRelationshipRequestBody relates the records of the To and From lists as described by the mode, which
+// defaults to LinkPairwise. When Replace is set, existing relationships that the cardinality of the model
+// relationship does not allow next to the new relationships are removed, instead of reported as violations.
 type PostRecordRelationshipRequestBody struct {
 	Relationship ModelRelationShip `json:"relationship"`
 	Records      ToFromList        `json:"records"`
+	Mode         string            `json:"mode"`
+	Replace      bool              `json:"replace"`
 }
 
 type ModelRelationShip struct {
@@ -18,6 +37,57 @@ type ToFromList struct {
 	From []string `json:"from"`
 }
 
+// Pairs returns the pairs of records that the mode relates, as lists of the same length, and returns a
+// TooManyRecordRelationshipsError when there are more than maxPairs pairs.
+func (l ToFromList) Pairs(mode string, maxPairs int) (ToFromList, error) {
+	var count int
+	switch mode {
+	case "", LinkPairwise:
+		if len(l.From) != len(l.To) {
+			return ToFromList{}, &InvalidRecordRelationshipsError{
+				Reason: "from and to lists need to be of the same length"}
+		}
+		count = len(l.From)
+	case LinkOneToMany:
+		if len(l.From) != 1 {
+			return ToFromList{}, &InvalidRecordRelationshipsError{
+				Reason: fmt.Sprintf("%s requires a single from record", mode)}
+		}
+		count = len(l.To)
+	case LinkManyToOne:
+		if len(l.To) != 1 {
+			return ToFromList{}, &InvalidRecordRelationshipsError{
+				Reason: fmt.Sprintf("%s requires a single to record", mode)}
+		}
+		count = len(l.From)
+	case LinkCrossProduct:
+		count = len(l.From) * len(l.To)
+	default:
+		return ToFromList{}, &InvalidRecordRelationshipsError{Reason: fmt.Sprintf("unsupported mode: %s", mode)}
+	}
+
+	if count > maxPairs {
+		return ToFromList{}, &TooManyRecordRelationshipsError{Count: count, Max: maxPairs}
+	}
+
+	pairs := ToFromList{From: make([]string, 0, count), To: make([]string, 0, count)}
+	switch mode {
+	case "", LinkPairwise:
+		pairs.From = append(pairs.From, l.From...)
+		pairs.To = append(pairs.To, l.To...)
+	default:
+		// The single record of a list is repeated for each record of the other list
+		for _, from := range l.From {
+			for _, to := range l.To {
+				pairs.From = append(pairs.From, from)
+				pairs.To = append(pairs.To, to)
+			}
+		}
+	}
+
+	return pairs, nil
+}
+
 type ShortRecordRelationShip struct {
 	ID      string `json:"id"`
 	From    string `json:"from"`
@@ -25,6 +95,8 @@ type ShortRecordRelationShip struct {
 	RelType string `json:"type"`
 }
 
+// RecordRelationShip is a relationship between two records. Name is the display name of the model relationship, and
+// Direction is RelationshipOutgoing when the record of which the relationships are listed is the From record.
 type RecordRelationShip struct {
 	ID         string    `json:"id"`
 	From       string    `json:"from"`
@@ -32,18 +104,76 @@ type RecordRelationShip struct {
 	RelType    string    `json:"type"`
 	ModelRelID string    `json:"model_relationship_id"`
 	Name       string    `json:"name"`
+	Direction  string    `json:"direction"`
 	CreatedAt  time.Time `json:"createdAt"`
 	CreatedBy  string    `json:"createdBy"`
 	UpdatedAt  time.Time `json:"updatedAt"`
 	UpdatedBy  string    `json:"updatedBy"`
 }
 
-type Record struct {
-	ID    string                 `json:"id"`
-	Model string                 `json:"model"`
+const (
+	RelationshipOutgoing = "outgoing"
+	RelationshipIncoming = "incoming"
+)
+
+// RecordRelationshipsResponse is a page of the relationships of a record.
+type RecordRelationshipsResponse struct {
+	Limit         int                  `json:"limit"`
+	Offset        int                  `json:"offset"`
+	Relationships []RecordRelationShip `json:"relationships"`
+}
+
+// DeleteRecordRelationshipsRequestBody deletes relationships between records by their ids, and the relationships
+// between the records in the same position of the To and From lists of Records. RelName limits the relationships
+// between the records to the relationships with the name.
+type DeleteRecordRelationshipsRequestBody struct {
+	IDs     []string   `json:"ids"`
+	Records ToFromList `json:"records"`
+	RelName string     `json:"relationship_name"`
+}
+
+type DeleteRecordRelationshipsResponse struct {
+	Deleted int64 `json:"deleted"`
+}
+
+// RecordRequestBody contains the values of a record that is created or updated.
+type RecordRequestBody struct {
 	Props map[string]interface{} `json:"props"`
 }
 
+const (
+	BatchRecordCreated = "created"
+	BatchRecordUpdated = "updated"
+	BatchRecordFailed  = "failed"
+)
+
+// BatchRecordResult is the result of a single row in a batch of records.
+type BatchRecordResult struct {
+	Index  int                     `json:"index"`
+	ID     string                  `json:"id,omitempty"`
+	Status string                  `json:"status"`
+	Errors []ValidationErrorDetail `json:"errors,omitempty"`
+}
+
+type BatchRecordResponse struct {
+	Model   string              `json:"model"`
+	Created int                 `json:"created"`
+	Updated int                 `json:"updated"`
+	Failed  int                 `json:"failed"`
+	Results []BatchRecordResult `json:"results"`
+}
+
+// Record is a record of a model. Linked contains the records that are linked to the record, by the name of the
+// relationship, when they are included in a query. A limited number of linked records is returned, and
+// LinkedTruncated is set when the record is linked to more records.
+type Record struct {
+	ID              string                 `json:"id"`
+	Model           string                 `json:"model"`
+	Props           map[string]interface{} `json:"props"`
+	Linked          map[string][]Record    `json:"linked,omitempty"`
+	LinkedTruncated bool                   `json:"linkedTruncated,omitempty"`
+}
+
 type PackageMetadata struct {
 	ID     string                 `json:"id"`
 	Model  string                 `json:"model"`
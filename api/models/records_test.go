@@ -0,0 +1,36 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestToFromListPairs(t *testing.T) {
+	pairs, err := ToFromList{From: []string{"a", "b"}, To: []string{"x", "y"}}.Pairs("", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, ToFromList{From: []string{"a", "b"}, To: []string{"x", "y"}}, pairs)
+
+	_, err = ToFromList{From: []string{"a"}, To: []string{"x", "y"}}.Pairs(LinkPairwise, 10)
+	assert.IsType(t, &InvalidRecordRelationshipsError{}, err)
+
+	pairs, err = ToFromList{From: []string{"a"}, To: []string{"x", "y", "z"}}.Pairs(LinkOneToMany, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, ToFromList{From: []string{"a", "a", "a"}, To: []string{"x", "y", "z"}}, pairs)
+
+	_, err = ToFromList{From: []string{"a", "b"}, To: []string{"x"}}.Pairs(LinkOneToMany, 10)
+	assert.EqualError(t, err, "Invalid record relationships: one_to_many requires a single from record")
+
+	pairs, err = ToFromList{From: []string{"a", "b"}, To: []string{"x"}}.Pairs(LinkManyToOne, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, ToFromList{From: []string{"a", "b"}, To: []string{"x", "x"}}, pairs)
+
+	pairs, err = ToFromList{From: []string{"a", "b"}, To: []string{"x", "y"}}.Pairs(LinkCrossProduct, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, ToFromList{From: []string{"a", "a", "b", "b"}, To: []string{"x", "y", "x", "y"}}, pairs)
+
+	_, err = ToFromList{From: []string{"a", "b", "c"}, To: []string{"x", "y"}}.Pairs(LinkCrossProduct, 5)
+	assert.Equal(t, &TooManyRecordRelationshipsError{Count: 6, Max: 5}, err)
+
+	_, err = ToFromList{From: []string{"a"}, To: []string{"x"}}.Pairs("zip", 10)
+	assert.EqualError(t, err, "Invalid record relationships: unsupported mode: zip")
+}
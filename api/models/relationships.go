@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+const (
+	// OneToOne relates a record of the From model to at most one record of the To model, which is related to at most
+	// one record of the From model.
+	OneToOne = "1:1"
+	// OneToMany relates a record of the From model to any number of records of the To model, which are related to at
+	// most one record of the From model.
+	OneToMany = "1:N"
+	// ManyToMany relates records of the models without constraints.
+	ManyToMany = "N:M"
+)
+
+// ModelRelationship is a relationship between two models in a dataset. Records of the models are related by
+// relationships of the same type, within the constraints of the cardinality of the model relationship.
+type ModelRelationship struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	DisplayName string    `json:"displayName"`
+	From        string    `json:"from"`
+	To          string    `json:"to"`
+	Cardinality string    `json:"cardinality"`
+	CreatedAt   time.Time `json:"createdAt"`
+	CreatedBy   string    `json:"createdBy"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	UpdatedBy   string    `json:"updatedBy"`
+}
+
+// CreateModelRelationshipRequestBody relates the From model to the To model, which are model ids or names. The
+// display name defaults to the type, and the cardinality to ManyToMany.
+type CreateModelRelationshipRequestBody struct {
+	Type        string `json:"type"`
+	DisplayName string `json:"displayName"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Cardinality string `json:"cardinality"`
+}
+
+// UpdateModelRelationshipRequestBody renames a model relationship.
+type UpdateModelRelationshipRequestBody struct {
+	DisplayName string `json:"displayName"`
+}
+
+// CardinalityViolation is a pair of records in a request to relate records that cannot be related within the
+// cardinality of the model relationship. Index is the position of the pair in the pairs that the mode of the
+// request relates, see ToFromList.Pairs.
+type CardinalityViolation struct {
+	Index  int    `json:"index"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Reason string `json:"reason"`
+}
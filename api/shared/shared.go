@@ -3,6 +3,7 @@ package shared
 import (
 	"github.com/google/uuid"
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j/db"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j/dbtype"
 	"github.com/pennsieve/model-service-serverless/api/models"
 	"time"
 )
@@ -56,6 +57,21 @@ func ParseRecordRelationshipResponse(record *db.Record, relType string) models.S
 	return m
 }
 
+// ParseRecordNode returns a Record for a Record node and removes internal properties from the values.
+func ParseRecordNode(node dbtype.Node, modelName string) models.Record {
+	id := StringOrEmpty(node.Props["@id"])
+
+	// Delete internal properties from map
+	delete(node.Props, "@id")
+	delete(node.Props, "@sort_key")
+
+	return models.Record{
+		ID:    id,
+		Model: modelName,
+		Props: node.Props,
+	}
+}
+
 func StringOrEmpty(v interface{}) string {
 	if v != nil {
 		return v.(string)
@@ -81,14 +97,21 @@ func ParseModelPropertyResponse(record *db.Record) models.ModelProperty {
 		valueMap[k] = values[i]
 	}
 
+	isModelTitle, _ := valueMap["model_title"].(bool)
+	index, _ := valueMap["index"].(int64)
+
+	// Properties with an unknown data type are treated as String properties.
+	dataType, _ := models.ParseDataType(StringOrEmpty(valueMap["data_type"]))
+
 	p := models.ModelProperty{
 		ID:           StringOrEmpty(valueMap["id"]),
-		DataType:     valueMap["data_type"],
-		DefaultValue: valueMap["default_value"],
+		DataType:     dataType,
+		DefaultValue: valueMap["default"],
 		DisplayName:  StringOrEmpty(valueMap["display_name"]),
+		Description:  StringOrEmpty(valueMap["description"]),
 		Name:         StringOrEmpty(valueMap["name"]),
-		IsModelTitle: valueMap["model_title"].(bool),
-		Index:        valueMap["index"].(int64),
+		IsModelTitle: isModelTitle,
+		Index:        index,
 	}
 	return p
 }
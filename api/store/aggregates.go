@@ -0,0 +1,111 @@
+package store
+
+import (
+	"fmt"
+	"github.com/pennsieve/model-service-serverless/api/models"
+	"github.com/pennsieve/model-service-serverless/api/models/query"
+	"github.com/pennsieve/model-service-serverless/api/shared"
+	"strings"
+)
+
+// aggregateColumns validates the functions and properties of an aggregate against the properties of the models,
+// and returns the group-by and aggregation columns of the response. References must have a model, see
+// query.Aggregate.WithModel.
+func aggregateColumns(agg query.Aggregate, modelProps map[string][]models.ModelProperty) ([]query.AggregateColumn,
+	[]query.AggregateColumn, error) {
+
+	if len(agg.Aggregations) == 0 {
+		return nil, nil, &models.InvalidAggregateError{Reason: "at least one aggregation is required"}
+	}
+
+	var groupBy []query.AggregateColumn
+	for _, g := range agg.GroupBy {
+		prop, err := findProperty(modelProps, g.Model, g.Property)
+		if err != nil {
+			return nil, nil, err
+		}
+		groupBy = append(groupBy, query.AggregateColumn{Model: g.Model, Property: g.Property, DataType: prop.DataType})
+	}
+
+	var aggregations []query.AggregateColumn
+	for _, a := range agg.Aggregations {
+		fn, found := query.StringToAggregateFunctionDict[strings.ToLower(a.Function)]
+		if !found {
+			return nil, nil, &models.InvalidAggregateError{Reason: fmt.Sprintf("unsupported function: %s", a.Function)}
+		}
+
+		column := query.AggregateColumn{Model: a.Model, Property: a.Property, Function: fn.String()}
+		if a.Property == "" {
+			if fn != query.AGG_COUNT {
+				return nil, nil, &models.InvalidAggregateError{Reason: fmt.Sprintf("%s requires a property", fn)}
+			}
+			if _, found := modelProps[a.Model]; !found {
+				return nil, nil, &models.UnknownModelError{Model: a.Model}
+			}
+			column.DataType = fn.ResultType(models.DataType{})
+		} else {
+			prop, err := findProperty(modelProps, a.Model, a.Property)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !fn.AppliesTo(prop.DataType) {
+				return nil, nil, &models.InvalidAggregateError{
+					Reason: fmt.Sprintf("%s does not apply to %s property %s", fn, prop.DataType.Type, prop.Name)}
+			}
+			column.DataType = fn.ResultType(prop.DataType)
+		}
+		aggregations = append(aggregations, column)
+	}
+
+	return groupBy, aggregations, nil
+}
+
+// compileAggregate writes the projection of an aggregate query on the MATCH clauses that generateQuery builds. Records
+// that are not related to records of an optionally matched model are grouped by null values. The matched rows are first reduced to the distinct combinations of records of the referenced models, so records are
+// not counted once per path to a related record. Group-by values are returned as g0, g1, ... and the results of
+// the aggregations as a0, a1, ...
+func compileAggregate(b *cypherBuilder, sourceModel models.Model, agg query.Aggregate,
+	modelProps map[string][]models.ModelProperty, limit int, offset int) error {
+
+	if _, _, err := aggregateColumns(agg, modelProps); err != nil {
+		return err
+	}
+
+	variables := []string{identifier(sourceModel.Name)}
+	for _, name := range agg.Models() {
+		if v := identifier(name); !shared.StringInSlice(v, variables) {
+			variables = append(variables, v)
+		}
+	}
+	b.write("WITH DISTINCT ", strings.Join(variables, ", "), " ")
+
+	var projections, keys []string
+	for i, g := range agg.GroupBy {
+		key := fmt.Sprintf("g%d", i)
+		projections = append(projections, fmt.Sprintf("%s.%s AS %s", identifier(g.Model), identifier(g.Property), key))
+		keys = append(keys, key)
+	}
+
+	for i, a := range agg.Aggregations {
+		fn := query.StringToAggregateFunctionDict[strings.ToLower(a.Function)]
+
+		var expr string
+		switch {
+		case a.Property == "":
+			expr = fmt.Sprintf("count(DISTINCT %s)", identifier(a.Model))
+		case fn == query.AGG_COUNT_DISTINCT:
+			expr = fmt.Sprintf("count(DISTINCT %s.%s)", identifier(a.Model), identifier(a.Property))
+		default:
+			// The names of the other functions are Cypher functions
+			expr = fmt.Sprintf("%s(%s.%s)", fn, identifier(a.Model), identifier(a.Property))
+		}
+		projections = append(projections, fmt.Sprintf("%s AS a%d", expr, i))
+	}
+
+	b.write("RETURN ", strings.Join(projections, ", "))
+	if len(keys) > 0 {
+		b.write(" ORDER BY ", strings.Join(keys, ", "), " SKIP ", b.param(offset), " LIMIT ", b.param(limit))
+	}
+
+	return nil
+}
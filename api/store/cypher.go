@@ -0,0 +1,49 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+)
+
+// cypherBuilder builds a Cypher query together with its parameters. Values are never written into the query text;
+// they are added as parameters, and names are written as backtick-escaped identifiers.
+type cypherBuilder struct {
+	cql    strings.Builder
+	params map[string]interface{}
+}
+
+func newCypherBuilder() *cypherBuilder {
+	return &cypherBuilder{
+		params: make(map[string]interface{}),
+	}
+}
+
+// write appends fragments of the query. Fragments must not contain user input; use param and identifier instead.
+func (b *cypherBuilder) write(fragments ...string) {
+	for _, f := range fragments {
+		b.cql.WriteString(f)
+	}
+}
+
+// param adds a value as a parameter of the query and returns its placeholder.
+func (b *cypherBuilder) param(value interface{}) string {
+	name := fmt.Sprintf("p%d", len(b.params))
+	b.params[name] = value
+	return "$" + name
+}
+
+// String returns the query.
+func (b *cypherBuilder) String() string {
+	return b.cql.String()
+}
+
+// Params returns the parameters of the query.
+func (b *cypherBuilder) Params() map[string]interface{} {
+	return b.params
+}
+
+// identifier returns a name as a Cypher identifier, enclosed in backticks. Backticks in the name are escaped by
+// doubling them, so the name cannot end the identifier.
+func identifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"github.com/pennsieve/model-service-serverless/api/models"
+	"github.com/pennsieve/model-service-serverless/api/models/query"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"testing"
+)
+
+var fuzzModelProps = map[string][]models.ModelProperty{
+	"patient": {
+		{Name: "name", DataType: models.DataType{Type: models.STRING}, IsModelTitle: true},
+		{Name: "age", DataType: models.DataType{Type: models.LONG}},
+	},
+	"samples": {
+		{Name: "tags", DataType: models.DataType{Type: models.STRING, IsArray: true}},
+	},
+}
+
+// FuzzGenerateQuery checks that names in filters only reach the query when they are in the model schema, and that
+// filter values and autocomplete text are only passed as parameters.
+func FuzzGenerateQuery(f *testing.F) {
+	f.Add("patient", "name", "STARTS WITH", "LIM031", "LIM")
+	f.Add("patient", "name", "=", "' OR 1=1 WITH 1 AS x MATCH (n) DETACH DELETE n //", "x') DETACH DELETE (n")
+	f.Add("patient", "name` = 1 OR `name", "=", "x", ".*")
+	f.Add("patient", "age", "= 1 OR 1 =", "1", "(?i)")
+	f.Add("patient) MATCH (n) DETACH DELETE (n", "name", "=", "x", "x")
+	f.Add("patient", "age", ">=", "60", "$p0")
+	f.Add("samples", "tags", "CONTAINS", "`}) RETURN 1 //", "\\' \"")
+
+	sourceModel := models.Model{ID: "43f44351-7d80-454b-9d11-6ecc0c158559", Name: "patient"}
+
+	f.Fuzz(func(t *testing.T, model string, property string, operator string, value string, text string) {
+		generate := func(value string, text string) (string, map[string]interface{}, error) {
+			where := &query.FilterGroup{
+				Filters: query.Filters{Model: model, Property: property, Operator: operator, Value: value}}
+			params := query.FormatParams{
+				ResultType:         query.AUTOCOMPLETE,
+				AutoCompleteParams: query.AutoCompleteParams{PropName: "name", Text: text},
+			}
+			return generateQuery(sourceModel, nil, nil, where, fuzzModelProps, nil, params, 20, 0)
+		}
+
+		cql, params, err := generate(value, text)
+		if err != nil {
+			switch err.(type) {
+			case *models.UnknownModelError, *models.UnknownModelPropertyError, *models.UnsupportedOperatorError,
+				*models.InvalidFilterError:
+			default:
+				t.Fatalf("unexpected error: %v", err)
+			}
+			return
+		}
+
+		_, knownModel := fuzzModelProps[model]
+		assert.True(t, knownModel, "unknown model in query: %q", model)
+		assert.True(t, hasProperty(fuzzModelProps[model], property), "unknown property in query: %q", property)
+		assert.True(t, validOperator(operator), "unsupported operator in query: %q", operator)
+
+		// "1" is a valid value for all properties in the schema
+		expected, _, err := generate("1", "")
+		assert.NoError(t, err)
+		assert.Equal(t, expected, cql)
+		assert.Equal(t, "(?i).*"+regexp.QuoteMeta(text)+".*", params["p2"])
+		for _, p := range fuzzModelProps[model] {
+			if p.Name == property && p.DataType.Type == models.STRING {
+				assert.Equal(t, value, params["p1"])
+			}
+		}
+	})
+}
@@ -0,0 +1,38 @@
+package store
+
+import (
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j/dbtype"
+	"github.com/pennsieve/model-service-serverless/api/models/query"
+	"github.com/pennsieve/model-service-serverless/api/shared"
+)
+
+// modelPaths returns the names of the models and the types of the relationships in the shortest paths between
+// models.
+func modelPaths(paths []dbtype.Path) []query.ModelPath {
+	result := []query.ModelPath{}
+	for _, p := range paths {
+		path := query.ModelPath{Models: []string{}, Relationships: []string{}}
+		for _, n := range p.Nodes {
+			path.Models = append(path.Models, nodeName(n))
+		}
+		for _, r := range p.Relationships {
+			path.Relationships = append(path.Relationships, shared.StringOrEmpty(r.Props["type"]))
+		}
+		result = append(result, path)
+	}
+	return result
+}
+
+// explainPlan returns the execution plan that Neo4j returns for an EXPLAIN query.
+func explainPlan(p neo4j.Plan) query.Plan {
+	plan := query.Plan{
+		Operator:    p.Operator(),
+		Arguments:   p.Arguments(),
+		Identifiers: p.Identifiers(),
+	}
+	for _, c := range p.Children() {
+		plan.Children = append(plan.Children, explainPlan(c))
+	}
+	return plan
+}
@@ -0,0 +1,74 @@
+package store
+
+import (
+	"github.com/pennsieve/model-service-serverless/api/models"
+	"github.com/pennsieve/model-service-serverless/api/models/query"
+)
+
+// withoutPropertyFilters returns the filter tree without the conditions that only filter on the referenced
+// property. Only conditions that all other conditions must match are removed, i.e. the top-level conditions and
+// the conditions of nested AND groups. It returns nil when no conditions remain.
+func withoutPropertyFilters(g *query.FilterGroup, ref query.PropertyRef) *query.FilterGroup {
+	if g == nil {
+		return nil
+	}
+
+	onProperty := true
+	for _, f := range g.Leaves() {
+		onProperty = onProperty && f.Model == ref.Model && f.Property == ref.Property
+	}
+	if onProperty {
+		return nil
+	}
+
+	if g.And == nil {
+		return g
+	}
+
+	var children []query.FilterGroup
+	for i := range g.And {
+		if c := withoutPropertyFilters(&g.And[i], ref); c != nil {
+			children = append(children, *c)
+		}
+	}
+
+	switch len(children) {
+	case 0:
+		return nil
+	case 1:
+		return &children[0]
+	}
+	return &query.FilterGroup{And: children}
+}
+
+// compileFacet writes the projection of a facet query on the MATCH clause that generateQuery builds. It counts the
+// distinct records of the source model per value of the property, and returns the most frequent values as value
+// and count.
+func compileFacet(b *cypherBuilder, sourceModel models.Model, facet query.Facet,
+	modelProps map[string][]models.ModelProperty) error {
+
+	prop, err := findProperty(modelProps, facet.Model, facet.Property)
+	if err != nil {
+		return err
+	}
+
+	source := identifier(sourceModel.Name)
+	field := identifier(facet.Model) + "." + identifier(prop.Name)
+
+	// Records are bound to the name of their model, and model names cannot start with "@".
+	b.write("WITH DISTINCT ", source)
+	if facet.Model != sourceModel.Name {
+		b.write(", ", identifier(facet.Model))
+	}
+	b.write(" ")
+	if prop.DataType.IsArray {
+		b.write("UNWIND ", field, " AS `@value` WITH ", source, ", `@value` ")
+	} else {
+		b.write("WITH ", source, ", ", field, " AS `@value` ")
+	}
+	b.write("WHERE `@value` IS NOT NULL ",
+		"RETURN `@value` AS value, count(DISTINCT ", source, ") AS count ",
+		"ORDER BY count DESC, value LIMIT ", b.param(facet.Limit()))
+
+	return nil
+}
@@ -0,0 +1,250 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j/dbtype"
+	"github.com/pennsieve/model-service-serverless/api/models"
+	"github.com/pennsieve/model-service-serverless/api/models/query"
+	"strings"
+)
+
+// combineFilters returns the flat filters and the filter tree of a request as a single filter tree in which all
+// flat filters and the tree must match. It returns nil when the request has no filters.
+func combineFilters(filters []query.Filters, where *query.FilterGroup) *query.FilterGroup {
+	var groups []query.FilterGroup
+	for _, f := range filters {
+		groups = append(groups, query.FilterGroup{Filters: f})
+	}
+	if where != nil {
+		groups = append(groups, *where)
+	}
+
+	switch len(groups) {
+	case 0:
+		return nil
+	case 1:
+		return &groups[0]
+	}
+	return &query.FilterGroup{And: groups}
+}
+
+// getFilterModelProps returns the properties by model name of the source model, of the models in a filter tree and
+// of any other models in the query, against which generateQuery validates the names in the query. The properties of
+// all models are fetched in a single query.
+func getFilterModelProps(ctx context.Context, q *NeoQueries, datasetId int, organizationId int, sourceModel models.Model,
+	where *query.FilterGroup, otherModels ...string) (map[string][]models.ModelProperty, error) {
+
+	names := []string{sourceModel.Name}
+	for _, f := range where.Leaves() {
+		names = append(names, f.Model)
+	}
+	names = append(names, otherModels...)
+
+	modelProps, err := q.GetModelsProps(ctx, datasetId, organizationId, names)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if _, exists := modelProps[name]; !exists {
+			modelProps[name] = nil
+		}
+	}
+
+	return modelProps, nil
+}
+
+// compileFilterGroup writes a filter tree as a Cypher condition on the MATCH clause that generateQuery builds, in
+// which records are bound to the name of their model. Every group is enclosed in parentheses so the condition can
+// be combined with other conditions, and values are added as parameters. modelProps contains the properties of the
+// models in the tree by model name.
+func compileFilterGroup(b *cypherBuilder, g query.FilterGroup, modelProps map[string][]models.ModelProperty) (string, error) {
+	nrSet := 0
+	for _, isSet := range []bool{g.And != nil, g.Or != nil, g.Not != nil, !g.Filters.IsZero()} {
+		if isSet {
+			nrSet++
+		}
+	}
+	if nrSet != 1 {
+		return "", &models.InvalidFilterError{Reason: "a filter group must contain exactly one of and, or, not or a filter"}
+	}
+
+	switch {
+	case g.And != nil, g.Or != nil:
+		children, combinator := g.And, " AND "
+		if g.Or != nil {
+			children, combinator = g.Or, " OR "
+		}
+		if len(children) == 0 {
+			return "", &models.InvalidFilterError{Reason: "and and or require at least one filter"}
+		}
+
+		var conditions []string
+		for _, c := range children {
+			condition, err := compileFilterGroup(b, c, modelProps)
+			if err != nil {
+				return "", err
+			}
+			conditions = append(conditions, condition)
+		}
+		return "(" + strings.Join(conditions, combinator) + ")", nil
+	case g.Not != nil:
+		condition, err := compileFilterGroup(b, *g.Not, modelProps)
+		if err != nil {
+			return "", err
+		}
+		return "(NOT " + condition + ")", nil
+	}
+
+	return compileFilter(b, g.Filters, modelProps)
+}
+
+// compileFilter returns a single filter as a Cypher condition. The value is converted to the data type of the
+// property, and filters on array properties match when any item matches.
+func compileFilter(b *cypherBuilder, f query.Filters, modelProps map[string][]models.ModelProperty) (string, error) {
+	prop, err := findProperty(modelProps, f.Model, f.Property)
+	if err != nil {
+		return "", err
+	}
+
+	op, found := models.ParseOperator(f.Operator)
+	if !found {
+		return "", &models.UnsupportedOperatorError{Operator: f.Operator}
+	}
+
+	value, err := filterValue(f, op, *prop)
+	if err != nil {
+		return "", err
+	}
+
+	// Filters on array properties match when any item matches, unless a list is compared with the whole array.
+	field := identifier(f.Model) + "." + identifier(prop.Name)
+	_, isList := value.([]interface{})
+	if prop.DataType.IsArray && op.TakesValue() && (op.TakesList() || !isList) {
+		quantifier := "ANY"
+		if op == models.NOT_IN {
+			quantifier = "NONE"
+		}
+		return fmt.Sprintf("%s(v IN %s WHERE %s)", quantifier, field, compilePredicate(b, "v", op, value)), nil
+	}
+
+	if op == models.NOT_IN {
+		return fmt.Sprintf("(NOT (%s))", compilePredicate(b, field, op, value)), nil
+	}
+	return "(" + compilePredicate(b, field, op, value) + ")", nil
+}
+
+// compilePredicate returns the comparison of an expression with the value of a filter, and adds the value as a
+// parameter. NOT_IN is compiled as IN, and must be negated by the caller.
+func compilePredicate(b *cypherBuilder, expr string, op models.Operator, value interface{}) string {
+	switch {
+	case !op.TakesValue():
+		return fmt.Sprintf("%s %s", expr, op.Cypher())
+	case op == models.BETWEEN:
+		bounds := value.([]interface{})
+		return fmt.Sprintf("%s >= %s AND %s <= %s", expr, b.param(bounds[0]), expr, b.param(bounds[1]))
+	case op.IgnoresCase():
+		return fmt.Sprintf("toLower(%s) %s %s", expr, op.Cypher(), b.param(strings.ToLower(value.(string))))
+	}
+	return fmt.Sprintf("%s %s %s", expr, op.Cypher(), b.param(value))
+}
+
+// filterValue converts the value of a filter to the data type of the property. IN, NOT_IN and BETWEEN take a list
+// of values, and a list value for EQUALS or NOT_EQUALS is compared with an array property as a whole.
+func filterValue(f query.Filters, op models.Operator, prop models.ModelProperty) (interface{}, error) {
+	invalid := func(err error) error {
+		return &models.InvalidFilterError{Reason: fmt.Sprintf("%s.%s: %v", f.Model, f.Property, err)}
+	}
+
+	dataType := models.DataType{Type: prop.DataType.Type}
+	items, isList := f.Value.([]interface{})
+
+	switch {
+	case !op.TakesValue():
+		return nil, nil
+	case op.IsStringOperator() && dataType.Type != models.STRING:
+		return nil, &models.UnsupportedOperatorError{
+			Operator: fmt.Sprintf("%s for %s property %s", op, dataType.Type, prop.Name)}
+	case op.TakesList():
+		if !isList {
+			return nil, invalid(fmt.Errorf("%s requires an array of %s values", op, dataType.Type))
+		}
+		if op == models.BETWEEN && len(items) != 2 {
+			return nil, invalid(fmt.Errorf("BETWEEN requires an array of two %s values", dataType.Type))
+		}
+
+		values := make([]interface{}, len(items))
+		for i, item := range items {
+			v, err := coerceFilterValue(dataType, item)
+			if err != nil {
+				return nil, invalid(fmt.Errorf("item %d: %v", i, err))
+			}
+			values[i] = v
+		}
+		return values, nil
+	case isList:
+		if !prop.DataType.IsArray {
+			return nil, invalid(fmt.Errorf("expected %s, got array", dataType.Type))
+		}
+		if op.Cypher() != "=" && op.Cypher() != "<>" || op.IgnoresCase() {
+			return nil, &models.UnsupportedOperatorError{Operator: fmt.Sprintf("%s for array value", op)}
+		}
+		dataType.IsArray = true
+	}
+
+	value, err := coerceFilterValue(dataType, f.Value)
+	if err != nil {
+		return nil, invalid(err)
+	}
+	return value, nil
+}
+
+// coerceFilterValue converts a value to the data type. Strings are parsed for properties of other types, as legacy
+// clients send all values as strings.
+func coerceFilterValue(dataType models.DataType, value interface{}) (interface{}, error) {
+	if s, isString := value.(string); isString && dataType.Type != models.STRING {
+		value, err := dataType.ParseString(s)
+		if err != nil || value != nil {
+			return value, err
+		}
+	} else if value != nil {
+		return dataType.Coerce(value)
+	}
+
+	return nil, errors.New("value is required")
+}
+
+// findProperty returns a property of a model from the properties by model name.
+func findProperty(modelProps map[string][]models.ModelProperty, model string, property string) (*models.ModelProperty, error) {
+	props, found := modelProps[model]
+	if !found {
+		return nil, &models.UnknownModelError{Model: model}
+	}
+
+	for i := range props {
+		if props[i].Name == property {
+			return &props[i], nil
+		}
+	}
+	return nil, &models.UnknownModelPropertyError{PropName: property}
+}
+
+// checkFilterModelsRelated returns an error when a model that is filtered on is not in any of the shortest paths
+// from the source model, as its records cannot be matched.
+func checkFilterModelsRelated(sourceModel models.Model, targetModels map[string]string, paths []dbtype.Path) error {
+	for name := range targetModels {
+		related := false
+		for _, p := range paths {
+			for _, n := range p.Nodes {
+				related = related || n.Props["name"] == name
+			}
+		}
+
+		if !related {
+			return &models.InvalidFilterError{Reason: fmt.Sprintf("model %s is not related to model %s", name, sourceModel.Name)}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package store
+
+import (
+	"context"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j/dbtype"
+	"github.com/pennsieve/model-service-serverless/api/models"
+	"github.com/pennsieve/model-service-serverless/api/models/labels"
+	"github.com/pennsieve/model-service-serverless/api/shared"
+	"time"
+)
+
+// recordPackageReturn returns a proxy relationship as e, which parseRecordPackage parses.
+const recordPackageReturn = "RETURN e, r.`@id` AS record, p.package_id AS package_id, " +
+	"p.package_node_id AS package_node_id"
+
+// LinkRecordPackage attaches a record in a dataset to a package with a proxy relationship. The package node is
+// created when no record is attached to the package yet, and a package node that exists is reused, so all records
+// of a package are attached to a single node. Package nodes are matched by package node id, as package ids are only
+// unique within an organization. Attaching a record again only sets the user as the last updater.
+func (q *NeoQueries) LinkRecordPackage(ctx context.Context, datasetId int, organizationId int, recordId string,
+	pkg models.Package, userId string) (*models.RecordPackage, error) {
+
+	// The type of a relationship cannot be a parameter, and is written as an identifier.
+	cql := "MATCH (r:Record{`@id`: $recordId})-[:`@INSTANCE_OF`]->(:Model)-[:`@IN_DATASET`]->" +
+		"(ds:Dataset{id: $datasetId})-[:`@IN_ORGANIZATION`]->(:Organization{id: $organizationId}) " +
+		"MERGE (p:Package{package_node_id: $packageNodeId}) " +
+		"ON CREATE SET p.package_id = $packageId " +
+		"MERGE (p)-[:`@IN_DATASET`]->(ds) " +
+		"MERGE (r)-[e:" + identifier(labels.PROXY_RELATIONSHIP_TYPE) + "]->(p) " +
+		"ON CREATE SET e.id = randomUUID(), e.created_by = $userId, e.created_at = datetime(), " +
+		"e.updated_by = $userId, e.updated_at = datetime() " +
+		"ON MATCH SET e.updated_by = $userId, e.updated_at = datetime() " +
+		recordPackageReturn
+
+	params := map[string]interface{}{
+		"recordId":       recordId,
+		"datasetId":      datasetId,
+		"organizationId": organizationId,
+		"packageId":      pkg.ID,
+		"packageNodeId":  pkg.NodeID,
+		"userId":         userId,
+	}
+
+	result, err := q.db.Run(ctx, cql, params)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := result.Collect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, &models.UnknownRecordError{ID: recordId}
+	}
+
+	rp := parseRecordPackage(records[0])
+	return &rp, nil
+}
+
+// UnlinkRecordPackage removes the proxy relationship between a record in a dataset and a package. The package node is
+// kept, as other records can be attached to the package.
+func (q *NeoQueries) UnlinkRecordPackage(ctx context.Context, datasetId int, organizationId int, recordId string,
+	pkg models.Package) error {
+
+	cql := matchDatasetRecord +
+		"MATCH (r)-[e:" + identifier(labels.PROXY_RELATIONSHIP_TYPE) + "]->(p:Package{package_node_id: $packageNodeId})" +
+		"-[:`@IN_DATASET`]->(:Dataset{id: $datasetId}) " +
+		"DELETE e " +
+		"RETURN count(e) AS count"
+
+	params := map[string]interface{}{
+		"recordId":       recordId,
+		"datasetId":      datasetId,
+		"organizationId": organizationId,
+		"packageNodeId":  pkg.NodeID,
+	}
+
+	cnt, err := q.deleteCount(ctx, cql, params)
+	if err != nil {
+		return err
+	}
+	if cnt == 0 {
+		return &models.UnknownRecordPackageError{RecordID: recordId, PackageNodeID: pkg.NodeID}
+	}
+
+	return nil
+}
+
+// parseRecordPackage returns the proxy relationship in a record that is returned by recordPackageReturn.
+func parseRecordPackage(rec *neo4j.Record) models.RecordPackage {
+	e, _ := rec.Get("e")
+	props := e.(dbtype.Relationship).Props
+
+	recordId, _ := rec.Get("record")
+	packageId, _ := rec.Get("package_id")
+	packageNodeId, _ := rec.Get("package_node_id")
+
+	rp := models.RecordPackage{
+		ID:            shared.StringOrEmpty(props["id"]),
+		RecordID:      shared.StringOrEmpty(recordId),
+		PackageNodeID: shared.StringOrEmpty(packageNodeId),
+		CreatedBy:     shared.StringOrEmpty(props["created_by"]),
+		UpdatedBy:     shared.StringOrEmpty(props["updated_by"]),
+	}
+	rp.PackageID, _ = packageId.(int64)
+	rp.CreatedAt, _ = props["created_at"].(time.Time)
+	rp.UpdatedAt, _ = props["updated_at"].(time.Time)
+
+	return rp
+}
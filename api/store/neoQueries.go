@@ -7,15 +7,19 @@ import (
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j/dbtype"
 	"github.com/pennsieve/model-service-serverless/api/models"
+	"github.com/pennsieve/model-service-serverless/api/models/labels"
 	"github.com/pennsieve/model-service-serverless/api/models/query"
 	"github.com/pennsieve/model-service-serverless/api/shared"
 	log "github.com/sirupsen/logrus"
 	"regexp"
-	"strconv"
+	"sort"
 	"strings"
 	"time"
 )
 
+// reservedPropertyNames contains internal properties of records that cannot be used as model properties.
+var reservedPropertyNames = []string{"@id", "@sort_key", "@max_sort_key"}
+
 // DB interface for queries which has methods that are both available in db connection and in transaction.
 type DB interface {
 	Run(ctx context.Context, cypher string, params map[string]any) (neo4j.ResultWithContext, error)
@@ -33,8 +37,8 @@ func NewNeoQueries(db DB) *NeoQueries {
 
 func (q *NeoQueries) GetModelByName(ctx context.Context, modelName string, datasetId int) (*models.Model, error) {
 
-	cql := fmt.Sprintf("MATCH  (m:Model{name:'%s'})", modelName) +
-		fmt.Sprintf("-[:`@IN_DATASET`]->(:Dataset { id: %d }) ", datasetId) +
+	cql := "MATCH  (m:Model{name: $modelName})" +
+		"-[:`@IN_DATASET`]->(:Dataset { id: $datasetId }) " +
 		"MATCH (m)-[created:`@CREATED_BY`]->(c:User)" +
 		"MATCH (m)-[updated:`@UPDATED_BY`]->(u:User)" +
 		"OPTIONAL MATCH (m)-[r:`@RELATED_TO`]->(n) WHERE r.index IS NOT NULL " +
@@ -43,7 +47,12 @@ func (q *NeoQueries) GetModelByName(ctx context.Context, modelName string, datas
 		"	size((m)-[:`@HAS_PROPERTY`]->()) AS nrStaticProps, count((m)--(n)) AS nrLinkedProps," +
 		"	c.node_id AS created_by, u.node_id AS updated_by, created.at AS created_at, updated.at AS updated_at"
 
-	result, err := q.db.Run(ctx, cql, nil)
+	params := map[string]interface{}{
+		"modelName": modelName,
+		"datasetId": datasetId,
+	}
+
+	result, err := q.db.Run(ctx, cql, params)
 	if err != nil {
 		return nil, err
 	}
@@ -59,6 +68,132 @@ func (q *NeoQueries) GetModelByName(ctx context.Context, modelName string, datas
 
 }
 
+// GetModelById returns a model in a dataset by its id.
+func (q *NeoQueries) GetModelById(ctx context.Context, datasetId int, organizationId int, modelId string) (*models.Model, error) {
+
+	cql := "MATCH (m:Model{id: $modelId})-[:`@IN_DATASET`]->(:Dataset{id: $datasetId})" +
+		"-[:`@IN_ORGANIZATION`]->(:Organization{id: $organizationId}) " +
+		"MATCH (m)-[created:`@CREATED_BY`]->(c:User) " +
+		"MATCH (m)-[updated:`@UPDATED_BY`]->(u:User) " +
+		"OPTIONAL MATCH (m)-[r:`@RELATED_TO`]->(n) WHERE r.index IS NOT NULL " +
+		"RETURN m.name AS name, m.description AS description, m.id AS id, m.display_name AS display_name," +
+		"	size(()-[:`@INSTANCE_OF`]->(m)) AS count," +
+		"	size((m)-[:`@HAS_PROPERTY`]->()) AS nrStaticProps, count((m)--(n)) AS nrLinkedProps," +
+		"	c.node_id AS created_by, u.node_id AS updated_by, created.at AS created_at, updated.at AS updated_at"
+
+	params := map[string]interface{}{
+		"modelId":        modelId,
+		"datasetId":      datasetId,
+		"organizationId": organizationId,
+	}
+
+	result, err := q.db.Run(ctx, cql, params)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := result.Collect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, &models.UnknownModelError{Model: modelId}
+	}
+
+	m := shared.ParseModelResponse(records[0])
+	return &m, nil
+}
+
+// UpdateModel updates the display name and description of a model and sets the user as the last updater.
+// Nil values for displayName or description leave the existing value unchanged.
+func (q *NeoQueries) UpdateModel(ctx context.Context, datasetId int, organizationId int, modelId string,
+	displayName *string, description *string, userId string) (*models.Model, error) {
+
+	cql := "MATCH (m:Model{id: $modelId})-[:`@IN_DATASET`]->(:Dataset{id: $datasetId})" +
+		"-[:`@IN_ORGANIZATION`]->(:Organization{id: $organizationId}) " +
+		"MERGE (u:User{node_id: $userId}) " +
+		"WITH m, u " +
+		"OPTIONAL MATCH (m)-[updated:`@UPDATED_BY`]->(:User) " +
+		"DELETE updated " +
+		"WITH DISTINCT m, u " +
+		"SET m.display_name = COALESCE($displayName, m.display_name), " +
+		"m.description = COALESCE($description, m.description) " +
+		"CREATE (m)-[:`@UPDATED_BY` {at: datetime()}]->(u) " +
+		"RETURN m.id AS id"
+
+	params := map[string]interface{}{
+		"modelId":        modelId,
+		"datasetId":      datasetId,
+		"organizationId": organizationId,
+		"userId":         userId,
+		"displayName":    displayName,
+		"description":    description,
+	}
+
+	result, err := q.db.Run(ctx, cql, params)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := result.Collect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, &models.UnknownModelError{Model: modelId}
+	}
+
+	return q.GetModelById(ctx, datasetId, organizationId, modelId)
+}
+
+// DeleteModel removes a model, its properties, and all records that are an instance of the model.
+// Relationships of the records are removed with the records. Returns the number of deleted records.
+func (q *NeoQueries) DeleteModel(ctx context.Context, datasetId int, organizationId int, modelId string) (int64, error) {
+
+	params := map[string]interface{}{
+		"modelId":        modelId,
+		"datasetId":      datasetId,
+		"organizationId": organizationId,
+	}
+
+	// Delete records and their relationships
+	cql := "MATCH (m:Model{id: $modelId})-[:`@IN_DATASET`]->(:Dataset{id: $datasetId})" +
+		"-[:`@IN_ORGANIZATION`]->(:Organization{id: $organizationId}) " +
+		"OPTIONAL MATCH (m)<-[:`@INSTANCE_OF`]-(r:Record) " +
+		"DETACH DELETE r " +
+		"RETURN count(r) AS count"
+
+	result, err := q.db.Run(ctx, cql, params)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := result.Single(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	cnt, exists := res.Get("count")
+	if !exists {
+		return 0, errors.New("count does not exist")
+	}
+
+	// Delete model properties and the model itself
+	cql = "MATCH (m:Model{id: $modelId})-[:`@IN_DATASET`]->(:Dataset{id: $datasetId})" +
+		"-[:`@IN_ORGANIZATION`]->(:Organization{id: $organizationId}) " +
+		"OPTIONAL MATCH (m)-[:`@HAS_PROPERTY`]->(p:ModelProperty) " +
+		"DETACH DELETE p " +
+		"WITH DISTINCT m " +
+		"DETACH DELETE m"
+
+	_, err = q.db.Run(ctx, cql, params)
+	if err != nil {
+		return 0, err
+	}
+
+	return cnt.(int64), nil
+}
+
 // InitOrgAndDataset ensures that the metadata database has records for the organization and dataset.
 func (q *NeoQueries) InitOrgAndDataset(ctx context.Context, organizationId int, datasetId int, organizationNodeId string, datasetNodeId string) error {
 
@@ -98,7 +233,7 @@ func (q *NeoQueries) CreateModel(ctx context.Context, datasetId int, organizatio
 	// Check if reserved model name
 	reservedModelNames := []string{"file"}
 	if shared.StringInSlice(name, reservedModelNames) {
-		return nil, errors.New(fmt.Sprintf("%s is a reserved name. Unable to create model", name))
+		return nil, &models.ReservedNameError{Name: name}
 	}
 
 	// Validate Model Name
@@ -107,14 +242,23 @@ func (q *NeoQueries) CreateModel(ctx context.Context, datasetId int, organizatio
 		return nil, err
 	}
 
+	params := map[string]interface{}{
+		"name":           name,
+		"displayName":    displayName,
+		"description":    description,
+		"datasetId":      datasetId,
+		"organizationId": organizationId,
+		"userId":         userId,
+	}
+
 	// Check if model with name already exist in dataset
 	var cql strings.Builder
-	cql.WriteString(fmt.Sprintf("MATCH (m:Model{name: '%s'})", name))
-	cql.WriteString(fmt.Sprintf("-[`@IN_DATASET`]->(:Dataset{id:%d})", datasetId))
-	cql.WriteString(fmt.Sprintf("-[`@IN_ORGANIZATION`]->(:Organization{id:%d})", organizationId))
+	cql.WriteString("MATCH (m:Model{name: $name})")
+	cql.WriteString("-[`@IN_DATASET`]->(:Dataset{id: $datasetId})")
+	cql.WriteString("-[`@IN_ORGANIZATION`]->(:Organization{id: $organizationId})")
 	cql.WriteString("RETURN COUNT(m) AS count")
 
-	result, err := q.db.Run(ctx, cql.String(), nil)
+	result, err := q.db.Run(ctx, cql.String(), params)
 	if err != nil {
 		return nil, err
 	}
@@ -137,15 +281,15 @@ func (q *NeoQueries) CreateModel(ctx context.Context, datasetId int, organizatio
 	cql.Reset()
 
 	// MATCHING
-	cql.WriteString(fmt.Sprintf("MATCH (d:Dataset{id: %d})-[:`@IN_ORGANIZATION`]->(Organization{id: %d}) ", datasetId, organizationId))
-	cql.WriteString(fmt.Sprintf("MERGE (u:User{node_id:'%s'}) ", userId))
-	cql.WriteString(fmt.Sprintf("CREATE (m:Model{`@max_sort_key`:0, id:randomUUID(),name:'%s',display_name:'%s',description:'%s'}) ", name, displayName, description))
+	cql.WriteString("MATCH (d:Dataset{id: $datasetId})-[:`@IN_ORGANIZATION`]->(Organization{id: $organizationId}) ")
+	cql.WriteString("MERGE (u:User{node_id: $userId}) ")
+	cql.WriteString("CREATE (m:Model{`@max_sort_key`:0, id:randomUUID(), name: $name, display_name: $displayName, description: $description}) ")
 	cql.WriteString("CREATE (m)-[:`@IN_DATASET`]->(d) ")
 	cql.WriteString("CREATE (m)-[created:`@CREATED_BY` {at: datetime()}]->(u) ")
 	cql.WriteString("CREATE (m)-[updated:`@UPDATED_BY` {at: datetime()}]->(u) ")
 	cql.WriteString("RETURN m, created.at AS created_at, updated.at AS updated_at")
 
-	result, err = q.db.Run(ctx, cql.String(), nil)
+	result, err = q.db.Run(ctx, cql.String(), params)
 	if err != nil {
 		return nil, err
 	}
@@ -188,8 +332,8 @@ func (q *NeoQueries) GetModels(ctx context.Context, datasetId int, organizationI
 
 	// MATCHING
 	cql.WriteString("MATCH  (m:Model)")
-	cql.WriteString(fmt.Sprintf("-[:`@IN_DATASET`]->(:Dataset { id: %d }) ", datasetId))
-	cql.WriteString(fmt.Sprintf("-[:`@IN_ORGANIZATION`]->(:Organization { id: %d }) ", organizationId))
+	cql.WriteString("-[:`@IN_DATASET`]->(:Dataset { id: $datasetId }) ")
+	cql.WriteString("-[:`@IN_ORGANIZATION`]->(:Organization { id: $organizationId }) ")
 	cql.WriteString("MATCH (m)-[created:`@CREATED_BY`]->(c:User)")
 	cql.WriteString("MATCH (m)-[updated:`@UPDATED_BY`]->(u:User)")
 	cql.WriteString("OPTIONAL MATCH (m)-[r:`@RELATED_TO`]->(n) WHERE r.index IS NOT NULL ")
@@ -200,7 +344,12 @@ func (q *NeoQueries) GetModels(ctx context.Context, datasetId int, organizationI
 	cql.WriteString("size((m)-[:`@HAS_PROPERTY`]->()) AS nrStaticProps, count((m)--(n)) AS nrLinkedProps,")
 	cql.WriteString("c.node_id AS created_by, u.node_id AS updated_by, created.at AS created_at, updated.at AS updated_at")
 
-	result, err := q.db.Run(ctx, cql.String(), nil)
+	params := map[string]interface{}{
+		"datasetId":      datasetId,
+		"organizationId": organizationId,
+	}
+
+	result, err := q.db.Run(ctx, cql.String(), params)
 	if err != nil {
 		return nil, err
 	}
@@ -226,16 +375,22 @@ func (q *NeoQueries) GetModelProps(ctx context.Context, datasetId int, organizat
 	var cql strings.Builder
 
 	// MATCHING
-	cql.WriteString(fmt.Sprintf("MATCH  (p:ModelProperty)<-[:`@HAS_PROPERTY`]-(:Model { name:'%s' })", modelName))
-	cql.WriteString(fmt.Sprintf("-[:`@IN_DATASET`]->(:Dataset { id: %d }) ", datasetId))
-	cql.WriteString(fmt.Sprintf("-[:`@IN_ORGANIZATION`]->(:Organization { id: %d }) ", organizationId))
+	cql.WriteString("MATCH  (p:ModelProperty)<-[:`@HAS_PROPERTY`]-(:Model { name: $modelName })")
+	cql.WriteString("-[:`@IN_DATASET`]->(:Dataset { id: $datasetId }) ")
+	cql.WriteString("-[:`@IN_ORGANIZATION`]->(:Organization { id: $organizationId }) ")
 
 	// RETURN
 	cql.WriteString("RETURN p.name AS name, p.description AS description, p.id AS id, p.display_name AS display_name,")
 	cql.WriteString(" p.default AS default, p.data_type AS data_type, p.model_title AS model_title, p.index AS index")
-	//cql.WriteString(" SORT BY p.index")
+	cql.WriteString(" ORDER BY p.index")
 
-	result, err := q.db.Run(ctx, cql.String(), nil)
+	params := map[string]interface{}{
+		"modelName":      modelName,
+		"datasetId":      datasetId,
+		"organizationId": organizationId,
+	}
+
+	result, err := q.db.Run(ctx, cql.String(), params)
 	if err != nil {
 		return nil, err
 	}
@@ -255,13 +410,179 @@ func (q *NeoQueries) GetModelProps(ctx context.Context, datasetId int, organizat
 
 }
 
+// GetModelsProps returns the properties of the provided models by model name, in a single query.
+func (q *NeoQueries) GetModelsProps(ctx context.Context, datasetId int, organizationId int, modelNames []string) (
+	map[string][]models.ModelProperty, error) {
+
+	var cql strings.Builder
+
+	// MATCHING
+	cql.WriteString("MATCH  (p:ModelProperty)<-[:`@HAS_PROPERTY`]-(m:Model)")
+	cql.WriteString("-[:`@IN_DATASET`]->(:Dataset { id: $datasetId }) ")
+	cql.WriteString("-[:`@IN_ORGANIZATION`]->(:Organization { id: $organizationId }) ")
+	cql.WriteString("WHERE m.name IN $modelNames ")
+
+	// RETURN
+	cql.WriteString("RETURN m.name AS model, p.name AS name, p.description AS description, p.id AS id, ")
+	cql.WriteString("p.display_name AS display_name, p.default AS default, p.data_type AS data_type, ")
+	cql.WriteString("p.model_title AS model_title, p.index AS index")
+	cql.WriteString(" ORDER BY p.index")
+
+	params := map[string]interface{}{
+		"modelNames":     modelNames,
+		"datasetId":      datasetId,
+		"organizationId": organizationId,
+	}
+
+	result, err := q.db.Run(ctx, cql.String(), params)
+	if err != nil {
+		return nil, err
+	}
+
+	modelProps := make(map[string][]models.ModelProperty)
+	for result.Next(ctx) {
+		model, _ := result.Record().Get("model")
+		name := shared.StringOrEmpty(model)
+		modelProps[name] = append(modelProps[name], shared.ParseModelPropertyResponse(result.Record()))
+	}
+	if err = result.Err(); err != nil {
+		return nil, err
+	}
+
+	return modelProps, nil
+}
+
+// CountPropertyUsage returns the number of records of a model that have a value for the provided property
+func (q *NeoQueries) CountPropertyUsage(ctx context.Context, modelId string, propName string) (int64, error) {
+
+	cql := "MATCH (:Model{id: $modelId})<-[:`@INSTANCE_OF`]-(r:Record) " +
+		"WHERE r." + identifier(propName) + " IS NOT NULL " +
+		"RETURN count(r) AS count"
+
+	result, err := q.db.Run(ctx, cql, map[string]interface{}{"modelId": modelId})
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := result.Single(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	cnt, exists := res.Get("count")
+	if !exists {
+		return 0, errors.New("count does not exist")
+	}
+
+	return cnt.(int64), nil
+}
+
+// UpsertModelProperties creates or replaces the provided properties of a model, matching existing properties by name.
+func (q *NeoQueries) UpsertModelProperties(ctx context.Context, modelId string, props []models.ModelProperty) error {
+
+	var batch []map[string]interface{}
+	for _, p := range props {
+		batch = append(batch, map[string]interface{}{
+			"name":         p.Name,
+			"display_name": p.DisplayName,
+			"description":  p.Description,
+			"data_type":    p.DataType.Encode(),
+			"default":      p.DefaultValue,
+			"model_title":  p.IsModelTitle,
+			"index":        p.Index,
+		})
+	}
+
+	cql := "MATCH (m:Model{id: $modelId}) " +
+		"UNWIND $batch AS prop " +
+		"MERGE (m)-[:`@HAS_PROPERTY`]->(p:ModelProperty{name: prop.name}) " +
+		"ON CREATE SET p.id = randomUUID(), p.created_at = datetime() " +
+		"SET p.display_name = prop.display_name, p.description = prop.description, p.data_type = prop.data_type, " +
+		"p.default = prop.default, p.model_title = prop.model_title, p.index = prop.index, p.updated_at = datetime()"
+
+	params := map[string]interface{}{
+		"modelId": modelId,
+		"batch":   batch,
+	}
+
+	_, err := q.db.Run(ctx, cql, params)
+	return err
+}
+
+// DeleteModelProperties removes the properties with the provided names from a model.
+func (q *NeoQueries) DeleteModelProperties(ctx context.Context, modelId string, propNames []string) error {
+
+	cql := "MATCH (:Model{id: $modelId})-[:`@HAS_PROPERTY`]->(p:ModelProperty) " +
+		"WHERE p.name IN $names " +
+		"DETACH DELETE p"
+
+	params := map[string]interface{}{
+		"modelId": modelId,
+		"names":   propNames,
+	}
+
+	_, err := q.db.Run(ctx, cql, params)
+	return err
+}
+
+// RemoveRecordProperty removes the value for a property from all records of a model.
+func (q *NeoQueries) RemoveRecordProperty(ctx context.Context, modelId string, propName string) error {
+
+	cql := "MATCH (:Model{id: $modelId})<-[:`@INSTANCE_OF`]-(r:Record) " +
+		"REMOVE r." + identifier(propName)
+
+	_, err := q.db.Run(ctx, cql, map[string]interface{}{"modelId": modelId})
+	return err
+}
+
+// CountUnconvertibleProperty returns the number of records of a model that have a value for a property that the
+// provided conversion cannot convert.
+func (q *NeoQueries) CountUnconvertibleProperty(ctx context.Context, modelId string, propName string,
+	conversion propertyConversion) (int64, error) {
+
+	cql := "MATCH (:Model{id: $modelId})<-[:`@INSTANCE_OF`]-(r:Record) " +
+		"WHERE r." + identifier(propName) + " IS NOT NULL " +
+		"AND " + conversion.expression("r."+identifier(propName)) + " IS NULL " +
+		"RETURN count(r) AS count"
+
+	result, err := q.db.Run(ctx, cql, map[string]interface{}{"modelId": modelId})
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := result.Single(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	cnt, exists := res.Get("count")
+	if !exists {
+		return 0, errors.New("count does not exist")
+	}
+
+	return cnt.(int64), nil
+}
+
+// ConvertRecordProperty converts the value for a property in all records of a model using the provided conversion.
+func (q *NeoQueries) ConvertRecordProperty(ctx context.Context, modelId string, propName string,
+	conversion propertyConversion) error {
+
+	cql := "MATCH (:Model{id: $modelId})<-[:`@INSTANCE_OF`]-(r:Record) " +
+		"WHERE r." + identifier(propName) + " IS NOT NULL " +
+		"SET r." + identifier(propName) + " = " + conversion.expression("r."+identifier(propName))
+
+	_, err := q.db.Run(ctx, cql, map[string]interface{}{"modelId": modelId})
+	return err
+}
+
 // QueryTotal returns the total number of results for a particular query
-func (q *NeoQueries) QueryTotal(ctx context.Context, sourceModel models.Model, shortestPaths []dbtype.Path, filters []query.Filters,
-	orderBy string, limit int, offset int) (int64, error) {
+func (q *NeoQueries) QueryTotal(ctx context.Context, sourceModel models.Model, shortestPaths []dbtype.Path, where *query.FilterGroup,
+	modelProps map[string][]models.ModelProperty, orderBy query.OrderByList, limit int, offset int) (int64, error) {
 
 	queryParams := query.FormatParams{ResultType: query.COUNT}
 
-	query, err := generateQuery(sourceModel, shortestPaths, filters, orderBy, queryParams, limit, offset)
+	query, params, err := generateQuery(sourceModel, shortestPaths, nil, where, modelProps, orderBy, queryParams, limit,
+		offset)
 	if err != nil {
 		log.Error("Error generating query: ", err)
 		return 0, err
@@ -269,7 +590,7 @@ func (q *NeoQueries) QueryTotal(ctx context.Context, sourceModel models.Model, s
 
 	log.Debug("Query: ", query)
 
-	result, err := q.db.Run(ctx, query, nil)
+	result, err := q.db.Run(ctx, query, params)
 	if err != nil {
 		return 0, err
 	}
@@ -287,46 +608,183 @@ func (q *NeoQueries) QueryTotal(ctx context.Context, sourceModel models.Model, s
 	return totalNrRecords, nil
 }
 
-// Query returns an array of records based on a set of filters within a dataset
-func (q *NeoQueries) Query(ctx context.Context, sourceModel models.Model, shortestPaths []dbtype.Path, filters []query.Filters,
-	orderBy string, limit int, offset int) ([]models.Record, error) {
-
-	queryParams := query.FormatParams{ResultType: query.RESULTS}
-	query, err := generateQuery(sourceModel, shortestPaths, filters, orderBy, queryParams, limit, offset)
+// Query returns an array of records based on a set of filters within a dataset, starting after the cursor when it
+// is provided, and the cursor of the last record. Records of the included models that are linked to a record are
+// returned with the record. The optional paths lead to the models that only order the records.
+func (q *NeoQueries) Query(ctx context.Context, sourceModel models.Model, shortestPaths []dbtype.Path,
+	optionalPaths []dbtype.Path, where *query.FilterGroup,
+	modelProps map[string][]models.ModelProperty, orderBy query.OrderByList, limit int, offset int, after *query.Cursor,
+	include []models.Model) ([]models.Record, *query.Cursor, error) {
+
+	queryParams := query.FormatParams{ResultType: query.RESULTS, Include: include, After: after}
+	cql, params, err := generateQuery(sourceModel, shortestPaths, optionalPaths, where, modelProps, orderBy, queryParams,
+		limit, offset)
 	if err != nil {
 		log.Error("Error generating query: ", err)
-		return nil, err
+		return nil, nil, err
 	}
 
-	log.Debug("Query: ", query)
+	log.Debug("Query: ", cql)
 
-	result, err := q.db.Run(ctx, query, nil)
+	result, err := q.db.Run(ctx, cql, params)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
+	// The query validated the order
+	columns, _ := orderColumns(sourceModel, orderBy, modelProps)
+
 	var records []models.Record
+	var last *query.Cursor
 	for result.Next(ctx) {
 		r := result.Record()
 		rn, _ := r.Get("records")
 		node := rn.(dbtype.Node)
 
-		id := node.Props["@id"].(string)
+		last = &query.Cursor{Order: orderSignature(columns), Keys: make([]interface{}, len(columns))}
+		for i, c := range columns {
+			if c.model == sourceModel.Name {
+				last.Keys[i] = node.Props[c.property]
+			} else {
+				last.Keys[i], _ = r.Get(fmt.Sprintf("@o%d", i))
+			}
+		}
 
-		// Delete internal properties from map
-		delete(node.Props, "@id")
-		delete(node.Props, "@sort_key")
+		record := shared.ParseRecordNode(node, sourceModel.Name)
+		if len(include) > 0 {
+			linked, _ := r.Get("linked")
+			record.Linked, record.LinkedTruncated = parseLinkedRecords(linked, include)
+		}
+		records = append(records, record)
+
+	}
+	if err = result.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return records, last, nil
+}
+
+// parseLinkedRecords groups the linked records that a query with included models returns by the name of the
+// relationship. At most query.MaxLinkedRecords records are returned, and it returns whether there are more.
+func parseLinkedRecords(linked interface{}, include []models.Model) (map[string][]models.Record, bool) {
+	modelNames := make(map[string]string)
+	for _, m := range include {
+		modelNames[m.ID] = m.Name
+	}
 
-		newRec := models.Record{
-			ID:    id,
-			Model: sourceModel.Name,
-			Props: node.Props,
+	result := map[string][]models.Record{}
+	values, _ := linked.([]interface{})
+	truncated := len(values) > query.MaxLinkedRecords
+	if truncated {
+		values = values[:query.MaxLinkedRecords]
+	}
+	for _, v := range values {
+		l := v.(map[string]interface{})
+		node, isNode := l["record"].(dbtype.Node)
+		if !isNode {
+			// No linked records, the optional match returns null
+			continue
 		}
-		records = append(records, newRec)
 
+		relationship := shared.StringOrEmpty(l["relationship"])
+		modelName := modelNames[shared.StringOrEmpty(l["model"])]
+		result[relationship] = append(result[relationship], shared.ParseRecordNode(node, modelName))
 	}
 
-	return records, nil
+	return result, truncated
+}
+
+// Aggregate returns the groups of an aggregate query over the records that match a filter tree.
+func (q *NeoQueries) Aggregate(ctx context.Context, sourceModel models.Model, shortestPaths []dbtype.Path,
+	optionalPaths []dbtype.Path, where *query.FilterGroup, modelProps map[string][]models.ModelProperty,
+	agg query.Aggregate, limit int, offset int) ([]query.AggregateGroup, error) {
+
+	queryParams := query.FormatParams{ResultType: query.AGGREGATE, Aggregate: agg}
+	cql, params, err := generateQuery(sourceModel, shortestPaths, optionalPaths, where, modelProps, nil, queryParams,
+		limit, offset)
+	if err != nil {
+		log.Error("Error generating query: ", err)
+		return nil, err
+	}
+
+	log.Debug("Query: ", cql)
+
+	result, err := q.db.Run(ctx, cql, params)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := []query.AggregateGroup{}
+	for result.Next(ctx) {
+		r := result.Record()
+		group := query.AggregateGroup{
+			Keys:   make([]interface{}, len(agg.GroupBy)),
+			Values: make([]interface{}, len(agg.Aggregations)),
+		}
+		for i := range group.Keys {
+			group.Keys[i], _ = r.Get(fmt.Sprintf("g%d", i))
+		}
+		for i := range group.Values {
+			group.Values[i], _ = r.Get(fmt.Sprintf("a%d", i))
+		}
+		groups = append(groups, group)
+	}
+	if err = result.Err(); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+// Facet returns the most frequent values of a property with the number of records of the source model per value.
+func (q *NeoQueries) Facet(ctx context.Context, sourceModel models.Model, shortestPaths []dbtype.Path, where *query.FilterGroup,
+	modelProps map[string][]models.ModelProperty, facet query.Facet) ([]query.FacetValue, error) {
+
+	queryParams := query.FormatParams{ResultType: query.FACET, Facet: facet}
+	cql, params, err := generateQuery(sourceModel, shortestPaths, nil, where, modelProps, nil, queryParams, 0, 0)
+	if err != nil {
+		log.Error("Error generating query: ", err)
+		return nil, err
+	}
+
+	log.Debug("Query: ", cql)
+
+	result, err := q.db.Run(ctx, cql, params)
+	if err != nil {
+		return nil, err
+	}
+
+	values := []query.FacetValue{}
+	for result.Next(ctx) {
+		value, _ := result.Record().Get("value")
+		count, _ := result.Record().Get("count")
+		values = append(values, query.FacetValue{Value: value, Count: count.(int64)})
+	}
+	if err = result.Err(); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// Explain returns the execution plan of a query without running the query.
+func (q *NeoQueries) Explain(ctx context.Context, cql string, params map[string]interface{}) (*query.Plan, error) {
+	result, err := q.db.Run(ctx, "EXPLAIN "+cql, params)
+	if err != nil {
+		return nil, err
+	}
+
+	summary, err := result.Consume(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if summary.Plan() == nil {
+		return nil, errors.New("result does not contain a plan")
+	}
+
+	plan := explainPlan(summary.Plan())
+	return &plan, nil
 }
 
 // Autocomplete returns a list of terms that match values given the specified filters for a property in a model
@@ -342,12 +800,25 @@ func (q *NeoQueries) Autocomplete(ctx context.Context, datasetId int, organizati
 		return nil, &models.UnknownModelError{Model: req.Model}
 	}
 
-	// Use default ordering
-	orderBy := "`@sort_key`"
-
-	targetModels, err := getTargetModelsMap(req.Filters, sourceModel, modelMap)
+	where := combineFilters(req.Filters, req.Where)
+	targetModels, err := getTargetModelsMap(where.Leaves(), sourceModel, modelMap)
+	if err != nil {
+		return nil, err
+	}
 
 	shortestPaths, err := q.ShortestPath(ctx, sourceModel, targetModels)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = checkFilterModelsRelated(sourceModel, targetModels, shortestPaths); err != nil {
+		return nil, err
+	}
+
+	modelProps, err := getFilterModelProps(ctx, q, datasetId, organizationId, sourceModel, where)
+	if err != nil {
+		return nil, err
+	}
 
 	params := query.FormatParams{
 		ResultType: query.AUTOCOMPLETE,
@@ -357,11 +828,14 @@ func (q *NeoQueries) Autocomplete(ctx context.Context, datasetId int, organizati
 		},
 	}
 
-	query, err := generateQuery(sourceModel, shortestPaths, req.Filters, orderBy, params, 20, 0)
+	query, queryParams, err := generateQuery(sourceModel, shortestPaths, nil, where, modelProps, nil, params, 20, 0)
+	if err != nil {
+		return nil, err
+	}
 
 	log.Debug(query)
 
-	result, err := q.db.Run(ctx, query, nil)
+	result, err := q.db.Run(ctx, query, queryParams)
 	if err != nil {
 		return nil, err
 	}
@@ -392,15 +866,18 @@ func (q *NeoQueries) ShortestPath(ctx context.Context, sourceModel models.Model,
 		i++
 	}
 
-	targetModelStr := fmt.Sprintf("['%s']", strings.Join(keys, "','"))
-
-	cql := fmt.Sprintf("MATCH (m:Model{id:'%s'})-[:`@IN_DATASET`]->(d:Dataset)-[:`@IN_ORGANIZATION`]->(o:Organization) ", sourceModel.ID) +
+	cql := "MATCH (m:Model{id: $modelId})-[:`@IN_DATASET`]->(d:Dataset)-[:`@IN_ORGANIZATION`]->(o:Organization) " +
 		"MATCH (n:Model)-[:`@IN_DATASET`]->(d) " +
-		fmt.Sprintf("WHERE n.id IN %s ", targetModelStr) +
+		"WHERE n.id IN $targetModelIds " +
 		"MATCH p = shortestPath((m)-[:`@RELATED_TO` *..4]-(n)) " +
 		"RETURN p AS path"
 
-	result, err := q.db.Run(ctx, cql, nil)
+	params := map[string]interface{}{
+		"modelId":        sourceModel.ID,
+		"targetModelIds": keys,
+	}
+
+	result, err := q.db.Run(ctx, cql, params)
 	if err != nil {
 		return nil, err
 	}
@@ -416,23 +893,18 @@ func (q *NeoQueries) ShortestPath(ctx context.Context, sourceModel models.Model,
 	return shortestPaths, nil
 }
 
-// GetRecordsForPackage returns a list of connected records
+// GetRecordsForPackage returns a list of connected records of the dataset
 func (q *NeoQueries) GetRecordsForPackage(ctx context.Context, datasetId int, organizationId int, packageIds []int, maxDepth int) ([]models.PackageMetadata, error) {
 
-	var IDs []string
-	for _, i := range packageIds {
-		IDs = append(IDs, strconv.Itoa(i))
-	}
-	ancestorIds := strings.Join(IDs, ",")
-
-	log.Debug("GetRecordsForPackage: AncestorIds: ", ancestorIds)
+	log.Debug("GetRecordsForPackage: AncestorIds: ", packageIds)
 
+	// The maximum depth of a variable length relationship cannot be a parameter, and is written as an integer.
 	cql := "" +
-		fmt.Sprintf("MATCH (ds:Dataset{id: %d})-[:`@IN_ORGANIZATION`]->(:Organization{id: %d }) ", datasetId, organizationId) +
+		"MATCH (ds:Dataset{id: $datasetId})-[:`@IN_ORGANIZATION`]->(:Organization{id: $organizationId }) " +
 		" WITH ds LIMIT 1 " +
-		fmt.Sprintf("MATCH (p:Package)-[:`@IN_DATASET`]->(ds) WHERE p.package_id IN [%s] ", ancestorIds) +
-		"WITH DISTINCT p " +
-		fmt.Sprintf("MATCH (p)<-[*1..%d]-(r:Record)-[:`@INSTANCE_OF`]->(m:Model)", maxDepth) +
+		"MATCH (p:Package)-[:`@IN_DATASET`]->(ds) WHERE p.package_id IN $packageIds " +
+		"WITH DISTINCT p, ds " +
+		fmt.Sprintf("MATCH (p)<-[*1..%d]-(r:Record)-[:`@INSTANCE_OF`]->(m:Model)-[:`@IN_DATASET`]->(ds) ", maxDepth) +
 		"RETURN DISTINCT r as records ,m.name as model, {node_id:p.package_node_id, id:p.package_id} AS origin"
 
 	// NOTE: THIS DOES NOT ACTUALLY CHECK FOR THE DS, IT ACTUALLY WORKS AS THE ANCESTOR IDS ARE ALREADY SCOPED TO THE DS
@@ -451,7 +923,13 @@ func (q *NeoQueries) GetRecordsForPackage(ctx context.Context, datasetId int, or
 
 	log.Debug("GetRecordsForPackage: CQL: ", cql)
 
-	result, err := q.db.Run(ctx, cql, nil)
+	params := map[string]interface{}{
+		"datasetId":      datasetId,
+		"organizationId": organizationId,
+		"packageIds":     packageIds,
+	}
+
+	result, err := q.db.Run(ctx, cql, params)
 
 	if err != nil {
 		return nil, err
@@ -521,7 +999,8 @@ func (q *NeoQueries) CreateRelationShips(ctx context.Context, datasetId int, org
 	cql := "MATCH (m0:Model{name: $fromModelName})-[r0:`@RELATED_TO`{display_name: $relName}]-" +
 		"(m1:Model{name: $toModelName})-[:`@IN_DATASET`]->(:Dataset { id: $datasetID})- " +
 		"[:`@IN_ORGANIZATION`]->(:Organization {id: $organizationId}) " +
-		"RETURN m1.id AS toID, r0.id AS relID, r0.type AS relType, startnode(r0).id AS startNode, m0.id AS fromID"
+		"RETURN m1.id AS toID, r0.id AS relID, r0.type AS relType, startnode(r0).id AS startNode, m0.id AS fromID, " +
+		"r0.cardinality AS cardinality, r0.one_to_many AS oneToMany"
 
 	params := map[string]interface{}{
 		"toModelName":    req.Relationship.ToModel,
@@ -549,6 +1028,8 @@ func (q *NeoQueries) CreateRelationShips(ctx context.Context, datasetId int, org
 	relId, _ := record.Get("relID")
 	relType, _ := record.Get("relType")
 	startNode, _ := record.Get("startNode")
+	cardinality, _ := record.Get("cardinality")
+	oneToMany, _ := record.Get("oneToMany")
 
 	// 2. CHECK THAT PROVIDED RECORDS EXIST IN THE PROVIDED MODELS
 	// Match all records that belong to the given models and that are part
@@ -569,8 +1050,6 @@ func (q *NeoQueries) CreateRelationShips(ctx context.Context, datasetId int, org
 		"RecordToList":   req.Records.To,
 	}
 
-	log.Println(params)
-
 	result, err := q.db.Run(ctx, cql2, params)
 	if err != nil {
 		log.Println("Error running match records query: ", err)
@@ -592,21 +1071,64 @@ func (q *NeoQueries) CreateRelationShips(ctx context.Context, datasetId int, org
 		}
 	}
 
-	// 3. CREATE RELATIONSHIPS BETWEEN RECORDS
-
 	// If startNode of relationship is the toID that was provided
 	// then switch to, from nodes.
 	originNodes := req.Records.From
 	targetNodes := req.Records.To
+	originModel, targetModel := fromID, toID
 	if startNode == toID {
 		originNodes = req.Records.To
 		targetNodes = req.Records.From
+		originModel, targetModel = toID, fromID
+	}
+
+	// 3. CHECK THE CARDINALITY OF THE RELATIONSHIP
+	// Pairs in the request cannot conflict with each other. Conflicting
+	// relationships that exist are removed when replacing, and are
+	// violations otherwise. The records are locked first, so concurrent
+	// requests cannot both pass the check for the same records.
+	if c := relationshipCardinality(cardinality, oneToMany); c == models.OneToOne || c == models.OneToMany {
+		if err = q.LockRecords(ctx, append(append([]string{}, originNodes...), targetNodes...)); err != nil {
+			return nil, err
+		}
+
+		violations := cardinalityViolations(c, originNodes, targetNodes)
+
+		edges := recordRelationshipEdges{
+			relType:     relType.(string),
+			originModel: originModel.(string),
+			targetModel: targetModel.(string),
+			oneToOne:    c == models.OneToOne,
+		}
+		if req.Replace {
+			if _, err = q.DeleteConflictingRecordRelationships(ctx, edges, originNodes, targetNodes); err != nil {
+				return nil, err
+			}
+		} else {
+			conflicts, err := q.ConflictingRecordRelationships(ctx, edges, originNodes, targetNodes)
+			if err != nil {
+				return nil, err
+			}
+			violations = append(violations, conflicts...)
+		}
+
+		if len(violations) > 0 {
+			sort.SliceStable(violations, func(i, j int) bool { return violations[i].Index < violations[j].Index })
+			for i := range violations {
+				violations[i].From = req.Records.From[violations[i].Index]
+				violations[i].To = req.Records.To[violations[i].Index]
+			}
+			return nil, &models.CardinalityError{
+				Relationship: req.Relationship.RelName, Cardinality: c, Violations: violations}
+		}
 	}
 
+	// 4. CREATE RELATIONSHIPS BETWEEN RECORDS
+
 	cql3 := "UNWIND $batch AS row " +
 		"MATCH (from:Record{`@id`: row.from}) " +
 		"MATCH (to:Record{`@id`: row.to}) " +
-		fmt.Sprintf("MERGE (from)-[rel:%s]->(to) ", relType) +
+		fmt.Sprintf("MERGE (from)-[rel:%s]->(to) ", identifier(relType.(string))) +
 		"ON CREATE SET rel.created_by = $user, rel.created_at = datetime({timezone:\"Greenwich\"}), " +
 		"rel.updated_by = $user, rel.updated_at = datetime({timezone:\"Greenwich\"})," +
 		"rel.model_relationship_id = $modelRelID, rel.id = row.uuid " +
@@ -662,17 +1184,17 @@ func getTargetModelsMap(filters []query.Filters, sourceModel models.Model, model
 
 }
 
-// generateQuery returns a Cypher query based on the provided paths and filters.
-func generateQuery(sourceModel models.Model, paths []dbtype.Path, filters []query.Filters,
-	orderByProp string, formatParams query.FormatParams, limit int, offset int) (string, error) {
+// generateQuery returns a Cypher query and its parameters based on the provided paths and filter tree. Model and
+// property names in the filter tree and the autocomplete property are validated against modelProps, which contains
+// the properties of the source model and the filtered models by model name. The optional paths lead to models that
+// only order the results, and are joined without excluding records that have no related records.
+func generateQuery(sourceModel models.Model, paths []dbtype.Path, optionalPaths []dbtype.Path, where *query.FilterGroup,
+	modelProps map[string][]models.ModelProperty, orderBy query.OrderByList, formatParams query.FormatParams, limit int,
+	offset int) (string, map[string]interface{}, error) {
 
-	if orderByProp == "" {
-		return "", errors.New("orderBy cannot be empty")
-	}
-
-	// Dynamically build the queryStr
-	queryStr := strings.Builder{}
-	queryStr.WriteString("MATCH ")
+	// Dynamically build the query
+	b := newCypherBuilder()
+	b.write("MATCH ")
 
 	// Iterate over all shortest paths
 	if len(paths) > 0 {
@@ -690,19 +1212,20 @@ func generateQuery(sourceModel models.Model, paths []dbtype.Path, filters []quer
 						// In first node of first path --> link node to model
 
 						curRel := p.Relationships[pathIndex]
-						queryStr.WriteString(fmt.Sprintf("(M%s:Model{id:'%s'})<-[:`@INSTANCE_OF`]-(%s:Record)-[:%s]-",
-							curNode.Props["name"], curNode.Props["id"], curNode.Props["name"], curRel.Props["type"]))
+						b.write("(", identifier("M"+nodeName(curNode)), ":Model{id:", b.param(curNode.Props["id"]), "})",
+							"<-[:`@INSTANCE_OF`]-(", identifier(nodeName(curNode)), ":Record)-[:", relType(curRel), "]-")
 					} else {
 						if pathIndex <= len(p.Relationships)-1 {
 							// In waypoint in first path --> set waypoint
 
 							curRel := p.Relationships[pathIndex]
-							queryStr.WriteString(fmt.Sprintf("(%s:Record)-[:%s]-", curNode.Props["name"], curRel.Props["type"]))
+							b.write("(", identifier(nodeName(curNode)), ":Record)-[:", relType(curRel), "]-")
 						} else {
 							// In final node of first path --> link node to model
 
-							queryStr.WriteString(fmt.Sprintf("(%s:Record)-[:`@INSTANCE_OF`]->(M%s:Model{id:'%s'}) ",
-								p.Nodes[len(p.Nodes)-1].Props["name"], p.Nodes[len(p.Nodes)-1].Props["name"], p.Nodes[len(p.Nodes)-1].Props["id"]))
+							lastNode := p.Nodes[len(p.Nodes)-1]
+							b.write("(", identifier(nodeName(lastNode)), ":Record)-[:`@INSTANCE_OF`]->(",
+								identifier("M"+nodeName(lastNode)), ":Model{id:", b.param(lastNode.Props["id"]), "}) ")
 						}
 					}
 
@@ -734,7 +1257,8 @@ func generateQuery(sourceModel models.Model, paths []dbtype.Path, filters []quer
 						// In case this is the first node in the path, include the last previously known node as the starting point.
 						if setRestart {
 							// In first unknown node of subsequent path (should not be first node in path)
-							queryStr.WriteString(fmt.Sprintf(", (%s:Record)-[:%s]-", p.Nodes[pathIndex-1].Props["name"], p.Relationships[pathIndex-1].Props["type"]))
+							b.write(", (", identifier(nodeName(p.Nodes[pathIndex-1])), ":Record)-[:",
+								relType(p.Relationships[pathIndex-1]), "]-")
 							setRestart = false
 						}
 
@@ -742,12 +1266,12 @@ func generateQuery(sourceModel models.Model, paths []dbtype.Path, filters []quer
 						if pathIndex == len(p.Relationships) {
 							// In final node of subsequent path
 
-							queryStr.WriteString(fmt.Sprintf("(%s:Record) ", p.Nodes[len(p.Nodes)-1].Props["name"]))
+							b.write("(", identifier(nodeName(p.Nodes[len(p.Nodes)-1])), ":Record) ")
 						} else {
 							// In waypoint of subsequent path
 
 							curRel := p.Relationships[pathIndex]
-							queryStr.WriteString(fmt.Sprintf("(%s:Record)-[:%s]-", curNode.Props["name"], curRel.Props["type"]))
+							b.write("(", identifier(nodeName(curNode)), ":Record)-[:", relType(curRel), "]-")
 						}
 
 					}
@@ -759,60 +1283,108 @@ func generateQuery(sourceModel models.Model, paths []dbtype.Path, filters []quer
 		}
 	} else {
 		// No paths; only filters on model that is requested
-		queryStr.WriteString(fmt.Sprintf("(M%s:Model{id:'%s'})<-[:`@INSTANCE_OF`]-(%s:Record) ",
-			sourceModel.Name, sourceModel.ID, sourceModel.Name))
+		b.write("(", identifier("M"+sourceModel.Name), ":Model{id:", b.param(sourceModel.ID), "})",
+			"<-[:`@INSTANCE_OF`]-(", identifier(sourceModel.Name), ":Record) ")
 	}
-	// Include WHERE clauses
+
+	// Include WHERE clause
 	firstWhereClause := true
-	for _, f := range filters {
-		if !firstWhereClause {
-			queryStr.WriteString("AND ")
-		} else {
-			queryStr.WriteString("WHERE ")
+	if where != nil {
+		condition, err := compileFilterGroup(b, *where, modelProps)
+		if err != nil {
+			return "", nil, err
 		}
-		queryStr.WriteString(fmt.Sprintf("%s.%s %s '%s' ", f.Model, f.Property, f.Operator, f.Value))
+		b.write("WHERE ", condition, " ")
 		firstWhereClause = false
 	}
 
 	// Return
+	source := identifier(sourceModel.Name)
 	switch formatParams.ResultType {
 	case query.AUTOCOMPLETE:
+		propName := formatParams.AutoCompleteParams.PropName
+		if !hasProperty(modelProps[sourceModel.Name], propName) {
+			return "", nil, &models.UnknownModelPropertyError{PropName: propName}
+		}
+
 		// Add autocomplete filter
 		if !firstWhereClause {
-			queryStr.WriteString("AND ")
+			b.write("AND ")
 		} else {
-			queryStr.WriteString("WHERE ")
+			b.write("WHERE ")
 		}
 
-		queryStr.WriteString(fmt.Sprintf("%s.%s =~ '(?i).*%s.*' ", sourceModel.Name,
-			formatParams.AutoCompleteParams.PropName, formatParams.AutoCompleteParams.Text))
-		queryStr.WriteString(fmt.Sprintf("RETURN DISTINCT %s.%s AS value LIMIT %d",
-			sourceModel.Name, formatParams.AutoCompleteParams.PropName, limit))
+		field := source + "." + identifier(propName)
+		text := "(?i).*" + regexp.QuoteMeta(formatParams.AutoCompleteParams.Text) + ".*"
+		b.write(field, " =~ ", b.param(text), " ")
+		b.write("RETURN DISTINCT ", field, " AS value LIMIT ", b.param(limit))
 	case query.RESULTS:
-		queryStr.WriteString(fmt.Sprintf("RETURN DISTINCT %s AS records ORDER BY %s.%s SKIP %d LIMIT %d",
-			sourceModel.Name, sourceModel.Name, orderByProp, offset, limit))
+		if len(optionalPaths) > 0 {
+			compileOptionalPaths(b, optionalPaths)
+			firstWhereClause = true
+		}
+		if err := compileResults(b, sourceModel, orderBy, formatParams, modelProps, limit, offset,
+			!firstWhereClause); err != nil {
+			return "", nil, err
+		}
 	case query.COUNT:
-		queryStr.WriteString(fmt.Sprintf("RETURN count(distinct %s) AS total", sourceModel.Name))
+		b.write("RETURN count(distinct ", source, ") AS total")
+	case query.AGGREGATE:
+		compileOptionalPaths(b, optionalPaths)
+		if err := compileAggregate(b, sourceModel, formatParams.Aggregate, modelProps, limit, offset); err != nil {
+			return "", nil, err
+		}
+	case query.FACET:
+		if err := compileFacet(b, sourceModel, formatParams.Facet, modelProps); err != nil {
+			return "", nil, err
+		}
 
 	}
 
-	return queryStr.String(), nil
+	return b.String(), b.Params(), nil
 }
 
-// validOperator checks if the requested operator is one of the allowed methods.
-func validOperator(op string) bool {
-	var validOperators = [...]string{
-		"=", "<>", "<", "<=",
-		">", ">=", "=~", "STARTS WITH", "ENDS WITH", "CONTAINS"}
+// nodeName returns the name of a model node in a path, to which generateQuery binds the records of the model.
+func nodeName(n dbtype.Node) string {
+	return shared.StringOrEmpty(n.Props["name"])
+}
 
-	for _, o := range validOperators {
-		if op == o {
+// compileOptionalPaths writes an OPTIONAL MATCH per path from the source records to the records of the last model in
+// the path, so source records without related records are kept with null values for the related records. Records
+// of models that earlier clauses matched are reused.
+func compileOptionalPaths(b *cypherBuilder, paths []dbtype.Path) {
+	for _, p := range paths {
+		b.write("OPTIONAL MATCH (", identifier(nodeName(p.Nodes[0])), ")")
+		for i, rel := range p.Relationships {
+			b.write("-[:", relType(rel), "]-(", identifier(nodeName(p.Nodes[i+1])), ":Record)")
+		}
+		last := p.Nodes[len(p.Nodes)-1]
+		b.write("-[:`@INSTANCE_OF`]->(", identifier("M"+nodeName(last)), ":Model{id:", b.param(last.Props["id"]),
+			"}) ")
+	}
+}
+
+// relType returns the relationship type of a model relationship in a path as an identifier.
+func relType(r dbtype.Relationship) string {
+	return identifier(shared.StringOrEmpty(r.Props["type"]))
+}
+
+// hasProperty checks if a property with the provided name is in the list of properties.
+func hasProperty(props []models.ModelProperty, name string) bool {
+	for _, p := range props {
+		if p.Name == name {
 			return true
 		}
 	}
 	return false
 }
 
+// validOperator checks if the requested operator is one of the allowed methods.
+func validOperator(op string) bool {
+	_, found := models.ParseOperator(op)
+	return found
+}
+
 // validateModelName returns a valid ModelName or error.
 func validateModelName(name string) (string, error) {
 	name = strings.TrimSpace(name)
@@ -835,3 +1407,26 @@ func validateModelName(name string) (string, error) {
 
 	return name, nil
 }
+
+// validateRelationshipType returns a valid relationship type or error. Types follow the rules of model names, and
+// the types of the relationships between the nodes of the schema are reserved.
+func validateRelationshipType(relType string) (string, error) {
+	relType = strings.TrimSpace(relType)
+	for _, reserved := range labels.RESERVED_SCHEMA_RELATIONSHIPS {
+		if strings.EqualFold(relType, reserved) || strings.EqualFold("@"+relType, reserved) {
+			return "", &models.ReservedNameError{Name: relType}
+		}
+	}
+
+	return validateModelName(relType)
+}
+
+// validatePropertyName returns a valid property name or error.
+func validatePropertyName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if shared.StringInSlice(name, reservedPropertyNames) || strings.HasPrefix(name, "@") {
+		return "", &models.ReservedNameError{Name: name}
+	}
+
+	return validateModelName(name)
+}
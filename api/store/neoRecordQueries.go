@@ -0,0 +1,413 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j/dbtype"
+	"github.com/pennsieve/model-service-serverless/api/models"
+	"github.com/pennsieve/model-service-serverless/api/shared"
+	"time"
+)
+
+// CreateRecord creates a record for a model and links the record to the model and the user.
+// The record gets a sort key based on the '@max_sort_key' of the model.
+func (q *NeoQueries) CreateRecord(ctx context.Context, model models.Model, values map[string]interface{}, userId string) (*models.Record, error) {
+
+	cql := "MATCH (m:Model{id: $modelId}) " +
+		"SET m.`@max_sort_key` = COALESCE(m.`@max_sort_key`, 0) + 1 " +
+		"WITH m, m.`@max_sort_key` AS sortKey " +
+		"MERGE (u:User{node_id: $userId}) " +
+		"CREATE (r:Record{`@id`: randomUUID(), `@sort_key`: sortKey}) " +
+		"SET r += $values " +
+		"CREATE (r)-[:`@INSTANCE_OF`]->(m) " +
+		"CREATE (r)-[:`@CREATED_BY` {at: datetime()}]->(u) " +
+		"CREATE (r)-[:`@UPDATED_BY` {at: datetime()}]->(u) " +
+		"RETURN r"
+
+	params := map[string]interface{}{
+		"modelId": model.ID,
+		"userId":  userId,
+		"values":  values,
+	}
+
+	result, err := q.db.Run(ctx, cql, params)
+	if err != nil {
+		return nil, err
+	}
+
+	rec, err := result.Single(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rn, _ := rec.Get("r")
+	record := shared.ParseRecordNode(rn.(dbtype.Node), model.Name)
+	return &record, nil
+}
+
+// GetRecord returns a record of a model by its id.
+func (q *NeoQueries) GetRecord(ctx context.Context, model models.Model, recordId string) (*models.Record, error) {
+
+	cql := "MATCH (r:Record{`@id`: $recordId})-[:`@INSTANCE_OF`]->(:Model{id: $modelId}) " +
+		"RETURN r"
+
+	params := map[string]interface{}{
+		"modelId":  model.ID,
+		"recordId": recordId,
+	}
+
+	return q.singleRecord(ctx, cql, params, model, recordId)
+}
+
+// UpdateRecord replaces the values of a record and sets the user as the last updater.
+func (q *NeoQueries) UpdateRecord(ctx context.Context, model models.Model, recordId string, values map[string]interface{},
+	userId string) (*models.Record, error) {
+
+	cql := "MATCH (r:Record{`@id`: $recordId})-[:`@INSTANCE_OF`]->(:Model{id: $modelId}) " +
+		"MERGE (u:User{node_id: $userId}) " +
+		"WITH r, u, r.`@id` AS id, r.`@sort_key` AS sortKey " +
+		"OPTIONAL MATCH (r)-[updated:`@UPDATED_BY`]->(:User) " +
+		"DELETE updated " +
+		"WITH DISTINCT r, u, id, sortKey " +
+		"SET r = $values " +
+		"SET r.`@id` = id, r.`@sort_key` = sortKey " +
+		"CREATE (r)-[:`@UPDATED_BY` {at: datetime()}]->(u) " +
+		"RETURN r"
+
+	params := map[string]interface{}{
+		"modelId":  model.ID,
+		"recordId": recordId,
+		"userId":   userId,
+		"values":   values,
+	}
+
+	return q.singleRecord(ctx, cql, params, model, recordId)
+}
+
+// DeleteRecord removes a record and all its relationships.
+func (q *NeoQueries) DeleteRecord(ctx context.Context, model models.Model, recordId string) error {
+
+	cql := "MATCH (r:Record{`@id`: $recordId})-[:`@INSTANCE_OF`]->(:Model{id: $modelId}) " +
+		"DETACH DELETE r " +
+		"RETURN count(r) AS count"
+
+	params := map[string]interface{}{
+		"modelId":  model.ID,
+		"recordId": recordId,
+	}
+
+	result, err := q.db.Run(ctx, cql, params)
+	if err != nil {
+		return err
+	}
+
+	rec, err := result.Single(ctx)
+	if err != nil {
+		return err
+	}
+
+	if cnt, _ := rec.Get("count"); cnt.(int64) == 0 {
+		return &models.UnknownRecordError{ID: recordId}
+	}
+
+	return nil
+}
+
+// CreateRecords creates a record for each set of values in the batch and returns the ids of the created records
+// in the same order. Sort keys for the batch are reserved on the model in a single update.
+func (q *NeoQueries) CreateRecords(ctx context.Context, model models.Model, batch []map[string]interface{}, userId string) ([]string, error) {
+
+	cql := "MATCH (m:Model{id: $modelId}) " +
+		"SET m.`@max_sort_key` = COALESCE(m.`@max_sort_key`, 0) + size($batch) " +
+		"WITH m, m.`@max_sort_key` - size($batch) AS offset " +
+		"MERGE (u:User{node_id: $userId}) " +
+		"WITH m, u, offset " +
+		"UNWIND range(0, size($batch) - 1) AS i " +
+		"CREATE (r:Record{`@id`: randomUUID(), `@sort_key`: offset + i + 1}) " +
+		"SET r += $batch[i] " +
+		"CREATE (r)-[:`@INSTANCE_OF`]->(m) " +
+		"CREATE (r)-[:`@CREATED_BY` {at: datetime()}]->(u) " +
+		"CREATE (r)-[:`@UPDATED_BY` {at: datetime()}]->(u) " +
+		"RETURN i AS index, r.`@id` AS id"
+
+	params := map[string]interface{}{
+		"modelId": model.ID,
+		"userId":  userId,
+		"batch":   batch,
+	}
+
+	result, err := q.db.Run(ctx, cql, params)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := result.Collect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(batch))
+	for _, r := range records {
+		index, _ := r.Get("index")
+		id, _ := r.Get("id")
+		ids[index.(int64)] = id.(string)
+	}
+
+	return ids, nil
+}
+
+// UpdateRecords replaces the values of existing records. Each row in the batch contains the 'id' of the record
+// and the new 'values'.
+func (q *NeoQueries) UpdateRecords(ctx context.Context, model models.Model, batch []map[string]interface{}, userId string) error {
+
+	cql := "MERGE (u:User{node_id: $userId}) " +
+		"WITH u " +
+		"UNWIND $batch AS row " +
+		"MATCH (r:Record{`@id`: row.id})-[:`@INSTANCE_OF`]->(:Model{id: $modelId}) " +
+		"WITH r, u, row, r.`@id` AS id, r.`@sort_key` AS sortKey " +
+		"OPTIONAL MATCH (r)-[updated:`@UPDATED_BY`]->(:User) " +
+		"DELETE updated " +
+		"WITH DISTINCT r, u, row, id, sortKey " +
+		"SET r = row.values " +
+		"SET r.`@id` = id, r.`@sort_key` = sortKey " +
+		"CREATE (r)-[:`@UPDATED_BY` {at: datetime()}]->(u)"
+
+	params := map[string]interface{}{
+		"modelId": model.ID,
+		"userId":  userId,
+		"batch":   batch,
+	}
+
+	_, err := q.db.Run(ctx, cql, params)
+	return err
+}
+
+// GetRecordIdsByProperty returns the ids of the records of a model that have one of the provided values for a property,
+// grouped by the key of the value for the data type of the property. Dates are matched by instant, whatever their time
+// zone.
+func (q *NeoQueries) GetRecordIdsByProperty(ctx context.Context, model models.Model, prop models.ModelProperty,
+	values []interface{}) (map[string][]string, error) {
+
+	value := "r." + identifier(prop.Name)
+	match := value
+	if prop.DataType.Type == models.DATE && !prop.DataType.IsArray {
+		match = fmt.Sprintf("%s.epochSeconds * 1000000000 + %s.nanosecond", value, value)
+
+		instants := make([]interface{}, len(values))
+		for i, v := range values {
+			instants[i] = v
+			if t, isTime := v.(time.Time); isTime {
+				instants[i] = t.UnixNano()
+			}
+		}
+		values = instants
+	}
+
+	cql := "MATCH (r:Record)-[:`@INSTANCE_OF`]->(:Model{id: $modelId}) " +
+		"WHERE " + match + " IN $values " +
+		"RETURN " + value + " AS value, r.`@id` AS id"
+
+	params := map[string]interface{}{
+		"modelId": model.ID,
+		"values":  values,
+	}
+
+	result, err := q.db.Run(ctx, cql, params)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string][]string)
+	for result.Next(ctx) {
+		value, _ := result.Record().Get("value")
+		id, _ := result.Record().Get("id")
+		key := propertyValueKey(prop.DataType, value)
+		ids[key] = append(ids[key], id.(string))
+	}
+	if err = result.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// matchDatasetRecord matches a record of a model in a dataset as r, and the model of the record as m.
+const matchDatasetRecord = "MATCH (r:Record{`@id`: $recordId})-[:`@INSTANCE_OF`]->(m:Model)" +
+	"-[:`@IN_DATASET`]->(:Dataset{id: $datasetId})-[:`@IN_ORGANIZATION`]->(:Organization{id: $organizationId}) "
+
+// GetRecordRelationships returns a page of the relationships between a record in a dataset and other records, ordered
+// by creation. When a name is provided, only relationships of the model relationship with the name are returned.
+func (q *NeoQueries) GetRecordRelationships(ctx context.Context, datasetId int, organizationId int, recordId string,
+	name string, limit int, offset int) ([]models.RecordRelationShip, error) {
+
+	params := map[string]interface{}{
+		"recordId":       recordId,
+		"datasetId":      datasetId,
+		"organizationId": organizationId,
+		"name":           nil,
+		"limit":          limit,
+		"offset":         offset,
+	}
+	if name != "" {
+		params["name"] = name
+	}
+
+	result, err := q.db.Run(ctx, matchDatasetRecord+"RETURN count(r) AS count", params)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := result.Single(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if cnt, _ := rec.Get("count"); cnt.(int64) == 0 {
+		return nil, &models.UnknownRecordError{ID: recordId}
+	}
+
+	// Relationships between records are created for a model relationship, which relates the models of the records.
+	cql := matchDatasetRecord +
+		"MATCH (r)-[e]-(:Record)-[:`@INSTANCE_OF`]->(om:Model) " +
+		"WHERE e.model_relationship_id IS NOT NULL " +
+		"OPTIONAL MATCH (m)-[mr:`@RELATED_TO`]-(om) WHERE mr.id = e.model_relationship_id " +
+		"WITH e, mr WHERE $name IS NULL OR mr.display_name = $name " +
+		"RETURN e, startNode(e).`@id` AS from, endNode(e).`@id` AS to, mr.display_name AS name " +
+		"ORDER BY e.created_at, e.id SKIP $offset LIMIT $limit"
+
+	result, err = q.db.Run(ctx, cql, params)
+	if err != nil {
+		return nil, err
+	}
+
+	relationships := []models.RecordRelationShip{}
+	for result.Next(ctx) {
+		relationships = append(relationships, parseRecordRelationship(result.Record(), recordId))
+	}
+	if err = result.Err(); err != nil {
+		return nil, err
+	}
+
+	return relationships, nil
+}
+
+// DeleteRecordRelationships removes the relationships between records in a dataset with the provided ids, and the
+// relationships between the records in the pairs, which map the id of the from record to the id of the to record.
+// When a name is provided, only relationships of the model relationship with the name are removed between the
+// pairs. Returns the number of removed relationships.
+func (q *NeoQueries) DeleteRecordRelationships(ctx context.Context, datasetId int, organizationId int,
+	ids []string, pairs []map[string]interface{}, name string) (int64, error) {
+
+	params := map[string]interface{}{
+		"datasetId":      datasetId,
+		"organizationId": organizationId,
+		"ids":            ids,
+		"pairs":          pairs,
+		"name":           nil,
+	}
+	if name != "" {
+		params["name"] = name
+	}
+
+	var deleted int64
+	if len(ids) > 0 {
+		cql := "MATCH (:Organization{id: $organizationId})<-[:`@IN_ORGANIZATION`]-(:Dataset{id: $datasetId})" +
+			"<-[:`@IN_DATASET`]-(:Model)<-[:`@INSTANCE_OF`]-(:Record)-[e]->(:Record) " +
+			"WHERE e.model_relationship_id IS NOT NULL AND e.id IN $ids " +
+			"DELETE e " +
+			"RETURN count(e) AS count"
+
+		cnt, err := q.deleteCount(ctx, cql, params)
+		if err != nil {
+			return 0, err
+		}
+		deleted += cnt
+	}
+
+	if len(pairs) > 0 {
+		cql := "UNWIND $pairs AS pair " +
+			"MATCH (a:Record{`@id`: pair.from})-[:`@INSTANCE_OF`]->(am:Model)-[:`@IN_DATASET`]->(:Dataset{id: $datasetId})" +
+			"-[:`@IN_ORGANIZATION`]->(:Organization{id: $organizationId}) " +
+			"MATCH (a)-[e]-(:Record{`@id`: pair.to})-[:`@INSTANCE_OF`]->(bm:Model) " +
+			"WHERE e.model_relationship_id IS NOT NULL " +
+			"OPTIONAL MATCH (am)-[mr:`@RELATED_TO`]-(bm) WHERE mr.id = e.model_relationship_id " +
+			"WITH DISTINCT e, mr WHERE $name IS NULL OR mr.display_name = $name " +
+			"DELETE e " +
+			"RETURN count(e) AS count"
+
+		cnt, err := q.deleteCount(ctx, cql, params)
+		if err != nil {
+			return 0, err
+		}
+		deleted += cnt
+	}
+
+	return deleted, nil
+}
+
+// deleteCount runs a query that returns the number of deleted nodes or relationships as count.
+func (q *NeoQueries) deleteCount(ctx context.Context, cql string, params map[string]interface{}) (int64, error) {
+	result, err := q.db.Run(ctx, cql, params)
+	if err != nil {
+		return 0, err
+	}
+
+	rec, err := result.Single(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	cnt, _ := rec.Get("count")
+	return cnt.(int64), nil
+}
+
+// parseRecordRelationship returns the relationship in a record that is returned by GetRecordRelationships, in the
+// direction of the relationship from the record with the provided id.
+func parseRecordRelationship(rec *neo4j.Record, recordId string) models.RecordRelationShip {
+	re, _ := rec.Get("e")
+	e := re.(dbtype.Relationship)
+
+	from, _ := rec.Get("from")
+	to, _ := rec.Get("to")
+	name, _ := rec.Get("name")
+
+	r := models.RecordRelationShip{
+		ID:         shared.StringOrEmpty(e.Props["id"]),
+		From:       shared.StringOrEmpty(from),
+		To:         shared.StringOrEmpty(to),
+		RelType:    e.Type,
+		ModelRelID: shared.StringOrEmpty(e.Props["model_relationship_id"]),
+		Name:       shared.StringOrEmpty(name),
+		Direction:  models.RelationshipIncoming,
+		CreatedBy:  shared.StringOrEmpty(e.Props["created_by"]),
+		UpdatedBy:  shared.StringOrEmpty(e.Props["updated_by"]),
+	}
+	if r.From == recordId {
+		r.Direction = models.RelationshipOutgoing
+	}
+	r.CreatedAt, _ = e.Props["created_at"].(time.Time)
+	r.UpdatedAt, _ = e.Props["updated_at"].(time.Time)
+
+	return r
+}
+
+// singleRecord runs a query that returns a single record node as 'r'.
+func (q *NeoQueries) singleRecord(ctx context.Context, cql string, params map[string]interface{}, model models.Model,
+	recordId string) (*models.Record, error) {
+
+	result, err := q.db.Run(ctx, cql, params)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := result.Collect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, &models.UnknownRecordError{ID: recordId}
+	}
+
+	rn, _ := records[0].Get("r")
+	record := shared.ParseRecordNode(rn.(dbtype.Node), model.Name)
+	return &record, nil
+}
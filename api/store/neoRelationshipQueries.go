@@ -0,0 +1,418 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j/dbtype"
+	"github.com/pennsieve/model-service-serverless/api/models"
+	"github.com/pennsieve/model-service-serverless/api/shared"
+	"sort"
+	"time"
+)
+
+// matchModelRelationships matches the relationships between the models of a dataset. Relationships with an index
+// are linked properties of a model and are not matched.
+const matchModelRelationships = "MATCH (:Model)-[r:`@RELATED_TO`]->(:Model)-[:`@IN_DATASET`]->(:Dataset{id: $datasetId})" +
+	"-[:`@IN_ORGANIZATION`]->(:Organization{id: $organizationId}) " +
+	"WHERE r.index IS NULL "
+
+// migrateCardinality replaces the one_to_many flag of a model relationship r, which is stored by relationships that
+// were created before the cardinality was stored, with the cardinality that relationshipCardinality reads.
+const migrateCardinality = "SET r.cardinality = coalesce(r.cardinality, CASE r.one_to_many " +
+	"WHEN true THEN '" + models.OneToMany + "' WHEN false THEN '" + models.OneToOne + "' " +
+	"ELSE '" + models.ManyToMany + "' END) " +
+	"REMOVE r.one_to_many "
+
+// modelRelationshipReturn returns a model relationship, which parseModelRelationship parses.
+const modelRelationshipReturn = "RETURN r, startNode(r).id AS from, endNode(r).id AS to"
+
+// CreateModelRelationship relates two models with a relationship of the type, and sets the user as the creator.
+func (q *NeoQueries) CreateModelRelationship(ctx context.Context, from models.Model, to models.Model, relType string,
+	displayName string, cardinality string, userId string) (*models.ModelRelationship, error) {
+
+	cql := "MATCH (from:Model{id: $fromId}) " +
+		"MATCH (to:Model{id: $toId}) " +
+		"CREATE (from)-[r:`@RELATED_TO`{id: randomUUID(), type: $type, display_name: $displayName, " +
+		"cardinality: $cardinality, created_by: $userId, created_at: datetime(), updated_by: $userId, " +
+		"updated_at: datetime()}]->(to) " +
+		modelRelationshipReturn
+
+	params := map[string]interface{}{
+		"fromId":      from.ID,
+		"toId":        to.ID,
+		"type":        relType,
+		"displayName": displayName,
+		"cardinality": cardinality,
+		"userId":      userId,
+	}
+
+	return q.singleModelRelationship(ctx, cql, params, "")
+}
+
+// GetModelRelationships returns the relationships between the models of a dataset.
+func (q *NeoQueries) GetModelRelationships(ctx context.Context, datasetId int, organizationId int) (
+	[]models.ModelRelationship, error) {
+
+	cql := matchModelRelationships +
+		"WITH r ORDER BY r.display_name, r.id " +
+		modelRelationshipReturn
+
+	params := map[string]interface{}{
+		"datasetId":      datasetId,
+		"organizationId": organizationId,
+	}
+
+	result, err := q.db.Run(ctx, cql, params)
+	if err != nil {
+		return nil, err
+	}
+
+	relationships := []models.ModelRelationship{}
+	for result.Next(ctx) {
+		relationships = append(relationships, parseModelRelationship(result.Record()))
+	}
+	if err = result.Err(); err != nil {
+		return nil, err
+	}
+
+	return relationships, nil
+}
+
+// GetModelRelationship returns a relationship between the models of a dataset by its id.
+func (q *NeoQueries) GetModelRelationship(ctx context.Context, datasetId int, organizationId int,
+	relationshipId string) (*models.ModelRelationship, error) {
+
+	cql := matchModelRelationships +
+		"AND r.id = $relationshipId " +
+		modelRelationshipReturn
+
+	params := map[string]interface{}{
+		"relationshipId": relationshipId,
+		"datasetId":      datasetId,
+		"organizationId": organizationId,
+	}
+
+	return q.singleModelRelationship(ctx, cql, params, relationshipId)
+}
+
+// UpdateModelRelationship renames a model relationship and sets the user as the last updater. The type of the
+// relationship is not changed, as it is the type of the relationships between records.
+func (q *NeoQueries) UpdateModelRelationship(ctx context.Context, datasetId int, organizationId int,
+	relationshipId string, displayName string, userId string) (*models.ModelRelationship, error) {
+
+	cql := matchModelRelationships +
+		"AND r.id = $relationshipId " +
+		"SET r.display_name = $displayName, r.updated_by = $userId, r.updated_at = datetime() " +
+		migrateCardinality +
+		modelRelationshipReturn
+
+	params := map[string]interface{}{
+		"relationshipId": relationshipId,
+		"datasetId":      datasetId,
+		"organizationId": organizationId,
+		"displayName":    displayName,
+		"userId":         userId,
+	}
+
+	return q.singleModelRelationship(ctx, cql, params, relationshipId)
+}
+
+// DeleteModelRelationship removes a relationship between the models of a dataset.
+func (q *NeoQueries) DeleteModelRelationship(ctx context.Context, datasetId int, organizationId int,
+	relationshipId string) error {
+
+	cql := matchModelRelationships +
+		"AND r.id = $relationshipId " +
+		"DELETE r " +
+		"RETURN count(r) AS count"
+
+	params := map[string]interface{}{
+		"relationshipId": relationshipId,
+		"datasetId":      datasetId,
+		"organizationId": organizationId,
+	}
+
+	result, err := q.db.Run(ctx, cql, params)
+	if err != nil {
+		return err
+	}
+
+	rec, err := result.Single(ctx)
+	if err != nil {
+		return err
+	}
+
+	if cnt, _ := rec.Get("count"); cnt.(int64) == 0 {
+		return &models.UnknownModelRelationshipError{ID: relationshipId}
+	}
+
+	return nil
+}
+
+// ModelRelationshipExists reports whether a relationship other than the relationship with the provided id relates
+// the models, in either direction, with the display name. Record relationships are created for a relationship by
+// the names of the models and the display name, so the display name is unique for the models.
+func (q *NeoQueries) ModelRelationshipExists(ctx context.Context, fromId string, toId string, displayName string,
+	relationshipId string) (bool, error) {
+
+	cql := "MATCH (:Model{id: $fromId})-[r:`@RELATED_TO`{display_name: $displayName}]-(:Model{id: $toId}) " +
+		"WHERE r.id <> $relationshipId " +
+		"RETURN count(r) AS count"
+
+	params := map[string]interface{}{
+		"fromId":         fromId,
+		"toId":           toId,
+		"displayName":    displayName,
+		"relationshipId": relationshipId,
+	}
+
+	result, err := q.db.Run(ctx, cql, params)
+	if err != nil {
+		return false, err
+	}
+
+	rec, err := result.Single(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	cnt, _ := rec.Get("count")
+	return cnt.(int64) > 0, nil
+}
+
+// CountRecordRelationships returns the number of relationships between records of the models of a model
+// relationship that have the type of the model relationship.
+func (q *NeoQueries) CountRecordRelationships(ctx context.Context, relationship models.ModelRelationship) (int64, error) {
+
+	// The type of a relationship cannot be a parameter, and is written as an identifier.
+	cql := "MATCH (:Model{id: $fromId})<-[:`@INSTANCE_OF`]-(:Record)-[e:" + identifier(relationship.Type) + "]->" +
+		"(:Record)-[:`@INSTANCE_OF`]->(:Model{id: $toId}) " +
+		"RETURN count(e) AS count"
+
+	params := map[string]interface{}{
+		"fromId": relationship.From,
+		"toId":   relationship.To,
+	}
+
+	result, err := q.db.Run(ctx, cql, params)
+	if err != nil {
+		return 0, err
+	}
+
+	rec, err := result.Single(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	cnt, _ := rec.Get("count")
+	return cnt.(int64), nil
+}
+
+// recordRelationshipEdges describes the relationships between records of a model relationship: the type of the
+// relationships, the models of their start and end records, and whether the cardinality is OneToOne or OneToMany.
+type recordRelationshipEdges struct {
+	relType     string
+	originModel string
+	targetModel string
+	oneToOne    bool
+}
+
+// conflictingRelationships matches, for each pair of records in the batch, the existing relationships that the
+// cardinality does not allow next to a relationship between the records: relationships from the origin to other
+// records when the cardinality is one-to-one, and relationships from other records to the target.
+func conflictingRelationships(edges recordRelationshipEdges) string {
+	// The type of a relationship cannot be a parameter, and is written as an identifier.
+	relType := identifier(edges.relType)
+	return "UNWIND $batch AS row " +
+		"MATCH (from:Record{`@id`: row.from}) " +
+		"MATCH (to:Record{`@id`: row.to}) " +
+		"OPTIONAL MATCH (from)-[t:" + relType + "]->(target:Record)-[:`@INSTANCE_OF`]->(:Model{id: $targetModel}) " +
+		"WHERE $oneToOne AND target <> to " +
+		"WITH row, from, to, collect(t) AS targetEdges, collect(target.`@id`) AS targets " +
+		"OPTIONAL MATCH (to)<-[o:" + relType + "]-(origin:Record)-[:`@INSTANCE_OF`]->(:Model{id: $originModel}) " +
+		"WHERE origin <> from " +
+		"WITH row, targetEdges, targets, collect(o) AS originEdges, collect(origin.`@id`) AS origins "
+}
+
+// LockRecords takes a write lock on the records with the ids until the transaction ends, so concurrent transactions
+// that relate the records wait for each other. Records are locked in the order of their ids to avoid deadlocks.
+func (q *NeoQueries) LockRecords(ctx context.Context, recordIds []string) error {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, id := range recordIds {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	cql := "UNWIND $ids AS id " +
+		"MATCH (r:Record{`@id`: id}) " +
+		"SET r.`@lock` = true " +
+		"REMOVE r.`@lock`"
+
+	_, err := q.db.Run(ctx, cql, map[string]interface{}{"ids": ids})
+	return err
+}
+
+// ConflictingRecordRelationships returns a violation for each pair of origin and target records that cannot be
+// related because of the existing relationships of the records.
+func (q *NeoQueries) ConflictingRecordRelationships(ctx context.Context, edges recordRelationshipEdges,
+	origins []string, targets []string) ([]models.CardinalityViolation, error) {
+
+	cql := conflictingRelationships(edges) +
+		"WHERE size(targets) > 0 OR size(origins) > 0 " +
+		"RETURN row.index AS index, row.from AS from, row.to AS to, targets, origins"
+
+	result, err := q.db.Run(ctx, cql, conflictParams(edges, origins, targets))
+	if err != nil {
+		return nil, err
+	}
+
+	var violations []models.CardinalityViolation
+	for result.Next(ctx) {
+		rec := result.Record()
+		index, _ := rec.Get("index")
+		from, _ := rec.Get("from")
+		to, _ := rec.Get("to")
+		for _, related := range []struct{ key, record string }{{"targets", from.(string)}, {"origins", to.(string)}} {
+			ids, _ := rec.Get(related.key)
+			if len(ids.([]interface{})) == 0 {
+				continue
+			}
+			violations = append(violations, models.CardinalityViolation{
+				Index: int(index.(int64)),
+				Reason: fmt.Sprintf("record %s is already related to record %s", related.record,
+					shared.StringOrEmpty(ids.([]interface{})[0])),
+			})
+		}
+	}
+	if err = result.Err(); err != nil {
+		return nil, err
+	}
+
+	return violations, nil
+}
+
+// DeleteConflictingRecordRelationships deletes the existing relationships that conflict with relating the pairs of
+// origin and target records, and returns the number of deleted relationships.
+func (q *NeoQueries) DeleteConflictingRecordRelationships(ctx context.Context, edges recordRelationshipEdges,
+	origins []string, targets []string) (int64, error) {
+
+	cql := conflictingRelationships(edges) +
+		"UNWIND targetEdges + originEdges AS e " +
+		"WITH DISTINCT e " +
+		"DELETE e " +
+		"RETURN count(e) AS count"
+
+	return q.deleteCount(ctx, cql, conflictParams(edges, origins, targets))
+}
+
+// conflictParams returns the parameters of conflictingRelationships.
+func conflictParams(edges recordRelationshipEdges, origins []string, targets []string) map[string]interface{} {
+	batch := make([]map[string]interface{}, len(origins))
+	for i := range origins {
+		batch[i] = map[string]interface{}{"index": i, "from": origins[i], "to": targets[i]}
+	}
+
+	return map[string]interface{}{
+		"batch":       batch,
+		"originModel": edges.originModel,
+		"targetModel": edges.targetModel,
+		"oneToOne":    edges.oneToOne,
+	}
+}
+
+// cardinalityViolations returns a violation for each pair of origin and target records that conflicts with a pair
+// earlier in the lists. A target is related to a single origin, and with a OneToOne cardinality, an origin is
+// related to a single target. Repeated pairs do not conflict.
+func cardinalityViolations(cardinality string, origins []string, targets []string) []models.CardinalityViolation {
+	originOf := make(map[string]string)
+	targetOf := make(map[string]string)
+
+	var violations []models.CardinalityViolation
+	for i := range origins {
+		origin, target := origins[i], targets[i]
+		if prev, found := originOf[target]; found && prev != origin {
+			violations = append(violations, models.CardinalityViolation{
+				Index: i, Reason: fmt.Sprintf("record %s is related to record %s earlier in the request", target, prev)})
+			continue
+		}
+		if prev, found := targetOf[origin]; found && prev != target && cardinality == models.OneToOne {
+			violations = append(violations, models.CardinalityViolation{
+				Index: i, Reason: fmt.Sprintf("record %s is related to record %s earlier in the request", origin, prev)})
+			continue
+		}
+		originOf[target] = origin
+		targetOf[origin] = target
+	}
+
+	return violations
+}
+
+// singleModelRelationship runs a query that returns a single model relationship, and returns an
+// UnknownModelRelationshipError when the query does not return a relationship.
+func (q *NeoQueries) singleModelRelationship(ctx context.Context, cql string, params map[string]interface{},
+	relationshipId string) (*models.ModelRelationship, error) {
+
+	result, err := q.db.Run(ctx, cql, params)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := result.Collect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, &models.UnknownModelRelationshipError{ID: relationshipId}
+	}
+
+	r := parseModelRelationship(records[0])
+	return &r, nil
+}
+
+// parseModelRelationship returns the model relationship in a record that is returned by modelRelationshipReturn.
+func parseModelRelationship(rec *neo4j.Record) models.ModelRelationship {
+	rr, _ := rec.Get("r")
+	props := rr.(dbtype.Relationship).Props
+
+	from, _ := rec.Get("from")
+	to, _ := rec.Get("to")
+
+	r := models.ModelRelationship{
+		ID:          shared.StringOrEmpty(props["id"]),
+		Type:        shared.StringOrEmpty(props["type"]),
+		DisplayName: shared.StringOrEmpty(props["display_name"]),
+		From:        shared.StringOrEmpty(from),
+		To:          shared.StringOrEmpty(to),
+		Cardinality: relationshipCardinality(props["cardinality"], props["one_to_many"]),
+		CreatedBy:   shared.StringOrEmpty(props["created_by"]),
+		UpdatedBy:   shared.StringOrEmpty(props["updated_by"]),
+	}
+	r.CreatedAt, _ = props["created_at"].(time.Time)
+	r.UpdatedAt, _ = props["updated_at"].(time.Time)
+
+	return r
+}
+
+// relationshipCardinality returns the cardinality of a model relationship from its cardinality and one_to_many
+// properties. Relationships that were created before the cardinality was stored have a one_to_many flag instead,
+// which is one-to-many when true and one-to-one when false. Relationships without either do not constrain the
+// records they relate.
+func relationshipCardinality(cardinality interface{}, oneToMany interface{}) string {
+	if c := shared.StringOrEmpty(cardinality); c != "" {
+		return c
+	}
+
+	switch oneToMany {
+	case true:
+		return models.OneToMany
+	case false:
+		return models.OneToOne
+	default:
+		return models.ManyToMany
+	}
+}
@@ -0,0 +1,245 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j/dbtype"
+	"github.com/pennsieve/model-service-serverless/api/models"
+	"github.com/pennsieve/model-service-serverless/api/models/query"
+	"github.com/pennsieve/model-service-serverless/api/shared"
+	"time"
+)
+
+// savedQueryReturn returns a saved query with its creator and last updater, which parseSavedQuery parses.
+const savedQueryReturn = "MATCH (q)-[created:`@CREATED_BY`]->(c:User) " +
+	"MATCH (q)-[updated:`@UPDATED_BY`]->(u:User) " +
+	"RETURN q, c.node_id AS created_by, created.at AS created_at, u.node_id AS updated_by, updated.at AS updated_at"
+
+// CreateSavedQuery stores a query with a name and description in a dataset, and links it to the user.
+func (q *NeoQueries) CreateSavedQuery(ctx context.Context, datasetId int, organizationId int, name string,
+	description string, req query.QueryRequestBody, userId string) (*query.SavedQuery, error) {
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	cql := "MATCH (d:Dataset{id: $datasetId})-[:`@IN_ORGANIZATION`]->(:Organization{id: $organizationId}) " +
+		"MERGE (u:User{node_id: $userId}) " +
+		"CREATE (q:SavedQuery{id: randomUUID(), name: $name, description: $description, query: $query}) " +
+		"CREATE (q)-[:`@IN_DATASET`]->(d) " +
+		"CREATE (q)-[:`@CREATED_BY` {at: datetime()}]->(u) " +
+		"CREATE (q)-[:`@UPDATED_BY` {at: datetime()}]->(u) " +
+		"WITH q " + savedQueryReturn
+
+	params := map[string]interface{}{
+		"datasetId":      datasetId,
+		"organizationId": organizationId,
+		"userId":         userId,
+		"name":           name,
+		"description":    description,
+		"query":          string(body),
+	}
+
+	return q.singleSavedQuery(ctx, cql, params, name)
+}
+
+// GetSavedQueries returns the saved queries of a dataset, ordered by name.
+func (q *NeoQueries) GetSavedQueries(ctx context.Context, datasetId int, organizationId int) ([]query.SavedQuery, error) {
+
+	cql := "MATCH (q:SavedQuery)-[:`@IN_DATASET`]->(:Dataset{id: $datasetId})" +
+		"-[:`@IN_ORGANIZATION`]->(:Organization{id: $organizationId}) " +
+		"WITH q ORDER BY q.name " + savedQueryReturn
+
+	params := map[string]interface{}{
+		"datasetId":      datasetId,
+		"organizationId": organizationId,
+	}
+
+	result, err := q.db.Run(ctx, cql, params)
+	if err != nil {
+		return nil, err
+	}
+
+	savedQueries := []query.SavedQuery{}
+	for result.Next(ctx) {
+		s, err := parseSavedQuery(result.Record())
+		if err != nil {
+			return nil, err
+		}
+		savedQueries = append(savedQueries, *s)
+	}
+	if err = result.Err(); err != nil {
+		return nil, err
+	}
+
+	return savedQueries, nil
+}
+
+// GetSavedQuery returns a saved query of a dataset by its id.
+func (q *NeoQueries) GetSavedQuery(ctx context.Context, datasetId int, organizationId int, savedQueryId string) (
+	*query.SavedQuery, error) {
+
+	cql := "MATCH (q:SavedQuery{id: $savedQueryId})-[:`@IN_DATASET`]->(:Dataset{id: $datasetId})" +
+		"-[:`@IN_ORGANIZATION`]->(:Organization{id: $organizationId}) " +
+		"WITH q " + savedQueryReturn
+
+	params := map[string]interface{}{
+		"savedQueryId":   savedQueryId,
+		"datasetId":      datasetId,
+		"organizationId": organizationId,
+	}
+
+	return q.singleSavedQuery(ctx, cql, params, savedQueryId)
+}
+
+// UpdateSavedQuery replaces the name, description and query of a saved query and sets the user as the last updater.
+// Nil values leave the existing value unchanged.
+func (q *NeoQueries) UpdateSavedQuery(ctx context.Context, datasetId int, organizationId int, savedQueryId string,
+	name *string, description *string, req *query.QueryRequestBody, userId string) (*query.SavedQuery, error) {
+
+	var body *string
+	if req != nil {
+		b, err := json.Marshal(req)
+		if err != nil {
+			return nil, err
+		}
+		s := string(b)
+		body = &s
+	}
+
+	cql := "MATCH (q:SavedQuery{id: $savedQueryId})-[:`@IN_DATASET`]->(:Dataset{id: $datasetId})" +
+		"-[:`@IN_ORGANIZATION`]->(:Organization{id: $organizationId}) " +
+		"MERGE (u:User{node_id: $userId}) " +
+		"WITH q, u " +
+		"OPTIONAL MATCH (q)-[updated:`@UPDATED_BY`]->(:User) " +
+		"DELETE updated " +
+		"WITH DISTINCT q, u " +
+		"SET q.name = COALESCE($name, q.name), " +
+		"q.description = COALESCE($description, q.description), " +
+		"q.query = COALESCE($query, q.query) " +
+		"CREATE (q)-[:`@UPDATED_BY` {at: datetime()}]->(u) " +
+		"WITH q " + savedQueryReturn
+
+	params := map[string]interface{}{
+		"savedQueryId":   savedQueryId,
+		"datasetId":      datasetId,
+		"organizationId": organizationId,
+		"userId":         userId,
+		"name":           name,
+		"description":    description,
+		"query":          body,
+	}
+
+	return q.singleSavedQuery(ctx, cql, params, savedQueryId)
+}
+
+// DeleteSavedQuery removes a saved query from a dataset.
+func (q *NeoQueries) DeleteSavedQuery(ctx context.Context, datasetId int, organizationId int, savedQueryId string) error {
+
+	cql := "MATCH (q:SavedQuery{id: $savedQueryId})-[:`@IN_DATASET`]->(:Dataset{id: $datasetId})" +
+		"-[:`@IN_ORGANIZATION`]->(:Organization{id: $organizationId}) " +
+		"DETACH DELETE q " +
+		"RETURN count(q) AS count"
+
+	params := map[string]interface{}{
+		"savedQueryId":   savedQueryId,
+		"datasetId":      datasetId,
+		"organizationId": organizationId,
+	}
+
+	result, err := q.db.Run(ctx, cql, params)
+	if err != nil {
+		return err
+	}
+
+	rec, err := result.Single(ctx)
+	if err != nil {
+		return err
+	}
+
+	if cnt, _ := rec.Get("count"); cnt.(int64) == 0 {
+		return &models.UnknownSavedQueryError{ID: savedQueryId}
+	}
+
+	return nil
+}
+
+// SavedQueryNameExists reports whether a saved query other than the saved query with the provided id has the name.
+func (q *NeoQueries) SavedQueryNameExists(ctx context.Context, datasetId int, organizationId int, name string,
+	savedQueryId string) (bool, error) {
+
+	cql := "MATCH (q:SavedQuery{name: $name})-[:`@IN_DATASET`]->(:Dataset{id: $datasetId})" +
+		"-[:`@IN_ORGANIZATION`]->(:Organization{id: $organizationId}) " +
+		"WHERE q.id <> $savedQueryId " +
+		"RETURN count(q) AS count"
+
+	params := map[string]interface{}{
+		"name":           name,
+		"savedQueryId":   savedQueryId,
+		"datasetId":      datasetId,
+		"organizationId": organizationId,
+	}
+
+	result, err := q.db.Run(ctx, cql, params)
+	if err != nil {
+		return false, err
+	}
+
+	rec, err := result.Single(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	cnt, _ := rec.Get("count")
+	return cnt.(int64) > 0, nil
+}
+
+// singleSavedQuery runs a query that returns a single saved query, and returns an UnknownSavedQueryError when the
+// query does not return a saved query.
+func (q *NeoQueries) singleSavedQuery(ctx context.Context, cql string, params map[string]interface{}, id string) (
+	*query.SavedQuery, error) {
+
+	result, err := q.db.Run(ctx, cql, params)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := result.Collect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, &models.UnknownSavedQueryError{ID: id}
+	}
+
+	return parseSavedQuery(records[0])
+}
+
+// parseSavedQuery returns the saved query in a record that is returned by savedQueryReturn.
+func parseSavedQuery(rec *neo4j.Record) (*query.SavedQuery, error) {
+	qn, _ := rec.Get("q")
+	node := qn.(dbtype.Node)
+
+	s := query.SavedQuery{
+		ID:          shared.StringOrEmpty(node.Props["id"]),
+		Name:        shared.StringOrEmpty(node.Props["name"]),
+		Description: shared.StringOrEmpty(node.Props["description"]),
+	}
+	if err := json.Unmarshal([]byte(shared.StringOrEmpty(node.Props["query"])), &s.Query); err != nil {
+		return nil, err
+	}
+
+	createdBy, _ := rec.Get("created_by")
+	s.CreatedBy = shared.StringOrEmpty(createdBy)
+	createdAt, _ := rec.Get("created_at")
+	s.CreatedAt, _ = createdAt.(time.Time)
+
+	updatedBy, _ := rec.Get("updated_by")
+	s.UpdatedBy = shared.StringOrEmpty(updatedBy)
+	updatedAt, _ := rec.Get("updated_at")
+	s.UpdatedAt, _ = updatedAt.(time.Time)
+
+	return &s, nil
+}
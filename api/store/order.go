@@ -0,0 +1,204 @@
+package store
+
+import (
+	"fmt"
+	"github.com/pennsieve/model-service-serverless/api/models"
+	"github.com/pennsieve/model-service-serverless/api/models/query"
+	"strings"
+)
+
+// orderColumn is a property by which the records of a query are ordered. Records without a value for a column with
+// nullsLast are ordered last in both directions.
+type orderColumn struct {
+	model      string
+	property   string
+	descending bool
+	nullsLast  bool
+	dataType   models.DataType
+}
+
+func (c orderColumn) String() string {
+	direction := query.ASCENDING
+	if c.descending {
+		direction = query.DESCENDING
+	}
+	return fmt.Sprintf("%s.%s %s", c.model, c.property, direction)
+}
+
+// orderColumns validates the entries of an order against the properties of the models, and returns the columns by
+// which the records are ordered. Records with the same values are ordered by their sort key. Records without a
+// related record, or without a value for the property of the related records, are ordered last. Entries must have a
+// model, see query.OrderByList.WithModel.
+func orderColumns(sourceModel models.Model, orderBy query.OrderByList,
+	modelProps map[string][]models.ModelProperty) ([]orderColumn, error) {
+
+	var columns []orderColumn
+	for _, o := range orderBy {
+		switch strings.ToLower(o.Direction) {
+		case "", query.ASCENDING, query.DESCENDING:
+		default:
+			return nil, &models.InvalidOrderByError{Reason: fmt.Sprintf("unsupported direction: %s", o.Direction)}
+		}
+
+		prop, err := findProperty(modelProps, o.Model, o.Property)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, orderColumn{model: o.Model, property: prop.Name, descending: o.Descending(),
+			nullsLast: o.Model != sourceModel.Name, dataType: prop.DataType})
+	}
+
+	return append(columns, orderColumn{
+		model: sourceModel.Name, property: "@sort_key", dataType: models.DataType{Type: models.LONG}}), nil
+}
+
+// orderSignature describes the order of the columns, so a cursor is only used for the order it was created for.
+func orderSignature(columns []orderColumn) string {
+	var s []string
+	for _, c := range columns {
+		s = append(s, c.String())
+	}
+	return strings.Join(s, ",")
+}
+
+// compileResults writes the projection of a query for a page of records on the MATCH and WHERE clauses that
+// generateQuery builds. Records are returned as records, and when properties of related models order the records,
+// the values by which the records are ordered as `@o0`, `@o1`, ... Up to query.MaxLinkedRecords + 1 records of the
+// included models that are linked to a record are returned as linked.
+func compileResults(b *cypherBuilder, sourceModel models.Model, orderBy query.OrderByList,
+	formatParams query.FormatParams, modelProps map[string][]models.ModelProperty, limit int, offset int,
+	hasWhereClause bool) error {
+
+	columns, err := orderColumns(sourceModel, orderBy, modelProps)
+	if err != nil {
+		return err
+	}
+
+	// Properties of the source model are ordered by directly, and properties of related models by their lowest or
+	// highest value per record. Returned records are ordered by the same expressions on records.
+	source := identifier(sourceModel.Name)
+	var aggregates, aggregated []string
+	expressions := make([]string, len(columns))
+	returned := make([]string, len(columns))
+	for i, c := range columns {
+		if c.model == sourceModel.Name {
+			expressions[i] = source + "." + identifier(c.property)
+			returned[i] = "records." + identifier(c.property)
+			continue
+		}
+
+		fn := "min"
+		if c.descending {
+			fn = "max"
+		}
+		expressions[i] = fmt.Sprintf("`@o%d`", i)
+		returned[i] = expressions[i]
+		aggregates = append(aggregates,
+			fmt.Sprintf("%s(%s.%s) AS %s", fn, identifier(c.model), identifier(c.property), expressions[i]))
+		aggregated = append(aggregated, expressions[i])
+	}
+
+	// Records are grouped by the aggregation, and otherwise returned once
+	distinct := "DISTINCT "
+	if len(aggregates) > 0 {
+		b.write("WITH ", source, ", ", strings.Join(aggregates, ", "), " ")
+		distinct = ""
+		hasWhereClause = false
+	}
+
+	if after := formatParams.After; after != nil {
+		if hasWhereClause {
+			b.write("AND ")
+		} else {
+			b.write("WHERE ")
+		}
+		b.write(seekPredicate(b, columns, expressions, after.Keys), " ")
+	}
+
+	variables := append([]string{source}, aggregated...)
+	if len(formatParams.Include) == 0 {
+		b.write("RETURN ", distinct, source, " AS records")
+		for _, a := range aggregated {
+			b.write(", ", a)
+		}
+		b.write(" ORDER BY ", orderExpressions(columns, expressions), " SKIP ", b.param(offset),
+			" LIMIT ", b.param(limit))
+		return nil
+	}
+
+	// Select the page of records before matching the linked records, so records without linked records are
+	// returned, and each record is returned once.
+	var includeIds []string
+	for _, m := range formatParams.Include {
+		includeIds = append(includeIds, m.ID)
+	}
+	b.write("WITH ", distinct, strings.Join(variables, ", "), " ORDER BY ", orderExpressions(columns, expressions),
+		" SKIP ", b.param(offset), " LIMIT ", b.param(limit), " ",
+		"OPTIONAL MATCH (", source, ")-[`@relationship`]-(`@linked`:Record)-[:`@INSTANCE_OF`]->(`@model`:Model) ",
+		"WHERE `@model`.id IN ", b.param(includeIds), " ",
+		"RETURN ", source, " AS records")
+	for _, a := range aggregated {
+		b.write(", ", a)
+	}
+	// One linked record more than the maximum is returned, so the linked records are known to be truncated
+	b.write(", collect(DISTINCT {relationship: type(`@relationship`), model: `@model`.id, record: `@linked`})",
+		"[..", b.param(query.MaxLinkedRecords+1), "] AS linked ORDER BY ", orderExpressions(columns, returned))
+
+	return nil
+}
+
+// orderExpressions returns the ORDER BY expressions of the columns. Null values are ordered last in ascending
+// order, and first in descending order unless the column orders them last.
+func orderExpressions(columns []orderColumn, expressions []string) string {
+	order := make([]string, len(columns))
+	for i, c := range columns {
+		order[i] = expressions[i]
+		if c.descending {
+			order[i] += " DESC"
+			if c.nullsLast {
+				order[i] = expressions[i] + " IS NULL, " + order[i]
+			}
+		}
+	}
+	return strings.Join(order, ", ")
+}
+
+// seekPredicate returns the condition that matches the records after the record with the keys, in the order of the
+// columns. Records without a value are ordered last in ascending order, and first in descending order unless the
+// column orders them last.
+func seekPredicate(b *cypherBuilder, columns []orderColumn, expressions []string, keys []interface{}) string {
+	// Records are after the record when they have the same values for the previous columns, and a value after the
+	// key of the record for the column.
+	var alternatives, equal []string
+	for i, c := range columns {
+		e := expressions[i]
+
+		var after, key string
+		switch {
+		case keys[i] == nil && c.descending && !c.nullsLast:
+			after = e + " IS NOT NULL"
+		case keys[i] == nil:
+			// No records are ordered after the records without a value when they are ordered last
+		case c.descending && c.nullsLast:
+			key = b.param(keys[i])
+			after = fmt.Sprintf("(%s < %s OR %s IS NULL)", e, key, e)
+		case c.descending:
+			key = b.param(keys[i])
+			after = e + " < " + key
+		default:
+			key = b.param(keys[i])
+			after = fmt.Sprintf("(%s > %s OR %s IS NULL)", e, key, e)
+		}
+
+		if after != "" {
+			alternatives = append(alternatives, "("+strings.Join(append(equal, after), " AND ")+")")
+		}
+		if key == "" {
+			equal = append(equal, e+" IS NULL")
+		} else {
+			equal = append(equal, e+" = "+key)
+		}
+	}
+
+	return "(" + strings.Join(alternatives, " OR ") + ")"
+}
@@ -2,6 +2,8 @@ package store
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"github.com/pennsieve/model-service-serverless/api/models"
 	pgQueries "github.com/pennsieve/pennsieve-go-core/pkg/queries/pgdb"
 	log "github.com/sirupsen/logrus"
@@ -88,3 +90,21 @@ func (q *ModelServicePgQueries) GetPackageAncestors(ctx context.Context, package
 	// return empty if no ancestors (should not happen)
 	return result, nil
 }
+
+// GetPackage returns a package by its node id, and returns an UnknownPackageError when the package does not exist.
+func (q *ModelServicePgQueries) GetPackage(ctx context.Context, packageNodeId string) (*models.Package, error) {
+
+	queryStr := "SELECT id, node_id, name, dataset_id, state FROM packages WHERE node_id = $1"
+
+	var p models.Package
+	err := q.db.QueryRowContext(ctx, queryStr, packageNodeId).Scan(&p.ID, &p.NodeID, &p.Name, &p.DatasetID, &p.State)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &models.UnknownPackageError{NodeID: packageNodeId}
+	}
+	if err != nil {
+		log.Error("Unable to get package: ", err)
+		return nil, err
+	}
+
+	return &p, nil
+}
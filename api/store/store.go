@@ -3,29 +3,61 @@ package store
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j/dbtype"
 	"github.com/pennsieve/model-service-serverless/api/models"
 	"github.com/pennsieve/model-service-serverless/api/models/query"
 	"github.com/pennsieve/model-service-serverless/api/shared"
+	"github.com/pennsieve/pennsieve-go-core/pkg/models/packageInfo/packageState"
 	log "github.com/sirupsen/logrus"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
 )
 
 // ModelServiceStore provides the Queries interface and a db instance.
 type ModelServiceStore struct {
-	neo   *NeoQueries
-	neodb *shared.Neo4jSession
-	pgdb  *sql.DB
-	pg    *ModelServicePgQueries
+	neo            *NeoQueries
+	neodb          *shared.Neo4jSession
+	driver         neo4j.DriverWithContext
+	pgdb           *sql.DB
+	pg             *ModelServicePgQueries
+	maxRecordLinks int
 }
 
+// DefaultMaxRecordLinks is the maximum number of pairs of records that a request relates, unless the store is
+// configured with another maximum.
+const DefaultMaxRecordLinks = 10000
+
 // NewModelServiceStore returns a UploadHandlerStore object which implements the Queries
 func NewModelServiceStore(db *sql.DB, neo *shared.Neo4jSession) *ModelServiceStore {
 	return &ModelServiceStore{
-		pgdb:  db,
-		pg:    NewModelServicePgQueries(db),
-		neo:   NewNeoQueries(neo),
-		neodb: neo,
+		pgdb:           db,
+		pg:             NewModelServicePgQueries(db),
+		neo:            NewNeoQueries(neo),
+		neodb:          neo,
+		maxRecordLinks: DefaultMaxRecordLinks,
+	}
+}
+
+// WithMaxRecordLinks sets the maximum number of pairs of records that a request relates. A maximum that is not
+// positive leaves the default maximum.
+func (s *ModelServiceStore) WithMaxRecordLinks(max int) *ModelServiceStore {
+	if max > 0 {
+		s.maxRecordLinks = max
 	}
+	return s
+}
+
+// WithDriver sets the driver of the session of the store, which the store uses to run read queries concurrently on
+// separate sessions.
+func (s *ModelServiceStore) WithDriver(driver neo4j.DriverWithContext) *ModelServiceStore {
+	s.driver = driver
+	return s
 }
 
 // WithOrg sets the search path for the pg queries
@@ -63,10 +95,17 @@ func (s *ModelServiceStore) execTx(ctx context.Context, fn func(queries *NeoQuer
 	return tx.Commit(ctx)
 }
 
-func (s *ModelServiceStore) CreateModelTx(ctx context.Context, datasetId int, organizationId int, name string, displayName string, description string, userId string) (*models.Model, error) {
+// CreateModelTx creates a model in a dataset and ensures the organization and dataset nodes exist.
+func (s *ModelServiceStore) CreateModelTx(ctx context.Context, datasetId int, organizationId int, datasetNodeId string,
+	organizationNodeId string, name string, displayName string, description string, userId string) (*models.Model, error) {
 
 	var createdModel *models.Model
 	err := s.execTx(ctx, func(qtx *NeoQueries) error {
+		// Dataset node does not exist in the graph until the first model is created.
+		if err := qtx.InitOrgAndDataset(ctx, organizationId, datasetId, organizationNodeId, datasetNodeId); err != nil {
+			return err
+		}
+
 		var err error
 		createdModel, err = qtx.CreateModel(ctx, datasetId, organizationId, name, displayName, description, userId)
 		return err
@@ -79,148 +118,1704 @@ func (s *ModelServiceStore) CreateModelTx(ctx context.Context, datasetId int, or
 
 }
 
-// UpdateModelPropertiesTx adds or replaces properties in a Model
-func (s *ModelServiceStore) UpdateModelPropertiesTx(ctx context.Context) {
+// UpdateModelTx updates the display name and description of a model.
+func (s *ModelServiceStore) UpdateModelTx(ctx context.Context, datasetId int, organizationId int, modelId string,
+	displayName *string, description *string, userId string) (*models.Model, error) {
+
+	var updatedModel *models.Model
+	err := s.execTx(ctx, func(qtx *NeoQueries) error {
+		var err error
+		updatedModel, err = qtx.UpdateModel(ctx, datasetId, organizationId, modelId, displayName, description, userId)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updatedModel, nil
+}
+
+// DeleteModelTx deletes a model from a dataset.
+// Models with records can only be deleted when cascade is set, in which case the records are deleted as well.
+func (s *ModelServiceStore) DeleteModelTx(ctx context.Context, datasetId int, organizationId int, modelId string, cascade bool) error {
+
+	return s.execTx(ctx, func(qtx *NeoQueries) error {
+		model, err := qtx.GetModelById(ctx, datasetId, organizationId, modelId)
+		if err != nil {
+			return err
+		}
+
+		if model.Count > 0 && !cascade {
+			return &models.ModelHasRecordsError{Name: model.Name, Count: model.Count}
+		}
+
+		nrDeleted, err := qtx.DeleteModel(ctx, datasetId, organizationId, modelId)
+		if err != nil {
+			return err
+		}
 
+		log.Debug(fmt.Sprintf("Deleted model %s with %d records", model.Name, nrDeleted))
+		return nil
+	})
 }
 
-func (s *ModelServiceStore) GetDatasetModels(ctx context.Context, datasetId int, organizationId int) ([]models.Model, error) {
-	// Get the models from Neo4J
-	results, err := s.neo.GetModels(ctx, datasetId, organizationId)
+// UpdateModelPropertiesTx adds, replaces or removes properties in a Model
+func (s *ModelServiceStore) UpdateModelPropertiesTx(ctx context.Context, datasetId int, organizationId int, modelId string,
+	req models.UpdateModelPropertiesRequestBody) ([]models.ModelProperty, error) {
+
+	var updatedProps []models.ModelProperty
+	err := s.execTx(ctx, func(qtx *NeoQueries) error {
+		model, err := qtx.GetModelById(ctx, datasetId, organizationId, modelId)
+		if err != nil {
+			return err
+		}
+
+		existingProps, err := qtx.GetModelProps(ctx, datasetId, organizationId, model.Name)
+		if err != nil {
+			return err
+		}
+
+		props, removed, retyped, err := mergeModelProperties(existingProps, req)
+		if err != nil {
+			return err
+		}
+
+		// Properties that are removed or change data type can only be updated when no records use them,
+		// or when the caller explicitly requests records to be migrated.
+		usage := make(map[string]int64)
+		for _, name := range append(removed, retyped...) {
+			cnt, err := qtx.CountPropertyUsage(ctx, modelId, name)
+			if err != nil {
+				return err
+			}
+			if cnt > 0 && !req.Migrate {
+				return &models.PropertyInUseError{PropName: name, Count: cnt}
+			}
+			usage[name] = cnt
+		}
+
+		if len(removed) > 0 {
+			for _, name := range removed {
+				if err = qtx.RemoveRecordProperty(ctx, modelId, name); err != nil {
+					return err
+				}
+			}
+
+			if err = qtx.DeleteModelProperties(ctx, modelId, removed); err != nil {
+				return err
+			}
+		}
+
+		for _, name := range retyped {
+			for _, p := range props {
+				if p.Name != name {
+					continue
+				}
+
+				// Values that cannot be converted are not removed, even when migrating
+				if usage[name] == 0 {
+					continue
+				}
+				conversion, canConvert := propertyConversions[p.DataType.Type]
+				if !canConvert || p.DataType.IsArray {
+					return &models.PropertyConversionError{PropName: name, DataType: p.DataType.Type, Count: usage[name]}
+				}
+
+				cnt, err := qtx.CountUnconvertibleProperty(ctx, modelId, name, conversion)
+				if err != nil {
+					return err
+				}
+				if cnt > 0 {
+					return &models.PropertyConversionError{PropName: name, DataType: p.DataType.Type, Count: cnt}
+				}
+				if err = qtx.ConvertRecordProperty(ctx, modelId, name, conversion); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err = qtx.UpsertModelProperties(ctx, modelId, props); err != nil {
+			return err
+		}
+
+		updatedProps, err = qtx.GetModelProps(ctx, datasetId, organizationId, model.Name)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	var models []models.Model
-	for _, v := range results {
-		models = append(models, v)
+	return updatedProps, nil
+}
+
+// CreateRecordTx validates the values against the model properties and creates a record.
+func (s *ModelServiceStore) CreateRecordTx(ctx context.Context, datasetId int, organizationId int, modelIdOrName string,
+	values map[string]interface{}, userId string) (*models.Record, error) {
+
+	var record *models.Record
+	err := s.execTx(ctx, func(qtx *NeoQueries) error {
+		model, validValues, err := validateRecord(ctx, qtx, datasetId, organizationId, modelIdOrName, values)
+		if err != nil {
+			return err
+		}
+
+		record, err = qtx.CreateRecord(ctx, *model, validValues, userId)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return models, nil
+	return record, nil
 }
 
-func (s *ModelServiceStore) QueryGraph(ctx context.Context, req query.QueryRequestBody, datasetId int,
-	organizationId int) (*query.QueryResponse, error) {
+// GetRecord returns a single record of a model.
+func (s *ModelServiceStore) GetRecord(ctx context.Context, datasetId int, organizationId int, modelIdOrName string,
+	recordId string) (*models.Record, error) {
 
-	modelMap, err := s.neo.GetModels(ctx, datasetId, organizationId)
+	model, err := getModel(ctx, s.neo, datasetId, organizationId, modelIdOrName)
 	if err != nil {
-		log.Println(err)
+		return nil, err
 	}
 
-	sourceModel, inMap := modelMap[req.Model]
-	if inMap == false {
-		return nil, &models.UnknownModelError{Model: req.Model}
+	return s.neo.GetRecord(ctx, *model, recordId)
+}
+
+// UpdateRecordTx validates the values against the model properties and replaces the values of a record.
+func (s *ModelServiceStore) UpdateRecordTx(ctx context.Context, datasetId int, organizationId int, modelIdOrName string,
+	recordId string, values map[string]interface{}, userId string) (*models.Record, error) {
+
+	var record *models.Record
+	err := s.execTx(ctx, func(qtx *NeoQueries) error {
+		model, validValues, err := validateRecord(ctx, qtx, datasetId, organizationId, modelIdOrName, values)
+		if err != nil {
+			return err
+		}
+
+		record, err = qtx.UpdateRecord(ctx, *model, recordId, validValues, userId)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// Use default ordering unless specifically defined
-	orderBy := req.OrderBy
-	if orderBy == "" {
-		orderBy = "`@sort_key`"
-	} else {
-		//	Check if provided value is valid.
-		modelProps, err := s.neo.GetModelProps(ctx, datasetId, organizationId, req.Model)
+	return record, nil
+}
+
+// DeleteRecordTx deletes a record and its relationships.
+func (s *ModelServiceStore) DeleteRecordTx(ctx context.Context, datasetId int, organizationId int, modelIdOrName string,
+	recordId string) error {
+
+	return s.execTx(ctx, func(qtx *NeoQueries) error {
+		model, err := getModel(ctx, qtx, datasetId, organizationId, modelIdOrName)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		propFound := false
-		for _, v := range modelProps {
-			if v.Name == req.OrderBy {
-				orderBy = req.OrderBy
-				propFound = true
-				break
-			}
+		return qtx.DeleteRecord(ctx, *model, recordId)
+	})
+}
+
+// batchSize is the maximum number of records that are written in a single UNWIND statement.
+const batchSize = 1000
+
+// CreateRecordsBatchTx validates and creates a batch of records for a model in a single transaction.
+// Rows that fail validation are reported in the response and are not written. When upsert is set, rows
+// are matched to existing records on the model-title property and existing records are replaced.
+func (s *ModelServiceStore) CreateRecordsBatchTx(ctx context.Context, datasetId int, organizationId int, modelIdOrName string,
+	rows []models.RecordRequestBody, upsert bool, userId string) (*models.BatchRecordResponse, error) {
+
+	response := models.BatchRecordResponse{Results: make([]models.BatchRecordResult, len(rows))}
+	err := s.execTx(ctx, func(qtx *NeoQueries) error {
+		model, err := getModel(ctx, qtx, datasetId, organizationId, modelIdOrName)
+		if err != nil {
+			return err
+		}
+		response.Model = model.Name
+
+		modelProps, err := qtx.GetModelProps(ctx, datasetId, organizationId, model.Name)
+		if err != nil {
+			return err
 		}
 
-		if !propFound {
-			return nil, &models.UnknownModelPropertyError{PropName: req.OrderBy}
+		values := make([]map[string]interface{}, len(rows))
+		for i, row := range rows {
+			values[i] = row.Props
 		}
+
+		return writeRecordsBatch(ctx, qtx, *model, modelProps, values, response.Results, upsert, false, userId)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	countBatchResults(&response)
+	return &response, nil
+}
+
+// ImportRecordsTx imports the rows of a delimited text file as records of a model in a single transaction.
+// Columns are mapped onto model properties, and values are converted to the data types of the properties. Columns
+// without a matching property are ignored unless properties can be created, in which case the data type of the new
+// property is inferred from the values in the column. In a dry run, rows are validated but nothing is written.
+func (s *ModelServiceStore) ImportRecordsTx(ctx context.Context, datasetId int, organizationId int, modelIdOrName string,
+	header []string, rows [][]string, opts models.ImportOptions, userId string) (*models.ImportRecordsResponse, error) {
+
+	response := models.ImportRecordsResponse{
+		BatchRecordResponse: models.BatchRecordResponse{Results: make([]models.BatchRecordResult, len(rows))},
+		DryRun:              opts.DryRun,
 	}
+	err := s.execTx(ctx, func(qtx *NeoQueries) error {
+		model, err := getModel(ctx, qtx, datasetId, organizationId, modelIdOrName)
+		if err != nil {
+			return err
+		}
+		response.Model = model.Name
+
+		modelProps, err := qtx.GetModelProps(ctx, datasetId, organizationId, model.Name)
+		if err != nil {
+			return err
+		}
+
+		columns, err := models.MapImportColumns(header, modelProps, opts.Mapping)
+		if err != nil {
+			return err
+		}
+
+		// Create properties for columns that do not match an existing property.
+		var newProps []models.ModelPropertyRequest
+		for i, c := range columns {
+			if c.Property == "" || c.Exists {
+				continue
+			}
+
+			if !opts.CreateProperties {
+				if c.Mapped {
+					return &models.UnknownModelPropertyError{PropName: c.Property}
+				}
+				response.IgnoredColumns = append(response.IgnoredColumns, c.Header)
+				columns[i].Property = ""
+				continue
+			}
+
+			var columnValues []string
+			for _, row := range rows {
+				if i < len(row) {
+					columnValues = append(columnValues, row[i])
+				}
+			}
+
+			dataType := models.InferDataType(columnValues)
+			newProps = append(newProps, models.ModelPropertyRequest{
+				Name:         c.Property,
+				DisplayName:  strings.TrimSpace(c.Header),
+				DataType:     &dataType,
+				IsModelTitle: len(modelProps) == 0 && len(newProps) == 0,
+			})
+		}
+
+		if len(newProps) > 0 {
+			props, _, _, err := mergeModelProperties(modelProps, models.UpdateModelPropertiesRequestBody{Properties: newProps})
+			if err != nil {
+				return err
+			}
+
+			for _, p := range props {
+				for _, r := range newProps {
+					if p.Name == r.Name {
+						response.CreatedProperties = append(response.CreatedProperties, p)
+					}
+				}
+			}
+
+			modelProps = props
+			if !opts.DryRun {
+				if err = qtx.UpsertModelProperties(ctx, model.ID, props); err != nil {
+					return err
+				}
+			}
+		}
+
+		hasProperty := false
+		for _, c := range columns {
+			hasProperty = hasProperty || c.Property != ""
+		}
+		if !hasProperty {
+			return &models.ImportError{Reason: "no columns map to properties of model " + model.Name}
+		}
+
+		values := make([]map[string]interface{}, len(rows))
+		for i, row := range rows {
+			v, details := models.ParseImportRow(columns, row, modelProps)
+			if len(details) > 0 {
+				response.Results[i].Status = models.BatchRecordFailed
+				response.Results[i].Errors = details
+				continue
+			}
+			values[i] = v
+		}
 
-	targetModels, err := getTargetModelsMap(req.Filters, sourceModel, modelMap)
+		return writeRecordsBatch(ctx, qtx, *model, modelProps, values, response.Results, opts.Upsert, opts.DryRun, userId)
+	})
 	if err != nil {
-		log.Error("Error getting the target models: ", err)
 		return nil, err
 	}
 
-	shortestPaths, err := s.neo.ShortestPath(ctx, sourceModel, targetModels)
+	countBatchResults(&response.BatchRecordResponse)
+	return &response, nil
+}
+
+func (s *ModelServiceStore) GetDatasetModels(ctx context.Context, datasetId int, organizationId int) ([]models.Model, error) {
+	// Get the models from Neo4J
+	results, err := s.neo.GetModels(ctx, datasetId, organizationId)
 	if err != nil {
-		log.Error("Error getting shortest paths: ", err)
 		return nil, err
 	}
 
-	//TODO: Run following two queries in parallel
-	nodes, err := s.neo.Query(ctx, sourceModel, shortestPaths, req.Filters, orderBy, req.Limit, req.Offset)
+	var models []models.Model
+	for _, v := range results {
+		models = append(models, v)
+	}
+
+	return models, nil
+}
+
+// QueryGraph returns a page of records that match the query, and the total number of matching records unless the
+// query skips the total. The page, the total and the facets are queried concurrently when the store has a driver.
+func (s *ModelServiceStore) QueryGraph(ctx context.Context, req query.QueryRequestBody, datasetId int,
+	organizationId int) (*query.QueryResponse, error) {
+
+	p, err := s.prepareQuery(ctx, req, datasetId, organizationId)
 	if err != nil {
 		return nil, err
 	}
 
-	total, err := s.neo.QueryTotal(ctx, sourceModel, shortestPaths, req.Filters, orderBy, req.Limit, req.Offset)
+	params, offset, err := pageParams(req, p)
 	if err != nil {
 		return nil, err
 	}
+	limit := req.PageLimit()
 
 	res := query.QueryResponse{
 		ModelName: req.Model,
-		Limit:     req.Limit,
-		Offset:    req.Offset,
-		Total:     int(total),
-		Records:   nodes,
+		Limit:     limit,
+		Offset:    offset,
+	}
+
+	queries := []func(ctx context.Context, q *NeoQueries) error{
+		func(ctx context.Context, q *NeoQueries) error {
+			records, last, err := q.Query(ctx, p.sourceModel, p.shortestPaths, p.optionalPaths, p.where, p.modelProps,
+				p.orderBy, limit, offset, params.After, params.Include)
+			if err != nil {
+				return err
+			}
+
+			res.Records = records
+			if len(records) == limit {
+				res.NextCursor = last.Encode()
+			}
+			return nil
+		},
+	}
+	if !req.SkipTotal {
+		queries = append(queries, func(ctx context.Context, q *NeoQueries) error {
+			total, err := q.QueryTotal(ctx, p.sourceModel, p.shortestPaths, p.where, p.modelProps, p.orderBy,
+				req.Limit, req.Offset)
+			if err != nil {
+				return err
+			}
+
+			t := int(total)
+			res.Total = &t
+			return nil
+		})
+	}
+	if len(req.Facets) > 0 {
+		queries = append(queries, func(ctx context.Context, q *NeoQueries) error {
+			facets, err := queryFacets(ctx, q, req.Facets, p)
+			res.Facets = facets
+			return err
+		})
+	}
+
+	if err = s.readConcurrently(ctx, queries...); err != nil {
+		return nil, err
 	}
 
 	return &res, nil
 }
 
-func (s *ModelServiceStore) Autocomplete(ctx context.Context, parsedRequestBody query.AutocompleteRequestBody, datasetId int,
-	organizationId int) ([]string, error) {
+// pageParams returns the parameters of the query for a page of records, with the included models and the decoded
+// cursor, and the offset of the page. The cursor replaces the offset.
+func pageParams(req query.QueryRequestBody, p *preparedQuery) (query.FormatParams, int, error) {
+	params := query.FormatParams{ResultType: query.RESULTS}
+	for _, name := range req.Include {
+		m, inMap := p.modelMap[name]
+		if !inMap {
+			return params, 0, &models.UnknownModelError{Model: name}
+		}
+		params.Include = append(params.Include, m)
+	}
 
-	values, err := s.neo.Autocomplete(ctx, datasetId, organizationId, parsedRequestBody)
+	if req.Cursor == "" {
+		return params, req.Offset, nil
+	}
 
+	after, err := decodeCursor(req.Cursor, p.sourceModel, p.orderBy, p.modelProps)
 	if err != nil {
-		return nil, err
+		return params, 0, err
 	}
+	params.After = after
+	return params, 0, nil
+}
 
-	return values, nil
+// readConcurrently runs read queries concurrently, each on a new read session of the driver of the store. When a
+// query fails, the context of the other queries is cancelled, and the first error is returned. Without a driver,
+// the queries run one after the other on the session of the store.
+func (s *ModelServiceStore) readConcurrently(ctx context.Context, queries ...func(ctx context.Context, q *NeoQueries) error) error {
+	if s.driver == nil {
+		for _, fn := range queries {
+			if err := fn(ctx, s.neo); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, len(queries))
+	for _, fn := range queries {
+		go func(fn func(ctx context.Context, q *NeoQueries) error) {
+			session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+			defer session.Close(context.Background())
+
+			// The error is sent before the context is cancelled, so it is received before the errors of the
+			// queries that fail because of the cancellation.
+			err := fn(ctx, NewNeoQueries(shared.NewNeo4jSession(session)))
+			errs <- err
+			if err != nil {
+				cancel()
+			}
+		}(fn)
+	}
+
+	// The other queries fail with the cancelled context after the first error
+	var firstErr error
+	for range queries {
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
 }
 
-func (s *ModelServiceStore) CreateRelationships(ctx context.Context, parsedRequestBody models.PostRecordRelationshipRequestBody,
-	datasetId int, organizationId int, userNodeId string) ([]models.ShortRecordRelationShip, error) {
+// queryFacets returns the facets of a query. Each facet is counted under the filter tree without the filters on the
+// property of the facet, and joins the models in the remaining filters and the model of the facet.
+func queryFacets(ctx context.Context, q *NeoQueries, facets []query.Facet, p *preparedQuery) ([]query.FacetResult, error) {
+	var results []query.FacetResult
+	for _, facet := range facets {
+		if facet.Model == "" {
+			facet.Model = p.sourceModel.Name
+		}
 
-	var response []models.ShortRecordRelationShip
-	err := s.execTx(ctx, func(qtx *NeoQueries) error {
-		var err error
-		response, err = s.neo.CreateRelationShips(ctx, datasetId, organizationId, userNodeId, parsedRequestBody)
-		return err
-	})
-	if err != nil {
-		return nil, err
+		facetWhere := withoutPropertyFilters(p.where, facet.PropertyRef)
+		targetModels, err := getTargetModelsMap(facetWhere.Leaves(), p.sourceModel, p.modelMap)
+		if err != nil {
+			return nil, err
+		}
+		if err = addTargetModels(targetModels, p.sourceModel, p.modelMap, []string{facet.Model}); err != nil {
+			return nil, err
+		}
+
+		shortestPaths, err := q.ShortestPath(ctx, p.sourceModel, targetModels)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = checkFilterModelsRelated(p.sourceModel, targetModels, shortestPaths); err != nil {
+			return nil, err
+		}
+
+		values, err := q.Facet(ctx, p.sourceModel, shortestPaths, facetWhere, p.modelProps, facet)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, query.FacetResult{Model: facet.Model, Property: facet.Property, Values: values})
 	}
 
-	return response, nil
+	return results, nil
 }
 
-func (s *ModelServiceStore) GetRecordsForPackage(ctx context.Context, datasetId int, organizationId int, packageNodeId string, maxDepth int) ([]models.PackageMetadata, error) {
+// decodeCursor returns the cursor of a page of query results, with the keys as values of the data types of the
+// properties that order the results. A cursor is only valid for queries with the same order.
+func decodeCursor(cursor string, sourceModel models.Model, orderBy query.OrderByList,
+	modelProps map[string][]models.ModelProperty) (*query.Cursor, error) {
 
-	// Get the package and ancestors based on folder structure on the platform
-	packages, err := s.pg.GetPackageAncestors(ctx, packageNodeId)
+	after, err := query.DecodeCursor(cursor)
 	if err != nil {
 		return nil, err
 	}
 
-	log.Debug("Package Ancestors: length: ", len(packages))
+	columns, err := orderColumns(sourceModel, orderBy, modelProps)
+	if err != nil {
+		return nil, err
+	}
+	if after.Order != orderSignature(columns) || len(after.Keys) != len(columns) {
+		return nil, &models.InvalidCursorError{}
+	}
 
-	var packageIds []int
-	for _, p := range packages {
-		packageIds = append(packageIds, int(p.Id))
+	for i, c := range columns {
+		if after.Keys[i], err = c.dataType.Coerce(jsonNumbers(after.Keys[i])); err != nil {
+			return nil, &models.InvalidCursorError{}
+		}
 	}
+	return after, nil
+}
 
-	// Get all records associated with the hierarchical record structure for record and ancestors
-	nodes, err := s.neo.GetRecordsForPackage(ctx, datasetId, organizationId, packageIds, maxDepth)
+// jsonNumbers returns a decoded JSON value in which json.Number values are converted to int64 or float64.
+func jsonNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = jsonNumbers(item)
+		}
+		return result
+	}
+	return value
+}
+
+// maxAggregateGroups is the maximum number of groups that an aggregate query returns.
+const maxAggregateGroups = 1000
 
+// AggregateQueryGraph returns the aggregations of the query over the records that match the query, grouped by the
+// values of the group-by properties. The limit and offset of the query apply to the groups, and at most
+// maxAggregateGroups groups are returned.
+func (s *ModelServiceStore) AggregateQueryGraph(ctx context.Context, req query.QueryRequestBody, datasetId int,
+	organizationId int) (*query.AggregateResponse, error) {
+
+	if req.Aggregate == nil {
+		return nil, &models.InvalidAggregateError{Reason: "aggregate is required"}
+	}
+
+	p, err := s.prepareQuery(ctx, req, datasetId, organizationId)
 	if err != nil {
 		return nil, err
 	}
 
-	return nodes, nil
+	agg := req.Aggregate.WithModel(p.sourceModel.Name)
+	groupBy, aggregations, err := aggregateColumns(agg, p.modelProps)
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := s.neo.Aggregate(ctx, p.sourceModel, p.shortestPaths, p.optionalPaths, p.where, p.modelProps, agg,
+		aggregateLimit(req.Limit), req.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	res := query.AggregateResponse{
+		ModelName:    req.Model,
+		GroupBy:      groupBy,
+		Aggregations: aggregations,
+		Groups:       groups,
+	}
+
+	return &res, nil
+}
+
+// aggregateLimit returns the maximum number of groups that an aggregate query with the requested limit returns.
+func aggregateLimit(limit int) int {
+	if limit <= 0 || limit > maxAggregateGroups {
+		return maxAggregateGroups
+	}
+	return limit
+}
+
+// ExplainQueryGraph returns the queried model, the shortest paths to the models in the query, and the Cypher and
+// parameters of the query that QueryGraph or AggregateQueryGraph runs for the request, without running it. When the
+// request asks for the plan, the execution plan of the query is returned as well.
+func (s *ModelServiceStore) ExplainQueryGraph(ctx context.Context, req query.ExplainRequestBody, datasetId int,
+	organizationId int) (*query.ExplainResponse, error) {
+
+	p, err := s.prepareQuery(ctx, req.QueryRequestBody, datasetId, organizationId)
+	if err != nil {
+		return nil, err
+	}
+
+	var params query.FormatParams
+	var limit, offset int
+	if req.Aggregate != nil {
+		agg := req.Aggregate.WithModel(p.sourceModel.Name)
+		params = query.FormatParams{ResultType: query.AGGREGATE, Aggregate: agg}
+		limit, offset = aggregateLimit(req.Limit), req.Offset
+	} else {
+		params, offset, err = pageParams(req.QueryRequestBody, p)
+		if err != nil {
+			return nil, err
+		}
+		limit = req.PageLimit()
+	}
+
+	cql, cqlParams, err := generateQuery(p.sourceModel, p.shortestPaths, p.optionalPaths, p.where, p.modelProps,
+		p.orderBy, params, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	res := query.ExplainResponse{
+		Model:  p.sourceModel,
+		Paths:  modelPaths(append(p.shortestPaths, p.optionalPaths...)),
+		Cypher: cql,
+		Params: cqlParams,
+	}
+
+	if req.Plan {
+		if res.Plan, err = s.neo.Explain(ctx, cql, cqlParams); err != nil {
+			return nil, err
+		}
+	}
+
+	return &res, nil
+}
+
+// exportPageSize is the number of records that is fetched per query when exporting query results.
+const exportPageSize = 1000
+
+// ExportQueryGraph runs a query and writes all pages of results to w in the requested format, starting at the offset
+// or the cursor of the query. When the query has a limit, at most limit records are written. Each page continues
+// after the cursor of the previous page, so records that are written while exporting do not shift the pages. It
+// returns the number of records written.
+func (s *ModelServiceStore) ExportQueryGraph(ctx context.Context, req query.QueryRequestBody, datasetId int,
+	organizationId int, w io.Writer, format query.ExportFormat) (int, error) {
+
+	p, err := s.prepareQuery(ctx, req, datasetId, organizationId)
+	if err != nil {
+		return 0, err
+	}
+
+	params, offset, err := pageParams(req, p)
+	if err != nil {
+		return 0, err
+	}
+	after := params.After
+
+	writer, err := query.NewRecordWriter(w, format, p.modelProps[p.sourceModel.Name])
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for {
+		limit := exportPageSize
+		if req.Limit > 0 && req.Limit-count < limit {
+			limit = req.Limit - count
+		}
+		if limit <= 0 {
+			break
+		}
+
+		records, last, err := s.neo.Query(ctx, p.sourceModel, p.shortestPaths, p.optionalPaths, p.where, p.modelProps,
+			p.orderBy, limit, offset, after, nil)
+		if err != nil {
+			return count, err
+		}
+
+		for _, r := range records {
+			if err = writer.Write(r); err != nil {
+				return count, err
+			}
+		}
+		count += len(records)
+
+		if len(records) < limit {
+			break
+		}
+		offset, after = 0, last
+	}
+
+	return count, writer.Flush()
+}
+
+func (s *ModelServiceStore) Autocomplete(ctx context.Context, parsedRequestBody query.AutocompleteRequestBody, datasetId int,
+	organizationId int) ([]string, error) {
+
+	values, err := s.neo.Autocomplete(ctx, datasetId, organizationId, parsedRequestBody)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// CreateModelRelationshipTx validates the type of a relationship and relates two models of a dataset. The display
+// name of the relationship must be unique for the models.
+func (s *ModelServiceStore) CreateModelRelationshipTx(ctx context.Context, datasetId int, organizationId int,
+	req models.CreateModelRelationshipRequestBody, userId string) (*models.ModelRelationship, error) {
+
+	relType, err := validateRelationshipType(req.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	displayName := strings.TrimSpace(req.DisplayName)
+	if displayName == "" {
+		displayName = relType
+	}
+
+	cardinality := strings.ToUpper(strings.TrimSpace(req.Cardinality))
+	switch cardinality {
+	case "":
+		cardinality = models.ManyToMany
+	case models.OneToOne, models.OneToMany, models.ManyToMany:
+	default:
+		return nil, &models.InvalidCardinalityError{Cardinality: req.Cardinality}
+	}
+
+	var relationship *models.ModelRelationship
+	err = s.execTx(ctx, func(qtx *NeoQueries) error {
+		from, err := getModel(ctx, qtx, datasetId, organizationId, req.From)
+		if err != nil {
+			return err
+		}
+		to, err := getModel(ctx, qtx, datasetId, organizationId, req.To)
+		if err != nil {
+			return err
+		}
+
+		exists, err := qtx.ModelRelationshipExists(ctx, from.ID, to.ID, displayName, "")
+		if err != nil {
+			return err
+		}
+		if exists {
+			return &models.ModelRelationshipExistsError{Name: displayName}
+		}
+
+		relationship, err = qtx.CreateModelRelationship(ctx, *from, *to, relType, displayName, cardinality, userId)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return relationship, nil
+}
+
+// GetModelRelationships returns the relationships between the models of a dataset.
+func (s *ModelServiceStore) GetModelRelationships(ctx context.Context, datasetId int, organizationId int) (
+	[]models.ModelRelationship, error) {
+
+	return s.neo.GetModelRelationships(ctx, datasetId, organizationId)
+}
+
+// UpdateModelRelationshipTx renames a relationship between models. The display name must be unique for the models.
+func (s *ModelServiceStore) UpdateModelRelationshipTx(ctx context.Context, datasetId int, organizationId int,
+	relationshipId string, req models.UpdateModelRelationshipRequestBody, userId string) (*models.ModelRelationship, error) {
+
+	displayName := strings.TrimSpace(req.DisplayName)
+	if displayName == "" {
+		return nil, &models.EmptyError{}
+	}
+
+	var relationship *models.ModelRelationship
+	err := s.execTx(ctx, func(qtx *NeoQueries) error {
+		existing, err := qtx.GetModelRelationship(ctx, datasetId, organizationId, relationshipId)
+		if err != nil {
+			return err
+		}
+
+		exists, err := qtx.ModelRelationshipExists(ctx, existing.From, existing.To, displayName, relationshipId)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return &models.ModelRelationshipExistsError{Name: displayName}
+		}
+
+		relationship, err = qtx.UpdateModelRelationship(ctx, datasetId, organizationId, relationshipId, displayName,
+			userId)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return relationship, nil
+}
+
+// DeleteModelRelationshipTx deletes a relationship between models. Relationships that records of the models have
+// cannot be deleted.
+func (s *ModelServiceStore) DeleteModelRelationshipTx(ctx context.Context, datasetId int, organizationId int,
+	relationshipId string) error {
+
+	return s.execTx(ctx, func(qtx *NeoQueries) error {
+		relationship, err := qtx.GetModelRelationship(ctx, datasetId, organizationId, relationshipId)
+		if err != nil {
+			return err
+		}
+
+		count, err := qtx.CountRecordRelationships(ctx, *relationship)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return &models.ModelRelationshipInUseError{Type: relationship.Type, Count: count}
+		}
+
+		return qtx.DeleteModelRelationship(ctx, datasetId, organizationId, relationshipId)
+	})
+}
+
+// maxSavedQueryNameLength is the maximum length of the name of a saved query.
+const maxSavedQueryNameLength = 255
+
+// CreateSavedQueryTx validates a query against the models of the dataset and stores it with a name that is unique in
+// the dataset. Cursors are positions in the results of a single run and are not saved.
+func (s *ModelServiceStore) CreateSavedQueryTx(ctx context.Context, datasetId int, organizationId int,
+	req query.CreateSavedQueryRequestBody, userId string) (*query.SavedQuery, error) {
+
+	name, err := validateSavedQueryName(req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Query.Cursor = ""
+	if _, err = s.ExplainQueryGraph(ctx, query.ExplainRequestBody{QueryRequestBody: req.Query}, datasetId,
+		organizationId); err != nil {
+		return nil, err
+	}
+
+	var savedQuery *query.SavedQuery
+	err = s.execTx(ctx, func(qtx *NeoQueries) error {
+		exists, err := qtx.SavedQueryNameExists(ctx, datasetId, organizationId, name, "")
+		if err != nil {
+			return err
+		}
+		if exists {
+			return &models.SavedQueryNameCountError{Name: name}
+		}
+
+		savedQuery, err = qtx.CreateSavedQuery(ctx, datasetId, organizationId, name, req.Description, req.Query, userId)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return savedQuery, nil
+}
+
+// GetSavedQueries returns the saved queries of a dataset.
+func (s *ModelServiceStore) GetSavedQueries(ctx context.Context, datasetId int, organizationId int) (
+	[]query.SavedQuery, error) {
+
+	return s.neo.GetSavedQueries(ctx, datasetId, organizationId)
+}
+
+// GetSavedQuery returns a saved query of a dataset.
+func (s *ModelServiceStore) GetSavedQuery(ctx context.Context, datasetId int, organizationId int,
+	savedQueryId string) (*query.SavedQuery, error) {
+
+	return s.neo.GetSavedQuery(ctx, datasetId, organizationId, savedQueryId)
+}
+
+// UpdateSavedQueryTx replaces the name, description and query of a saved query. A new query is validated against
+// the models of the dataset like a created query. Only the creator of the saved query can update it, unless the user
+// is a manager of the dataset.
+func (s *ModelServiceStore) UpdateSavedQueryTx(ctx context.Context, datasetId int, organizationId int,
+	savedQueryId string, req query.UpdateSavedQueryRequestBody, userId string, manager bool) (*query.SavedQuery, error) {
+
+	if req.Name != nil {
+		name, err := validateSavedQueryName(*req.Name)
+		if err != nil {
+			return nil, err
+		}
+		req.Name = &name
+	}
+
+	if req.Query != nil {
+		q := *req.Query
+		q.Cursor = ""
+		if _, err := s.ExplainQueryGraph(ctx, query.ExplainRequestBody{QueryRequestBody: q}, datasetId,
+			organizationId); err != nil {
+			return nil, err
+		}
+		req.Query = &q
+	}
+
+	var savedQuery *query.SavedQuery
+	err := s.execTx(ctx, func(qtx *NeoQueries) error {
+		if err := checkSavedQueryCreator(ctx, qtx, datasetId, organizationId, savedQueryId, userId, manager); err != nil {
+			return err
+		}
+
+		if req.Name != nil {
+			exists, err := qtx.SavedQueryNameExists(ctx, datasetId, organizationId, *req.Name, savedQueryId)
+			if err != nil {
+				return err
+			}
+			if exists {
+				return &models.SavedQueryNameCountError{Name: *req.Name}
+			}
+		}
+
+		var err error
+		savedQuery, err = qtx.UpdateSavedQuery(ctx, datasetId, organizationId, savedQueryId, req.Name,
+			req.Description, req.Query, userId)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return savedQuery, nil
+}
+
+// DeleteSavedQueryTx deletes a saved query from a dataset. Only the creator of the saved query can delete it, unless
+// the user is a manager of the dataset.
+func (s *ModelServiceStore) DeleteSavedQueryTx(ctx context.Context, datasetId int, organizationId int,
+	savedQueryId string, userId string, manager bool) error {
+
+	return s.execTx(ctx, func(qtx *NeoQueries) error {
+		if err := checkSavedQueryCreator(ctx, qtx, datasetId, organizationId, savedQueryId, userId, manager); err != nil {
+			return err
+		}
+
+		return qtx.DeleteSavedQuery(ctx, datasetId, organizationId, savedQueryId)
+	})
+}
+
+// checkSavedQueryCreator returns an error when the user did not create the saved query and is not a manager of the
+// dataset, so the user cannot change the saved query.
+func checkSavedQueryCreator(ctx context.Context, qtx *NeoQueries, datasetId int, organizationId int,
+	savedQueryId string, userId string, manager bool) error {
+
+	savedQuery, err := qtx.GetSavedQuery(ctx, datasetId, organizationId, savedQueryId)
+	if err != nil {
+		return err
+	}
+	if savedQuery.CreatedBy != userId && !manager {
+		return &models.SavedQueryCreatorError{ID: savedQueryId}
+	}
+
+	return nil
+}
+
+// GetSavedQueryRequest returns the query of a saved query with the overrides of a request to run it. The query is
+// validated against the current models of the dataset when it is run.
+func (s *ModelServiceStore) GetSavedQueryRequest(ctx context.Context, datasetId int, organizationId int,
+	savedQueryId string, overrides query.RunSavedQueryRequestBody) (query.QueryRequestBody, error) {
+
+	savedQuery, err := s.neo.GetSavedQuery(ctx, datasetId, organizationId, savedQueryId)
+	if err != nil {
+		return query.QueryRequestBody{}, err
+	}
+
+	return savedQuery.Query.WithOverrides(overrides)
+}
+
+// CreateRelationships relates the pairs of records that the mode of the request describes, in a single transaction.
+// The number of pairs cannot exceed the maximum number of record links of the store.
+func (s *ModelServiceStore) CreateRelationships(ctx context.Context, parsedRequestBody models.PostRecordRelationshipRequestBody,
+	datasetId int, organizationId int, userNodeId string) ([]models.ShortRecordRelationShip, error) {
+
+	// Relationships are created between pairs of records
+	pairs, err := parsedRequestBody.Records.Pairs(parsedRequestBody.Mode, s.maxRecordLinks)
+	if err != nil {
+		return nil, err
+	}
+	parsedRequestBody.Records = pairs
+	parsedRequestBody.Mode = models.LinkPairwise
+
+	var response []models.ShortRecordRelationShip
+	err = s.execTx(ctx, func(qtx *NeoQueries) error {
+		var err error
+		response, err = qtx.CreateRelationShips(ctx, datasetId, organizationId, userNodeId, parsedRequestBody)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// GetRecordRelationships returns a page of the relationships between a record in a dataset and other records. When a
+// name is provided, only relationships of the model relationship with the name are returned.
+func (s *ModelServiceStore) GetRecordRelationships(ctx context.Context, datasetId int, organizationId int,
+	recordId string, name string, limit int, offset int) (*models.RecordRelationshipsResponse, error) {
+
+	if limit <= 0 {
+		limit = query.DefaultPageSize
+	} else if limit > query.MaxPageSize {
+		limit = query.MaxPageSize
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	relationships, err := s.neo.GetRecordRelationships(ctx, datasetId, organizationId, recordId, name, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.RecordRelationshipsResponse{Limit: limit, Offset: offset, Relationships: relationships}, nil
+}
+
+// DeleteRecordRelationshipsTx deletes relationships between records by their ids, and between pairs of records, in a
+// single transaction.
+func (s *ModelServiceStore) DeleteRecordRelationshipsTx(ctx context.Context, datasetId int, organizationId int,
+	req models.DeleteRecordRelationshipsRequestBody) (*models.DeleteRecordRelationshipsResponse, error) {
+
+	if len(req.Records.From) != len(req.Records.To) {
+		return nil, &models.InvalidRecordRelationshipsError{Reason: "from and to lists need to be of the same length"}
+	}
+	if len(req.IDs) == 0 && len(req.Records.From) == 0 {
+		return nil, &models.InvalidRecordRelationshipsError{Reason: "ids or records are required"}
+	}
+
+	var pairs []map[string]interface{}
+	for i := range req.Records.From {
+		pairs = append(pairs, map[string]interface{}{"from": req.Records.From[i], "to": req.Records.To[i]})
+	}
+
+	var response models.DeleteRecordRelationshipsResponse
+	err := s.execTx(ctx, func(qtx *NeoQueries) error {
+		var err error
+		response.Deleted, err = qtx.DeleteRecordRelationships(ctx, datasetId, organizationId, req.IDs, pairs,
+			req.RelName)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// LinkRecordPackageTx attaches a record in a dataset to a package of the dataset.
+func (s *ModelServiceStore) LinkRecordPackageTx(ctx context.Context, datasetId int, organizationId int,
+	recordId string, packageNodeId string, userId string) (*models.RecordPackage, error) {
+
+	pkg, err := s.getDatasetPackage(ctx, datasetId, packageNodeId)
+	if err != nil {
+		return nil, err
+	}
+
+	var recordPackage *models.RecordPackage
+	err = s.execTx(ctx, func(qtx *NeoQueries) error {
+		var err error
+		recordPackage, err = qtx.LinkRecordPackage(ctx, datasetId, organizationId, recordId, *pkg, userId)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return recordPackage, nil
+}
+
+// UnlinkRecordPackageTx removes the attachment of a record in a dataset to a package of the dataset.
+func (s *ModelServiceStore) UnlinkRecordPackageTx(ctx context.Context, datasetId int, organizationId int,
+	recordId string, packageNodeId string) error {
+
+	pkg, err := s.getDatasetPackage(ctx, datasetId, packageNodeId)
+	if err != nil {
+		return err
+	}
+
+	return s.execTx(ctx, func(qtx *NeoQueries) error {
+		return qtx.UnlinkRecordPackage(ctx, datasetId, organizationId, recordId, *pkg)
+	})
+}
+
+// getDatasetPackage returns a package by its node id, and returns a PackageNotInDatasetError when the package
+// belongs to another dataset. Packages that are deleted are unknown.
+func (s *ModelServiceStore) getDatasetPackage(ctx context.Context, datasetId int, packageNodeId string) (
+	*models.Package, error) {
+
+	pkg, err := s.pg.GetPackage(ctx, packageNodeId)
+	if err != nil {
+		return nil, err
+	}
+	if pkg.State == packageState.Deleting.String() || pkg.State == packageState.Deleted.String() {
+		return nil, &models.UnknownPackageError{NodeID: packageNodeId}
+	}
+	if pkg.DatasetID != int64(datasetId) {
+		return nil, &models.PackageNotInDatasetError{NodeID: packageNodeId}
+	}
+
+	return pkg, nil
+}
+
+func (s *ModelServiceStore) GetRecordsForPackage(ctx context.Context, datasetId int, organizationId int, packageNodeId string, maxDepth int) ([]models.PackageMetadata, error) {
+
+	// Get the package and ancestors based on folder structure on the platform
+	packages, err := s.pg.GetPackageAncestors(ctx, packageNodeId)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debug("Package Ancestors: length: ", len(packages))
+
+	var packageIds []int
+	for _, p := range packages {
+		packageIds = append(packageIds, int(p.Id))
+	}
+
+	// Get all records associated with the hierarchical record structure for record and ancestors
+	nodes, err := s.neo.GetRecordsForPackage(ctx, datasetId, organizationId, packageIds, maxDepth)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return nodes, nil
+
+}
+
+// preparedQuery is a query of which the models, filters and order are validated against the models in the dataset.
+type preparedQuery struct {
+	sourceModel   models.Model
+	modelMap      map[string]models.Model
+	shortestPaths []dbtype.Path
+	optionalPaths []dbtype.Path
+	where         *query.FilterGroup
+	modelProps    map[string][]models.ModelProperty
+	orderBy       query.OrderByList
+}
+
+// prepareQuery returns the source model, the models in the dataset, the shortest paths to the models in the
+// filters, the optional paths to the models that only aggregate or order the records, the flat filters and the filter tree combined
+// in a single tree, the properties of the models in the query and the order of the records.
+func (s *ModelServiceStore) prepareQuery(ctx context.Context, req query.QueryRequestBody, datasetId int,
+	organizationId int) (*preparedQuery, error) {
+
+	modelMap, err := s.neo.GetModels(ctx, datasetId, organizationId)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceModel, inMap := modelMap[req.Model]
+	if inMap == false {
+		return nil, &models.UnknownModelError{Model: req.Model}
+	}
+
+	// Models in filters are joined, so records must be related to records that match the filters. Models that are
+	// only in aggregations or the order are joined optionally, so records without related records are grouped or
+	// ordered instead of excluded. Models in facets are only joined in the queries of the facets.
+	orderBy := req.OrderBy.WithModel(sourceModel.Name)
+	optionalModelNames := orderBy.Models()
+	if req.Aggregate != nil {
+		optionalModelNames = append(optionalModelNames, req.Aggregate.WithModel(sourceModel.Name).Models()...)
+	}
+	var facetModels []string
+	for _, f := range req.Facets {
+		if f.Model == "" {
+			f.Model = sourceModel.Name
+		}
+		facetModels = append(facetModels, f.Model)
+	}
+
+	where := combineFilters(req.Filters, req.Where)
+	modelProps, err := getFilterModelProps(ctx, s.neo, datasetId, organizationId, sourceModel, where,
+		append(optionalModelNames, facetModels...)...)
+	if err != nil {
+		return nil, err
+	}
+	for i, f := range req.Facets {
+		if _, err = findProperty(modelProps, facetModels[i], f.Property); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err = orderColumns(sourceModel, orderBy, modelProps); err != nil {
+		return nil, err
+	}
+
+	targetModels, err := getTargetModelsMap(where.Leaves(), sourceModel, modelMap)
+	if err != nil {
+		log.Error("Error getting the target models: ", err)
+		return nil, err
+	}
+
+	shortestPaths, err := s.neo.ShortestPath(ctx, sourceModel, targetModels)
+	if err != nil {
+		log.Error("Error getting shortest paths: ", err)
+		return nil, err
+	}
+
+	if err = checkFilterModelsRelated(sourceModel, targetModels, shortestPaths); err != nil {
+		return nil, err
+	}
+
+	optionalModels := make(map[string]string)
+	if err = addTargetModels(optionalModels, sourceModel, modelMap, optionalModelNames); err != nil {
+		return nil, err
+	}
+	for name := range targetModels {
+		delete(optionalModels, name)
+	}
+	var optionalPaths []dbtype.Path
+	if len(optionalModels) > 0 {
+		if optionalPaths, err = s.neo.ShortestPath(ctx, sourceModel, optionalModels); err != nil {
+			log.Error("Error getting shortest paths: ", err)
+			return nil, err
+		}
+		if err = checkFilterModelsRelated(sourceModel, optionalModels, optionalPaths); err != nil {
+			return nil, err
+		}
+	}
+
+	return &preparedQuery{
+		sourceModel:   sourceModel,
+		modelMap:      modelMap,
+		shortestPaths: shortestPaths,
+		optionalPaths: optionalPaths,
+		where:         where,
+		modelProps:    modelProps,
+		orderBy:       orderBy,
+	}, nil
+}
+
+// addTargetModels adds the models with the provided names, other than the source model, to the target models of
+// a query.
+func addTargetModels(targetModels map[string]string, sourceModel models.Model, modelMap map[string]models.Model,
+	names []string) error {
+
+	for _, name := range names {
+		if name == sourceModel.Name {
+			continue
+		}
+		m, inMap := modelMap[name]
+		if !inMap {
+			return &models.UnknownModelError{Model: name}
+		}
+		targetModels[name] = m.ID
+	}
+
+	return nil
+}
+
+// validateSavedQueryName returns the name of a saved query without surrounding whitespace, or an error when the
+// name is empty or too long.
+func validateSavedQueryName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", &models.EmptyError{}
+	}
+	if len(name) > maxSavedQueryNameLength {
+		return "", &models.NameTooLongError{Name: name}
+	}
+	return name, nil
+}
+
+// getModel returns a model in the dataset by its name or id.
+func getModel(ctx context.Context, q *NeoQueries, datasetId int, organizationId int, modelIdOrName string) (*models.Model, error) {
+	modelMap, err := q.GetModels(ctx, datasetId, organizationId)
+	if err != nil {
+		return nil, err
+	}
+
+	if m, inMap := modelMap[modelIdOrName]; inMap {
+		return &m, nil
+	}
+
+	for _, m := range modelMap {
+		if m.ID == modelIdOrName {
+			return &m, nil
+		}
+	}
+
+	return nil, &models.UnknownModelError{Model: modelIdOrName}
+}
+
+// validateRecord returns the model and the values of a record that are validated against the model properties.
+func validateRecord(ctx context.Context, q *NeoQueries, datasetId int, organizationId int, modelIdOrName string,
+	values map[string]interface{}) (*models.Model, map[string]interface{}, error) {
+
+	model, err := getModel(ctx, q, datasetId, organizationId, modelIdOrName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	modelProps, err := q.GetModelProps(ctx, datasetId, organizationId, model.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	validValues, err := models.ValidateRecordProps(values, modelProps)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return model, validValues, nil
+}
+
+// writeRecordsBatch validates the values of each row against the model properties and creates or, when upsert is
+// set, updates the records. Rows that are already marked as failed are skipped. The status of each row is set in
+// results; in a dry run, rows get the status they would have but nothing is written.
+func writeRecordsBatch(ctx context.Context, q *NeoQueries, model models.Model, modelProps []models.ModelProperty,
+	rows []map[string]interface{}, results []models.BatchRecordResult, upsert bool, dryRun bool, userId string) error {
+
+	var titleProp *models.ModelProperty
+	for j, p := range modelProps {
+		if p.IsModelTitle {
+			titleProp = &modelProps[j]
+		}
+	}
+
+	// Validate all rows
+	var validRows []int
+	values := make([]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		results[i].Index = i
+		if results[i].Status == models.BatchRecordFailed {
+			continue
+		}
+
+		v, err := models.ValidateRecordProps(row, modelProps)
+		if err != nil {
+			validationErr, isValidationErr := err.(*models.RecordValidationError)
+			if !isValidationErr {
+				return err
+			}
+			results[i].Status = models.BatchRecordFailed
+			results[i].Errors = validationErr.Details
+			continue
+		}
+
+		values[i] = v
+		validRows = append(validRows, i)
+	}
+
+	// Match rows to existing records
+	existingIds := make(map[int]string)
+	if upsert && titleProp != nil {
+		var err error
+		existingIds, err = matchRecordsByTitle(ctx, q, model, *titleProp, values, validRows, results)
+		if err != nil {
+			return err
+		}
+	}
+
+	var creates, updates []int
+	for _, i := range validRows {
+		if results[i].Status == models.BatchRecordFailed {
+			continue
+		}
+		if _, exists := existingIds[i]; exists {
+			updates = append(updates, i)
+		} else {
+			creates = append(creates, i)
+		}
+	}
+
+	if dryRun {
+		for _, i := range creates {
+			results[i].Status = models.BatchRecordCreated
+		}
+		for _, i := range updates {
+			results[i].ID = existingIds[i]
+			results[i].Status = models.BatchRecordUpdated
+		}
+		return nil
+	}
+
+	// Write rows in batches
+	for start := 0; start < len(creates); start += batchSize {
+		end := start + batchSize
+		if end > len(creates) {
+			end = len(creates)
+		}
+
+		var batch []map[string]interface{}
+		for _, i := range creates[start:end] {
+			batch = append(batch, values[i])
+		}
+
+		ids, err := q.CreateRecords(ctx, model, batch, userId)
+		if err != nil {
+			return err
+		}
+
+		for j, i := range creates[start:end] {
+			results[i].ID = ids[j]
+			results[i].Status = models.BatchRecordCreated
+		}
+	}
+
+	for start := 0; start < len(updates); start += batchSize {
+		end := start + batchSize
+		if end > len(updates) {
+			end = len(updates)
+		}
+
+		var batch []map[string]interface{}
+		for _, i := range updates[start:end] {
+			batch = append(batch, map[string]interface{}{"id": existingIds[i], "values": values[i]})
+		}
+
+		if err := q.UpdateRecords(ctx, model, batch, userId); err != nil {
+			return err
+		}
+
+		for _, i := range updates[start:end] {
+			results[i].ID = existingIds[i]
+			results[i].Status = models.BatchRecordUpdated
+		}
+	}
+
+	return nil
+}
+
+// countBatchResults sets the number of created, updated and failed rows of a batch.
+func countBatchResults(response *models.BatchRecordResponse) {
+	for _, r := range response.Results {
+		switch r.Status {
+		case models.BatchRecordCreated:
+			response.Created++
+		case models.BatchRecordUpdated:
+			response.Updated++
+		case models.BatchRecordFailed:
+			response.Failed++
+		}
+	}
+}
+
+// matchRecordsByTitle returns the ids of existing records that have the same model-title value as the provided rows,
+// keyed by row index. Titles are compared as values of the data type of the title property. Rows whose title matches
+// multiple existing records, or that repeat a title of an earlier row, are marked as failed in the results.
+func matchRecordsByTitle(ctx context.Context, q *NeoQueries, model models.Model, titleProp models.ModelProperty,
+	values []map[string]interface{}, rows []int, results []models.BatchRecordResult) (map[int]string, error) {
+
+	existingIds := make(map[int]string)
+
+	var titles []interface{}
+	for _, i := range rows {
+		titles = append(titles, values[i][titleProp.Name])
+	}
+
+	for start := 0; start < len(titles); start += batchSize {
+		end := start + batchSize
+		if end > len(titles) {
+			end = len(titles)
+		}
+
+		ids, err := q.GetRecordIdsByProperty(ctx, model, titleProp, titles[start:end])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, i := range rows[start:end] {
+			if matches := ids[propertyValueKey(titleProp.DataType, values[i][titleProp.Name])]; len(matches) > 1 {
+				results[i].Status = models.BatchRecordFailed
+				results[i].Errors = []models.ValidationErrorDetail{
+					{Property: titleProp.Name, Message: fmt.Sprintf("model title matches %d existing records", len(matches))}}
+			} else if len(matches) == 1 {
+				existingIds[i] = matches[0]
+			}
+		}
+	}
+
+	seen := make(map[string]int)
+	for _, i := range rows {
+		title := propertyValueKey(titleProp.DataType, values[i][titleProp.Name])
+		if first, exists := seen[title]; exists {
+			results[i].Status = models.BatchRecordFailed
+			results[i].Errors = []models.ValidationErrorDetail{
+				{Property: titleProp.Name, Message: fmt.Sprintf("model title is the same as row %d", first)}}
+			continue
+		}
+		seen[title] = i
+	}
+
+	return existingIds, nil
+}
+
+// propertyValueKey returns the string representation of a property value converted to the data type of the property,
+// so that equal values written differently, such as 1 and 1.0 or the same instant in different time zones, have the
+// same key. Dates are represented in UTC with nanosecond precision.
+func propertyValueKey(dataType models.DataType, value interface{}) string {
+	if c, err := dataType.Coerce(value); err == nil {
+		value = c
+	}
+
+	switch v := value.(type) {
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case []interface{}:
+		keys := make([]string, len(v))
+		for i, item := range v {
+			keys[i] = propertyValueKey(models.DataType{Type: dataType.Type}, item)
+		}
+		return fmt.Sprint(keys)
+	}
+
+	return fmt.Sprint(value)
+}
+
+// propertyConversion is the Cypher function used to convert existing record values when the data type of a property
+// changes, and the types of values that the function accepts.
+type propertyConversion struct {
+	function string
+	from     []models.PropertyType
+}
+
+// propertyConversions maps data types to the conversion of existing record values when the data type of a property
+// changes. Values cannot be converted to other data types.
+var propertyConversions = map[models.PropertyType]propertyConversion{
+	models.STRING:  {function: "toString", from: []models.PropertyType{models.STRING, models.LONG, models.BOOLEAN}},
+	models.LONG:    {function: "toInteger", from: []models.PropertyType{models.STRING, models.LONG}},
+	models.DOUBLE:  {function: "toFloat", from: []models.PropertyType{models.STRING, models.LONG}},
+	models.BOOLEAN: {function: "toBoolean", from: []models.PropertyType{models.STRING, models.BOOLEAN}},
+}
+
+// conversionTypeChecks are Cypher values that a value is compared with to check its type. Comparing values of
+// different types returns null, and the Long check also matches Double values, as numbers are comparable.
+var conversionTypeChecks = map[models.PropertyType]string{
+	models.STRING:  "''",
+	models.LONG:    "0",
+	models.BOOLEAN: "false",
+}
+
+// expression returns a Cypher expression that converts the provided value, and that is null when the value cannot be
+// converted. Cypher conversion functions raise an error for values of types they do not accept, so values of other
+// types, such as lists and dates, are not passed to the function.
+func (c propertyConversion) expression(value string) string {
+	var checks []string
+	for _, t := range c.from {
+		checks = append(checks, fmt.Sprintf("(%s >= %s) IS NOT NULL", value, conversionTypeChecks[t]))
+	}
+
+	return fmt.Sprintf("CASE WHEN %s THEN %s(%s) END", strings.Join(checks, " OR "), c.function, value)
+}
+
+// mergeModelProperties applies the requested changes to the existing properties of a model.
+// It returns the resulting properties with contiguous indices, and the names of the properties
+// that are removed or that change data type.
+func mergeModelProperties(existing []models.ModelProperty, req models.UpdateModelPropertiesRequestBody) (
+	[]models.ModelProperty, []string, []string, error) {
+
+	type sortableProp struct {
+		prop     models.ModelProperty
+		index    int64
+		explicit bool
+	}
+
+	propMap := make(map[string]*sortableProp)
+	var order []string
+	for _, p := range existing {
+		propMap[p.Name] = &sortableProp{prop: p, index: p.Index}
+		order = append(order, p.Name)
+	}
+
+	var removed []string
+	for _, name := range req.Remove {
+		if _, exists := propMap[name]; !exists {
+			return nil, nil, nil, &models.UnknownModelPropertyError{PropName: name}
+		}
+		delete(propMap, name)
+		removed = append(removed, name)
+	}
+
+	var retyped []string
+	nextIndex := int64(math.MaxInt32)
+	for _, r := range req.Properties {
+		name, err := validatePropertyName(r.Name)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if shared.StringInSlice(name, removed) {
+			return nil, nil, nil, &models.InvalidPropertyError{PropName: name, Reason: "property cannot be both updated and removed"}
+		}
+
+		if r.DataType == nil {
+			return nil, nil, nil, &models.InvalidPropertyError{PropName: name, Reason: "data type is required"}
+		}
+		dataType := *r.DataType
+		if err = dataType.Validate(); err != nil {
+			return nil, nil, nil, &models.InvalidPropertyError{PropName: name, Reason: err.Error()}
+		}
+
+		defaultValue, err := dataType.Coerce(r.DefaultValue)
+		if err != nil {
+			return nil, nil, nil, &models.InvalidPropertyError{PropName: name, Reason: "invalid default: " + err.Error()}
+		}
+
+		displayName := r.DisplayName
+		if displayName == "" {
+			displayName = name
+		}
+
+		newProp := models.ModelProperty{
+			DataType:     dataType,
+			DefaultValue: defaultValue,
+			DisplayName:  displayName,
+			Description:  r.Description,
+			Name:         name,
+			IsModelTitle: r.IsModelTitle,
+		}
+
+		current, exists := propMap[name]
+		switch {
+		case exists:
+			newProp.ID = current.prop.ID
+			if current.prop.DataType.Encode() != dataType.Encode() {
+				retyped = append(retyped, name)
+			}
+			current.prop = newProp
+		default:
+			current = &sortableProp{prop: newProp, index: nextIndex}
+			nextIndex++
+			propMap[name] = current
+			order = append(order, name)
+		}
+
+		if r.Index != nil {
+			current.index = *r.Index
+			current.explicit = true
+		}
+	}
+
+	var sorted []*sortableProp
+	for _, name := range order {
+		if p, exists := propMap[name]; exists {
+			sorted = append(sorted, p)
+		}
+	}
+
+	// Properties with an explicit index are placed before an existing property with the same index.
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].index != sorted[j].index {
+			return sorted[i].index < sorted[j].index
+		}
+		return sorted[i].explicit && !sorted[j].explicit
+	})
+
+	var result []models.ModelProperty
+	nrModelTitles := 0
+	for i, p := range sorted {
+		p.prop.Index = int64(i)
+		if p.prop.IsModelTitle {
+			nrModelTitles++
+		}
+		result = append(result, p.prop)
+	}
+
+	if len(result) > 0 && nrModelTitles != 1 {
+		return nil, nil, nil, &models.ModelTitleError{Count: nrModelTitles}
+	}
 
+	return result, removed, retyped, nil
 }
@@ -1,8 +1,10 @@
 package store
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
@@ -18,6 +20,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -68,10 +71,44 @@ func TestStore(t *testing.T) {
 	for scenario, fn := range map[string]func(
 		tt *testing.T, s *ModelServiceStore,
 	){
-		"create query syntax from query params": testCreateQuery,
-		"create org and dataset nodes in db":    testInitOrgAndDataset,
-		"create valid model":                    testCreateModel,
-		"get package ancestors":                 testPackageAncestors,
+		"create query syntax from query params":    testCreateQuery,
+		"compile boolean filter tree":              testCompileFilterGroup,
+		"compile named filter operators":           testCompileFilterOperators,
+		"compile aggregate query":                  testCompileAggregate,
+		"compile facet query":                      testCompileFacet,
+		"compile query with included models":       testCompileInclude,
+		"compile query after cursor":               testCompileCursor,
+		"compile multi-column order":               testCompileOrder,
+		"describe paths between models":            testModelPaths,
+		"validate relationship types":              testValidateRelationshipType,
+		"parse record relationships":               testParseRecordRelationship,
+		"find cardinality violations in batch":     testCardinalityViolations,
+		"read cardinality of relationships":        testRelationshipCardinality,
+		"guard property conversions by type":       testPropertyConversionExpression,
+		"compare titles by data type":              testPropertyValueKey,
+		"create org and dataset nodes in db":       testInitOrgAndDataset,
+		"create valid model":                       testCreateModel,
+		"create model in new dataset":              testCreateModelTx,
+		"update and delete model":                  testUpdateDeleteModel,
+		"merge model properties":                   testMergeModelProperties,
+		"update model properties":                  testUpdateModelProperties,
+		"create, update and delete records":        testRecordCRUD,
+		"create and upsert batch of records":       testRecordsBatch,
+		"import records from delimited file":       testImportRecords,
+		"export all pages of query results":        testExportQuery,
+		"aggregate query results":                  testAggregateQuery,
+		"query pages with and without total":       testQueryGraphPages,
+		"order by models without related records":  testQueryOrderOptional,
+		"aggregate models without related records": testAggregateOptional,
+		"cancel concurrent read queries":           testReadConcurrently,
+		"explain query without running it":         testExplainQueryGraph,
+		"save, update, run and delete queries":     testSavedQueries,
+		"manage relationships between models":      testModelRelationships,
+		"list and delete record relationships":     testRecordRelationships,
+		"enforce relationship cardinality":         testRecordRelationshipCardinality,
+		"get package ancestors":                    testPackageAncestors,
+		"attach records to packages":               testRecordPackages,
+		"attach packages of orgs with same ids":    testRecordPackagesAcrossOrgs,
 	} {
 		t.Run(scenario, func(t *testing.T) {
 			db := shared.NewNeo4jSession(neo4jDriver.NewSession(context.Background(), neo4j.SessionConfig{
@@ -83,7 +120,7 @@ func TestStore(t *testing.T) {
 				log.Fatal("cannot connect to db:", err)
 			}
 
-			graphStore := NewModelServiceStore(pgdbClient, db)
+			graphStore := NewModelServiceStore(pgdbClient, db).WithDriver(neo4jDriver)
 
 			t.Cleanup(func() {
 				db.Close(context.Background())
@@ -241,45 +278,266 @@ func testCreateQuery(t *testing.T, _ *ModelServiceStore) {
 		{
 			Model:    "patient",
 			Property: "name",
-			Operator: "STARTS_WITH",
+			Operator: "STARTS WITH",
 			Value:    "LIM031",
 		},
 		{
 			Model:    "samples",
 			Property: "sample_type_id",
-			Operator: "STARTS_WITH",
+			Operator: "STARTS WITH",
 			Value:    "Biopsy Cells",
 		},
 		{
 			Model:    "visit",
 			Property: "study",
-			Operator: "STARTS_WITH",
+			Operator: "STARTS WITH",
 			Value:    "Wu LIMBO",
 		},
 		{
 			Model:    "state",
 			Property: "mascot",
-			Operator: "STARTS_WITH",
+			Operator: "STARTS WITH",
 			Value:    "Eagle",
 		},
 	}
 
+	// Properties of the models in the filters
+	modelProps := map[string][]models.ModelProperty{
+		"patient": {{Name: "name", DataType: models.DataType{Type: models.STRING}}},
+		"samples": {{Name: "sample_type_id", DataType: models.DataType{Type: models.STRING}}},
+		"visit":   {{Name: "study", DataType: models.DataType{Type: models.STRING}}},
+		"state":   {{Name: "mascot", DataType: models.DataType{Type: models.STRING}}},
+	}
+
 	params := query.FormatParams{
 		ResultType:         query.RESULTS,
 		AutoCompleteParams: query.AutoCompleteParams{},
 	}
 
-	queryStr, err := generateQuery(models.Model{
+	queryStr, queryParams, err := generateQuery(models.Model{
 		ID:   "9609bfb8-c7a1-45d5-b683-de2e39788cc0",
 		Name: "samples",
-	}, paths, filters, "'@id'", params, 100, 0)
+	}, paths, nil, combineFilters(filters, nil), modelProps, nil, params, 100, 0)
 
 	if err != nil {
 		fmt.Println(err)
 	}
 
-	assert.Equal(t, "MATCH (Msamples:Model{id:'9609bfb8-c7a1-45d5-b683-de2e39788cc0'})<-[:`@INSTANCE_OF`]-(samples:Record)-[:SAMPLE_BELONGS_TO_VISIT]-(visits:Record)-[:VISIT_BELONGS_TO_SUBJECT]-(patient:Record)-[:`@INSTANCE_OF`]->(Mpatient:Model{id:'43f44351-7d80-454b-9d11-6ecc0c158559'}) , (visits:Record)-[:VISIT_BELONGS_TO_STUDY]-(study:Record) , (study:Record)-[:STUDY_BELONGS_TO_LOCATION]-(location:Record)-[:LOCATION_BELONGS_TO_STATE]-(state:Record) WHERE patient.name STARTS_WITH 'LIM031' AND samples.sample_type_id STARTS_WITH 'Biopsy Cells' AND visit.study STARTS_WITH 'Wu LIMBO' AND state.mascot STARTS_WITH 'Eagle' RETURN DISTINCT samples AS records ORDER BY samples.'@id' SKIP 0 LIMIT 100", queryStr)
+	assert.Equal(t, "MATCH (`Msamples`:Model{id:$p0})<-[:`@INSTANCE_OF`]-(`samples`:Record)-[:`SAMPLE_BELONGS_TO_VISIT`]-(`visits`:Record)-[:`VISIT_BELONGS_TO_SUBJECT`]-(`patient`:Record)-[:`@INSTANCE_OF`]->(`Mpatient`:Model{id:$p1}) , (`visits`:Record)-[:`VISIT_BELONGS_TO_STUDY`]-(`study`:Record) , (`study`:Record)-[:`STUDY_BELONGS_TO_LOCATION`]-(`location`:Record)-[:`LOCATION_BELONGS_TO_STATE`]-(`state`:Record) WHERE ((`patient`.`name` STARTS WITH $p2) AND (`samples`.`sample_type_id` STARTS WITH $p3) AND (`visit`.`study` STARTS WITH $p4) AND (`state`.`mascot` STARTS WITH $p5)) RETURN DISTINCT `samples` AS records ORDER BY `samples`.`@sort_key` SKIP $p6 LIMIT $p7", queryStr)
+	assert.Equal(t, map[string]interface{}{
+		"p0": "9609bfb8-c7a1-45d5-b683-de2e39788cc0",
+		"p1": "43f44351-7d80-454b-9d11-6ecc0c158559",
+		"p2": "LIM031",
+		"p3": "Biopsy Cells",
+		"p4": "Wu LIMBO",
+		"p5": "Eagle",
+		"p6": 0,
+		"p7": 100,
+	}, queryParams)
+
+}
+
+func testCompileFilterGroup(t *testing.T, _ *ModelServiceStore) {
+	modelProps := map[string][]models.ModelProperty{
+		"patient": {
+			{Name: "name", DataType: models.DataType{Type: models.STRING}, IsModelTitle: true},
+			{Name: "age", DataType: models.DataType{Type: models.LONG}},
+		},
+		"samples": {
+			{Name: "tags", DataType: models.DataType{Type: models.STRING, IsArray: true}},
+			{Name: "collected", DataType: models.DataType{Type: models.DATE}},
+		},
+	}
+
+	where := query.FilterGroup{
+		Or: []query.FilterGroup{
+			{And: []query.FilterGroup{
+				{Filters: query.Filters{Model: "patient", Property: "age", Operator: ">=", Value: 60.0}},
+				{Not: &query.FilterGroup{
+					Filters: query.Filters{Model: "patient", Property: "name", Operator: "STARTS WITH", Value: "O'B"}}},
+			}},
+			{Filters: query.Filters{Model: "samples", Property: "tags", Operator: "=", Value: "biopsy"}},
+			{Filters: query.Filters{Model: "samples", Property: "collected", Operator: "<", Value: "2022-01-31"}},
+		},
+	}
+
+	b := newCypherBuilder()
+	condition, err := compileFilterGroup(b, where, modelProps)
+	assert.NoError(t, err)
+	assert.Equal(t, "(((`patient`.`age` >= $p0) AND (NOT (`patient`.`name` STARTS WITH $p1))) OR "+
+		"ANY(v IN `samples`.`tags` WHERE v = $p2) OR (`samples`.`collected` < $p3))", condition)
+	assert.Equal(t, map[string]interface{}{
+		"p0": int64(60),
+		"p1": "O'B",
+		"p2": "biopsy",
+		"p3": time.Date(2022, 1, 31, 0, 0, 0, 0, time.UTC),
+	}, b.Params())
+
+	assert.Equal(t, []query.Filters{
+		{Model: "patient", Property: "age", Operator: ">=", Value: 60.0},
+		{Model: "patient", Property: "name", Operator: "STARTS WITH", Value: "O'B"},
+		{Model: "samples", Property: "tags", Operator: "=", Value: "biopsy"},
+		{Model: "samples", Property: "collected", Operator: "<", Value: "2022-01-31"},
+	}, where.Leaves())
+
+	_, err = compileFilterGroup(newCypherBuilder(), query.FilterGroup{
+		Filters: query.Filters{Model: "patient", Property: "height", Operator: "=", Value: "1"}}, modelProps)
+	assert.Equal(t, &models.UnknownModelPropertyError{PropName: "height"}, err)
+
+	_, err = compileFilterGroup(newCypherBuilder(), query.FilterGroup{
+		Filters: query.Filters{Model: "patient", Property: "age", Operator: "CONTAINS", Value: "1"}}, modelProps)
+	assert.IsType(t, &models.UnsupportedOperatorError{}, err)
+
+	_, err = compileFilterGroup(newCypherBuilder(), query.FilterGroup{
+		Filters: query.Filters{Model: "patient", Property: "age", Operator: "= 1 OR 1 =", Value: "1"}}, modelProps)
+	assert.Equal(t, &models.UnsupportedOperatorError{Operator: "= 1 OR 1 ="}, err)
+
+	_, err = compileFilterGroup(newCypherBuilder(), query.FilterGroup{
+		Filters: query.Filters{Model: "patient", Property: "age", Operator: "=", Value: "old"}}, modelProps)
+	assert.IsType(t, &models.InvalidFilterError{}, err)
+
+	_, err = compileFilterGroup(newCypherBuilder(), query.FilterGroup{
+		Filters: query.Filters{Model: "patient", Property: "age", Operator: "=", Value: true}}, modelProps)
+	assert.EqualError(t, err, "Invalid filter: patient.age: expected Long, got boolean")
+
+	_, err = compileFilterGroup(newCypherBuilder(), query.FilterGroup{
+		Filters: query.Filters{Model: "patient", Property: "age", Operator: "=", Value: []interface{}{1.0}}}, modelProps)
+	assert.EqualError(t, err, "Invalid filter: patient.age: expected Long, got array")
+
+	b = newCypherBuilder()
+	condition, err = compileFilterGroup(b, query.FilterGroup{
+		Filters: query.Filters{Model: "samples", Property: "tags", Operator: "=", Value: []interface{}{"biopsy", "blood"}}}, modelProps)
+	assert.NoError(t, err)
+	assert.Equal(t, "(`samples`.`tags` = $p0)", condition)
+	assert.Equal(t, map[string]interface{}{"p0": []interface{}{"biopsy", "blood"}}, b.Params())
+
+	_, err = compileFilterGroup(newCypherBuilder(), query.FilterGroup{Or: []query.FilterGroup{}}, modelProps)
+	assert.IsType(t, &models.InvalidFilterError{}, err)
+
+	_, err = compileFilterGroup(newCypherBuilder(), query.FilterGroup{
+		Filters: query.Filters{Model: "patient", Property: "age", Operator: "=", Value: "1"},
+		Not:     &query.FilterGroup{},
+	}, modelProps)
+	assert.IsType(t, &models.InvalidFilterError{}, err)
+}
+
+func testCompileFilterOperators(t *testing.T, _ *ModelServiceStore) {
+	modelProps := map[string][]models.ModelProperty{
+		"patient": {
+			{Name: "name", DataType: models.DataType{Type: models.STRING}, IsModelTitle: true},
+			{Name: "age", DataType: models.DataType{Type: models.LONG}},
+			{Name: "tags", DataType: models.DataType{Type: models.STRING, IsArray: true}},
+		},
+	}
+
+	for _, c := range []struct {
+		operator  string
+		property  string
+		value     interface{}
+		condition string
+		params    map[string]interface{}
+	}{
+		{"GREATER_THAN", "age", 60.0, "(`patient`.`age` > $p0)", map[string]interface{}{"p0": int64(60)}},
+		{">", "age", "60", "(`patient`.`age` > $p0)", map[string]interface{}{"p0": int64(60)}},
+		{"IS_NOT", "name", "Joe", "(`patient`.`name` <> $p0)", map[string]interface{}{"p0": "Joe"}},
+		{"IN", "age", []interface{}{1.0, "2"}, "(`patient`.`age` IN $p0)",
+			map[string]interface{}{"p0": []interface{}{int64(1), int64(2)}}},
+		{"NOT_IN", "age", []interface{}{1.0}, "(NOT (`patient`.`age` IN $p0))",
+			map[string]interface{}{"p0": []interface{}{int64(1)}}},
+		{"NOT_IN", "tags", []interface{}{"a"}, "NONE(v IN `patient`.`tags` WHERE v IN $p0)",
+			map[string]interface{}{"p0": []interface{}{"a"}}},
+		{"IS_NULL", "age", nil, "(`patient`.`age` IS NULL)", map[string]interface{}{}},
+		{"IS_NOT_NULL", "tags", nil, "(`patient`.`tags` IS NOT NULL)", map[string]interface{}{}},
+		{"BETWEEN", "age", []interface{}{18.0, 65.0}, "(`patient`.`age` >= $p0 AND `patient`.`age` <= $p1)",
+			map[string]interface{}{"p0": int64(18), "p1": int64(65)}},
+		{"ENDS_WITH", "name", "son", "(`patient`.`name` ENDS WITH $p0)", map[string]interface{}{"p0": "son"}},
+		{"CONTAINS_IGNORE_CASE", "tags", "BioPsy", "ANY(v IN `patient`.`tags` WHERE toLower(v) CONTAINS $p0)",
+			map[string]interface{}{"p0": "biopsy"}},
+		{"EQUALS", "tags", []interface{}{"a", "b"}, "(`patient`.`tags` = $p0)",
+			map[string]interface{}{"p0": []interface{}{"a", "b"}}},
+	} {
+		b := newCypherBuilder()
+		condition, err := compileFilterGroup(b, query.FilterGroup{Filters: query.Filters{
+			Model: "patient", Property: c.property, Operator: c.operator, Value: c.value}}, modelProps)
+		assert.NoError(t, err, c.operator)
+		assert.Equal(t, c.condition, condition, c.operator)
+		assert.Equal(t, c.params, b.Params(), c.operator)
+	}
+
+	_, err := compileFilterGroup(newCypherBuilder(), query.FilterGroup{
+		Filters: query.Filters{Model: "patient", Property: "age", Operator: "BETWEEN", Value: []interface{}{1.0}}}, modelProps)
+	assert.EqualError(t, err, "Invalid filter: patient.age: BETWEEN requires an array of two Long values")
 
+	_, err = compileFilterGroup(newCypherBuilder(), query.FilterGroup{
+		Filters: query.Filters{Model: "patient", Property: "age", Operator: "IN", Value: 1.0}}, modelProps)
+	assert.IsType(t, &models.InvalidFilterError{}, err)
+
+	_, err = compileFilterGroup(newCypherBuilder(), query.FilterGroup{
+		Filters: query.Filters{Model: "patient", Property: "age", Operator: "EQUALS_IGNORE_CASE", Value: "1"}}, modelProps)
+	assert.IsType(t, &models.UnsupportedOperatorError{}, err)
+}
+
+func testCompileAggregate(t *testing.T, _ *ModelServiceStore) {
+	modelProps := map[string][]models.ModelProperty{
+		"samples": {
+			{Name: "weight", DataType: models.DataType{Type: models.DOUBLE, Unit: "mg"}},
+			{Name: "tags", DataType: models.DataType{Type: models.STRING, IsArray: true}},
+		},
+		"visits": {{Name: "site", DataType: models.DataType{Type: models.STRING}}},
+	}
+	paths := []dbtype.Path{{
+		Nodes: []dbtype.Node{
+			{Props: map[string]any{"name": "samples", "id": "9609bfb8-c7a1-45d5-b683-de2e39788cc0"}},
+			{Props: map[string]any{"name": "visits", "id": "42eb7c3e-ac34-4ff1-ad20-672e5b7b97ee"}},
+		},
+		Relationships: []dbtype.Relationship{{Props: map[string]any{"type": "SAMPLE_BELONGS_TO_VISIT"}}},
+	}}
+
+	agg := query.Aggregate{
+		Aggregations: []query.Aggregation{
+			{Function: "count"},
+			{PropertyRef: query.PropertyRef{Property: "weight"}, Function: "AVG"},
+			{PropertyRef: query.PropertyRef{Property: "tags"}, Function: "count_distinct"},
+		},
+		GroupBy: []query.PropertyRef{{Model: "visits", Property: "site"}},
+	}.WithModel("samples")
+
+	groupBy, aggregations, err := aggregateColumns(agg, modelProps)
+	assert.NoError(t, err)
+	assert.Equal(t, []query.AggregateColumn{
+		{Model: "visits", Property: "site", DataType: models.DataType{Type: models.STRING}},
+	}, groupBy)
+	assert.Equal(t, []query.AggregateColumn{
+		{Model: "samples", Function: "count", DataType: models.DataType{Type: models.LONG}},
+		{Model: "samples", Property: "weight", Function: "avg", DataType: models.DataType{Type: models.DOUBLE}},
+		{Model: "samples", Property: "tags", Function: "count_distinct", DataType: models.DataType{Type: models.LONG}},
+	}, aggregations)
+
+	// Models that are only in the aggregate are matched optionally, so samples without visits are grouped by null
+	cql, params, err := generateQuery(models.Model{ID: "9609bfb8-c7a1-45d5-b683-de2e39788cc0", Name: "samples"},
+		nil, paths, nil, modelProps, nil, query.FormatParams{ResultType: query.AGGREGATE, Aggregate: agg}, 100, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "MATCH (`Msamples`:Model{id:$p0})<-[:`@INSTANCE_OF`]-(`samples`:Record) "+
+		"OPTIONAL MATCH (`samples`)-[:`SAMPLE_BELONGS_TO_VISIT`]-(`visits`:Record)-[:`@INSTANCE_OF`]->"+
+		"(`Mvisits`:Model{id:$p1}) WITH DISTINCT `samples`, `visits` "+
+		"RETURN `visits`.`site` AS g0, count(DISTINCT `samples`) AS a0, avg(`samples`.`weight`) AS a1, "+
+		"count(DISTINCT `samples`.`tags`) AS a2 ORDER BY g0 SKIP $p2 LIMIT $p3", cql)
+	assert.Equal(t, 100, params["p3"])
+
+	_, _, err = aggregateColumns(query.Aggregate{Aggregations: []query.Aggregation{
+		{PropertyRef: query.PropertyRef{Model: "samples", Property: "tags"}, Function: "sum"}}}, modelProps)
+	assert.EqualError(t, err, "Invalid aggregate: sum does not apply to String property tags")
+
+	_, _, err = aggregateColumns(query.Aggregate{Aggregations: []query.Aggregation{
+		{PropertyRef: query.PropertyRef{Model: "samples"}, Function: "max"}}}, modelProps)
+	assert.IsType(t, &models.InvalidAggregateError{}, err)
+
+	_, _, err = aggregateColumns(query.Aggregate{Aggregations: []query.Aggregation{
+		{PropertyRef: query.PropertyRef{Model: "samples", Property: "weight"}, Function: "median"}}}, modelProps)
+	assert.EqualError(t, err, "Invalid aggregate: unsupported function: median")
+
+	_, _, err = aggregateColumns(query.Aggregate{}, modelProps)
+	assert.IsType(t, &models.InvalidAggregateError{}, err)
 }
 
 func testInitOrgAndDataset(t *testing.T, s *ModelServiceStore) {
@@ -322,151 +580,1816 @@ func testCreateModel(t *testing.T, s *ModelServiceStore) {
 
 }
 
-func testPackageAncestors(t *testing.T, s *ModelServiceStore) {
+func testCreateModelTx(t *testing.T, s *ModelServiceStore) {
+	ctx := context.Background()
 
-	orgId := 2
-	datasetId := 1
+	// Dataset does not exist in the graph yet and should be created alongside the model.
+	model, err := s.CreateModelTx(ctx, 2, 1, "N:Dataset:456", "N:Org:123",
+		"Model_2", "Model 2", "This is a description", "N:User:1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Model_2", model.Name)
 
-	s.WithOrg(orgId)
+	_, err = s.CreateModelTx(ctx, 2, 1, "N:Dataset:456", "N:Org:123",
+		"file", "File", "", "N:User:1")
+	assert.Equal(t, &models.ReservedNameError{Name: "file"}, err)
 
-	defer func() {
-		truncate(t, s.pgdb, orgId, "packages")
-		truncate(t, s.pgdb, orgId, "files")
-		truncate(t, s.pgdb, orgId, "package_storage")
-		truncate(t, s.pgdb, orgId, "organization_storage")
-		truncate(t, s.pgdb, orgId, "dataset_storage")
-	}()
+	_, err = s.CreateModelTx(ctx, 2, 1, "N:Dataset:456", "N:Org:123",
+		"1_invalid", "Invalid", "", "N:User:1")
+	assert.Equal(t, &models.ValidationError{Name: "1_invalid"}, err)
 
-	// ADD FOLDER TO ROOT
-	uploadId, _ := uuid.NewUUID()
-	folderParams := pgdb2.PackageParams{
-		Name:         "Folder1",
-		PackageType:  packageType.Collection,
-		PackageState: packageState.Ready,
-		NodeId:       fmt.Sprintf("N:Package:%s", uploadId.String()),
-		ParentId:     -1,
-		DatasetId:    datasetId,
-		OwnerId:      1,
-		Size:         1000, // should be ignored
-		ImportId:     sql.NullString{String: uploadId.String(), Valid: true},
-		Attributes:   []packageInfo.PackageAttribute{},
-	}
+	t.Cleanup(func() {
+		cql := "MATCH (n:Model {name: 'Model_2'}) OPTIONAL MATCH (n)-[r]-() DELETE n, r"
+		_, err := s.neodb.Run(context.Background(), cql, nil)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	})
+}
 
-	folder1, err := s.pg.AddFolder(context.Background(), folderParams)
+func testUpdateDeleteModel(t *testing.T, s *ModelServiceStore) {
+	ctx := context.Background()
+
+	model, err := s.CreateModelTx(ctx, 1, 1, "N:Dataset:123", "N:Org:123",
+		"Model_3", "Model 3", "This is a description", "N:User:1")
 	assert.NoError(t, err)
 
-	// ADD NESTED FOLDER
-	uploadId, _ = uuid.NewUUID()
-	folderParams = pgdb2.PackageParams{
-		Name:         "Folder2",
-		PackageType:  packageType.Collection,
-		PackageState: packageState.Ready,
-		NodeId:       fmt.Sprintf("N:Package:%s", uploadId.String()),
-		ParentId:     folder1.Id,
-		DatasetId:    datasetId,
-		OwnerId:      1,
-		Size:         1000, // should be ignored
-		ImportId:     sql.NullString{String: uploadId.String(), Valid: true},
-		Attributes:   []packageInfo.PackageAttribute{},
-	}
+	newName := "Updated Model 3"
+	updated, err := s.UpdateModelTx(ctx, 1, 1, model.ID, &newName, nil, "N:User:2")
+	assert.NoError(t, err)
+	assert.Equal(t, newName, updated.DisplayName)
+	assert.Equal(t, "This is a description", updated.Description)
+	assert.Equal(t, "N:User:2", updated.UpdatedBy)
+	assert.Equal(t, "N:User:1", updated.CreatedBy)
 
-	folder2, err := s.pg.AddFolder(context.Background(), folderParams)
+	// Add a record to the model, which prevents deletion without cascade.
+	cql := "MATCH (m:Model{id: $modelId}) CREATE (:Record{`@id`: randomUUID(), `@sort_key`: 1})-[:`@INSTANCE_OF`]->(m)"
+	_, err = s.neodb.Run(ctx, cql, map[string]any{"modelId": model.ID})
 	assert.NoError(t, err)
 
-	// Test adding packages to root
-	testPackageNodeId := "N:Package:1"
-	testParams := []testPackageParams{
-		{Name: "package_7.txt", ParentId: folder2.Id, NodeId: testPackageNodeId},
+	err = s.DeleteModelTx(ctx, 1, 1, model.ID, false)
+	assert.Equal(t, &models.ModelHasRecordsError{Name: "Model_3", Count: 1}, err)
+
+	err = s.DeleteModelTx(ctx, 1, 1, model.ID, true)
+	assert.NoError(t, err)
+
+	_, err = s.neo.GetModelById(ctx, 1, 1, model.ID)
+	assert.Equal(t, &models.UnknownModelError{Model: model.ID}, err)
+}
+
+func testMergeModelProperties(t *testing.T, _ *ModelServiceStore) {
+	stringType := &models.DataType{Type: models.STRING}
+	longType := &models.DataType{Type: models.LONG}
+	doubleType := &models.DataType{Type: models.DOUBLE, Unit: "kg"}
+
+	existing := []models.ModelProperty{
+		{ID: "1", Name: "name", DataType: *stringType, IsModelTitle: true, Index: 0},
+		{ID: "2", Name: "age", DataType: *longType, Index: 1},
+		{ID: "3", Name: "weight", DataType: *doubleType, Index: 2},
 	}
 
-	insertParams := GenerateTestPackages(testParams, datasetId)
-	_, err = s.pg.AddPackages(context.Background(), insertParams)
+	index := int64(1)
+	props, removed, retyped, err := mergeModelProperties(existing, models.UpdateModelPropertiesRequestBody{
+		Properties: []models.ModelPropertyRequest{
+			{Name: "height", DataType: doubleType, Index: &index},
+			{Name: "age", DataType: stringType},
+		},
+		Remove: []string{"weight"},
+	})
 	assert.NoError(t, err)
+	assert.Equal(t, []string{"weight"}, removed)
+	assert.Equal(t, []string{"age"}, retyped)
+
+	var names []string
+	for i, p := range props {
+		assert.Equal(t, int64(i), p.Index)
+		names = append(names, p.Name)
+	}
+	assert.Equal(t, []string{"name", "height", "age"}, names)
+	assert.Equal(t, "2", props[2].ID)
+	assert.Equal(t, "height", props[1].DisplayName)
+
+	_, _, _, err = mergeModelProperties(existing, models.UpdateModelPropertiesRequestBody{
+		Properties: []models.ModelPropertyRequest{{Name: "label", DataType: stringType, IsModelTitle: true}},
+	})
+	assert.Equal(t, &models.ModelTitleError{Count: 2}, err)
+
+	_, _, _, err = mergeModelProperties(existing, models.UpdateModelPropertiesRequestBody{
+		Properties: []models.ModelPropertyRequest{{Name: "@sort_key", DataType: longType}},
+	})
+	assert.Equal(t, &models.ReservedNameError{Name: "@sort_key"}, err)
+
+	_, _, _, err = mergeModelProperties(existing, models.UpdateModelPropertiesRequestBody{
+		Remove: []string{"unknown"},
+	})
+	assert.Equal(t, &models.UnknownModelPropertyError{PropName: "unknown"}, err)
+
+	_, _, _, err = mergeModelProperties(existing, models.UpdateModelPropertiesRequestBody{
+		Properties: []models.ModelPropertyRequest{{Name: "height", DataType: doubleType, DefaultValue: "tall"}},
+	})
+	assert.Equal(t, &models.InvalidPropertyError{PropName: "height", Reason: "invalid default: expected Double, got string"}, err)
+}
 
+func testUpdateModelProperties(t *testing.T, s *ModelServiceStore) {
 	ctx := context.Background()
-	ancestors, err := s.pg.GetPackageAncestors(ctx, testPackageNodeId)
+	stringType := &models.DataType{Type: models.STRING}
+	longType := &models.DataType{Type: models.LONG}
+
+	model, err := s.CreateModelTx(ctx, 1, 1, "N:Dataset:123", "N:Org:123",
+		"Model_4", "Model 4", "This is a description", "N:User:1")
 	assert.NoError(t, err)
-	assert.Len(t, ancestors, 3)
-	assert.Equal(t, testPackageNodeId, ancestors[0].NodeId, "Expecting the first index of result to be the requested package")
-	assert.Equal(t, folderParams.NodeId, ancestors[1].NodeId, "Expecting 2nd index of result to be the nested folder")
-	assert.Equal(t, false, ancestors[2].ParentId.Valid, "Expecting 3rd index of result to be the root folder")
 
-}
+	props, err := s.UpdateModelPropertiesTx(ctx, 1, 1, model.ID, models.UpdateModelPropertiesRequestBody{
+		Properties: []models.ModelPropertyRequest{
+			{Name: "name", DataType: stringType, IsModelTitle: true},
+			{Name: "age", DataType: longType},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, props, 2)
 
-type testPackageParams struct {
-	Name     string
-	ParentId int64
-	NodeId   string
-}
+	cql := "MATCH (m:Model{id: $modelId}) CREATE (:Record{`@id`: randomUUID(), `@sort_key`: 1, name: 'a', age: 5})-[:`@INSTANCE_OF`]->(m)"
+	_, err = s.neodb.Run(ctx, cql, map[string]any{"modelId": model.ID})
+	assert.NoError(t, err)
 
-func truncate(t *testing.T, db *sql.DB, orgID int, table string) {
+	_, err = s.UpdateModelPropertiesTx(ctx, 1, 1, model.ID, models.UpdateModelPropertiesRequestBody{
+		Remove: []string{"age"},
+	})
+	assert.Equal(t, &models.PropertyInUseError{PropName: "age", Count: 1}, err)
 
-	var query string
+	// Values that cannot be converted to the new data type are not removed when migrating
+	cql = "MATCH (m:Model{id: $modelId}) CREATE (:Record{`@id`: randomUUID(), `@sort_key`: 2, name: 'b5'})-[:`@INSTANCE_OF`]->(m)"
+	_, err = s.neodb.Run(ctx, cql, map[string]any{"modelId": model.ID})
+	assert.NoError(t, err)
 
-	switch table {
-	case "organization_storage":
-		query = fmt.Sprintf("TRUNCATE TABLE pennsieve.%s CASCADE", table)
-	default:
-		query = fmt.Sprintf("TRUNCATE TABLE \"%d\".%s CASCADE", orgID, table)
+	_, err = s.UpdateModelPropertiesTx(ctx, 1, 1, model.ID, models.UpdateModelPropertiesRequestBody{
+		Properties: []models.ModelPropertyRequest{{Name: "name", DataType: longType, IsModelTitle: true}},
+		Migrate:    true,
+	})
+	assert.Equal(t, &models.PropertyConversionError{PropName: "name", DataType: models.LONG, Count: 2}, err)
+
+	result, err := s.neodb.Run(ctx, "MATCH (:Model{id: $modelId})<-[:`@INSTANCE_OF`]-(r:Record) "+
+		"RETURN r.name AS name ORDER BY r.`@sort_key`", map[string]any{"modelId": model.ID})
+	assert.NoError(t, err)
+	names, err := result.Collect(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, names, 2) {
+		assert.Equal(t, []any{"a"}, names[0].Values)
+		assert.Equal(t, []any{"b5"}, names[1].Values)
 	}
 
-	_, err := db.Exec(query)
+	// Values of types that a conversion does not accept, and conversions to Date or arrays, are refused
+	_, err = s.UpdateModelPropertiesTx(ctx, 1, 1, model.ID, models.UpdateModelPropertiesRequestBody{
+		Properties: []models.ModelPropertyRequest{
+			{Name: "active", DataType: &models.DataType{Type: models.BOOLEAN}},
+			{Name: "tags", DataType: &models.DataType{Type: models.STRING, IsArray: true}},
+		},
+	})
+	assert.NoError(t, err)
+	cql = "MATCH (:Model{id: $modelId})<-[:`@INSTANCE_OF`]-(r:Record{name: 'a'}) SET r.active = true, r.tags = ['x', 'y']"
+	_, err = s.neodb.Run(ctx, cql, map[string]any{"modelId": model.ID})
 	assert.NoError(t, err)
-}
 
-func GenerateTestPackages(params []testPackageParams, datasetId int) []pgdb2.PackageParams {
+	for _, c := range []struct {
+		name     string
+		dataType models.DataType
+	}{
+		{name: "age", dataType: models.DataType{Type: models.BOOLEAN}},
+		{name: "active", dataType: models.DataType{Type: models.LONG}},
+		{name: "tags", dataType: models.DataType{Type: models.STRING}},
+		{name: "age", dataType: models.DataType{Type: models.DATE}},
+		{name: "age", dataType: models.DataType{Type: models.LONG, IsArray: true}},
+	} {
+		_, err = s.UpdateModelPropertiesTx(ctx, 1, 1, model.ID, models.UpdateModelPropertiesRequestBody{
+			Properties: []models.ModelPropertyRequest{{Name: c.name, DataType: &c.dataType}},
+			Migrate:    true,
+		})
+		assert.Equal(t, &models.PropertyConversionError{PropName: c.name, DataType: c.dataType.Type, Count: 1}, err)
+	}
 
-	var result []pgdb2.PackageParams
+	_, err = s.UpdateModelPropertiesTx(ctx, 1, 1, model.ID, models.UpdateModelPropertiesRequestBody{
+		Properties: []models.ModelPropertyRequest{{Name: "active", DataType: stringType}},
+		Migrate:    true,
+	})
+	assert.NoError(t, err)
 
-	attr := []packageInfo.PackageAttribute{
-		{
-			Key:      "subtype",
-			Fixed:    false,
-			Value:    "Image",
-			Hidden:   true,
-			Category: "Pennsieve",
-			DataType: "string",
-		}, {
-			Key:      "icon",
-			Fixed:    false,
-			Value:    "Microscope",
-			Hidden:   true,
-			Category: "Pennsieve",
-			DataType: "string",
-		},
+	result, err = s.neodb.Run(ctx, "MATCH (:Model{id: $modelId})<-[:`@INSTANCE_OF`]-(r:Record{name: 'a'}) "+
+		"RETURN r.age AS age, r.active AS active, r.tags AS tags", map[string]any{"modelId": model.ID})
+	assert.NoError(t, err)
+	values, err := result.Single(ctx)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []any{int64(5), "true", []any{"x", "y"}}, values.Values)
 	}
 
-	for _, p := range params {
-		var uploadId string
-		var nodeId string
-		if p.NodeId == "" {
-			u, _ := uuid.NewUUID()
-			uploadId = u.String()
-			nodeId = fmt.Sprintf("N:Package:%s", u.String())
-		} else {
-			u, _ := uuid.NewUUID()
-			uploadId = u.String()
-			nodeId = p.NodeId
+	props, err = s.UpdateModelPropertiesTx(ctx, 1, 1, model.ID, models.UpdateModelPropertiesRequestBody{
+		Remove:  []string{"age", "active", "tags"},
+		Migrate: true,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, props, 1)
+
+	modelProps, err := s.neo.GetModelsProps(ctx, 1, 1, []string{"Model_4", "unknown"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]models.ModelProperty{"Model_4": props}, modelProps)
+
+	t.Cleanup(func() {
+		err := s.DeleteModelTx(context.Background(), 1, 1, model.ID, true)
+		if err != nil {
+			log.Fatalln(err)
 		}
+	})
+}
 
-		insertPackage := pgdb2.PackageParams{
-			Name:         p.Name,
-			PackageType:  packageType.Image,
-			PackageState: packageState.Unavailable,
-			NodeId:       nodeId,
-			ParentId:     p.ParentId,
-			DatasetId:    datasetId,
-			OwnerId:      1,
-			Size:         1000,
-			ImportId: sql.NullString{
-				String: uploadId,
-				Valid:  true,
-			},
-			Attributes: attr,
+func testRecordCRUD(t *testing.T, s *ModelServiceStore) {
+	ctx := context.Background()
+
+	model, err := s.CreateModelTx(ctx, 1, 1, "N:Dataset:123", "N:Org:123",
+		"Model_5", "Model 5", "This is a description", "N:User:1")
+	assert.NoError(t, err)
+
+	_, err = s.UpdateModelPropertiesTx(ctx, 1, 1, model.ID, models.UpdateModelPropertiesRequestBody{
+		Properties: []models.ModelPropertyRequest{
+			{Name: "name", DataType: &models.DataType{Type: models.STRING}, IsModelTitle: true},
+			{Name: "age", DataType: &models.DataType{Type: models.LONG}},
+		},
+	})
+	assert.NoError(t, err)
+
+	record, err := s.CreateRecordTx(ctx, 1, 1, "Model_5", map[string]interface{}{"name": "Joe", "age": 42.0}, "N:User:1")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "Joe", "age": int64(42)}, record.Props)
+
+	second, err := s.CreateRecordTx(ctx, 1, 1, model.ID, map[string]interface{}{"name": "Jane"}, "N:User:1")
+	assert.NoError(t, err)
+
+	_, err = s.CreateRecordTx(ctx, 1, 1, "Model_5", map[string]interface{}{"name": "Joe", "age": "old"}, "N:User:1")
+	assert.IsType(t, &models.RecordValidationError{}, err)
+
+	fetched, err := s.GetRecord(ctx, 1, 1, "Model_5", record.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, record, fetched)
+
+	updated, err := s.UpdateRecordTx(ctx, 1, 1, "Model_5", record.ID, map[string]interface{}{"name": "Joseph"}, "N:User:2")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "Joseph"}, updated.Props)
+
+	// Sort keys are assigned sequentially per model
+	result, err := s.neodb.Run(ctx, "MATCH (r:Record) WHERE r.`@id` IN $ids RETURN r.`@sort_key` AS sortKey ORDER BY sortKey",
+		map[string]any{"ids": []string{record.ID, second.ID}})
+	assert.NoError(t, err)
+	sortKeys, err := result.Collect(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, sortKeys, 2)
+	assert.Equal(t, []any{int64(1)}, sortKeys[0].Values)
+	assert.Equal(t, []any{int64(2)}, sortKeys[1].Values)
+
+	err = s.DeleteRecordTx(ctx, 1, 1, "Model_5", record.ID)
+	assert.NoError(t, err)
+
+	_, err = s.GetRecord(ctx, 1, 1, "Model_5", record.ID)
+	assert.Equal(t, &models.UnknownRecordError{ID: record.ID}, err)
+
+	t.Cleanup(func() {
+		err := s.DeleteModelTx(context.Background(), 1, 1, model.ID, true)
+		if err != nil {
+			log.Fatalln(err)
 		}
+	})
+}
 
-		result = append(result, insertPackage)
+func testRecordsBatch(t *testing.T, s *ModelServiceStore) {
+	ctx := context.Background()
+
+	model, err := s.CreateModelTx(ctx, 1, 1, "N:Dataset:123", "N:Org:123",
+		"Model_6", "Model 6", "This is a description", "N:User:1")
+	assert.NoError(t, err)
+
+	_, err = s.UpdateModelPropertiesTx(ctx, 1, 1, model.ID, models.UpdateModelPropertiesRequestBody{
+		Properties: []models.ModelPropertyRequest{
+			{Name: "name", DataType: &models.DataType{Type: models.STRING}, IsModelTitle: true},
+			{Name: "age", DataType: &models.DataType{Type: models.LONG}},
+		},
+	})
+	assert.NoError(t, err)
+
+	rows := []models.RecordRequestBody{
+		{Props: map[string]interface{}{"name": "a", "age": 1.0}},
+		{Props: map[string]interface{}{"name": "b", "age": "two"}},
+		{Props: map[string]interface{}{"name": "c"}},
+	}
+
+	response, err := s.CreateRecordsBatchTx(ctx, 1, 1, "Model_6", rows, true, "N:User:1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, response.Created)
+	assert.Equal(t, 1, response.Failed)
+	assert.Equal(t, models.BatchRecordFailed, response.Results[1].Status)
+	assert.Equal(t, "age", response.Results[1].Errors[0].Property)
+	createdId := response.Results[0].ID
+
+	// Re-running the batch updates the existing records instead of creating new ones.
+	rows[0].Props["age"] = 10.0
+	rows = append(rows, models.RecordRequestBody{Props: map[string]interface{}{"name": "a"}})
+	response, err = s.CreateRecordsBatchTx(ctx, 1, 1, "Model_6", rows, true, "N:User:1")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, response.Created)
+	assert.Equal(t, 2, response.Updated)
+	assert.Equal(t, 2, response.Failed)
+	assert.Equal(t, createdId, response.Results[0].ID)
+	assert.Equal(t, models.BatchRecordFailed, response.Results[3].Status)
+
+	record, err := s.GetRecord(ctx, 1, 1, "Model_6", createdId)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), record.Props["age"])
+
+	t.Cleanup(func() {
+		err := s.DeleteModelTx(context.Background(), 1, 1, model.ID, true)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	})
+}
+
+func testImportRecords(t *testing.T, s *ModelServiceStore) {
+	ctx := context.Background()
+
+	model, err := s.CreateModelTx(ctx, 1, 1, "N:Dataset:123", "N:Org:123",
+		"Model_7", "Model 7", "This is a description", "N:User:1")
+	assert.NoError(t, err)
+
+	header := []string{"Subject ID", "Age", "Weight (kg)"}
+	rows := [][]string{
+		{"s1", "10", "20.5"},
+		{"s2", "", "31"},
+		{"s3", "old", "12"},
+	}
+
+	// A dry run reports the properties and records that would be created without writing them.
+	response, err := s.ImportRecordsTx(ctx, 1, 1, "Model_7", header, rows,
+		models.ImportOptions{CreateProperties: true, DryRun: true}, "N:User:1")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, response.Created)
+	assert.Len(t, response.CreatedProperties, 3)
+	assert.True(t, response.CreatedProperties[0].IsModelTitle)
+	assert.Equal(t, models.DataType{Type: models.STRING}, response.CreatedProperties[1].DataType)
+
+	props, err := s.neo.GetModelProps(ctx, 1, 1, "Model_7")
+	assert.NoError(t, err)
+	assert.Empty(t, props)
+
+	response, err = s.ImportRecordsTx(ctx, 1, 1, "Model_7", header, rows,
+		models.ImportOptions{CreateProperties: true, Mapping: map[string]string{"Age": ""}}, "N:User:1")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, response.Created)
+	assert.Equal(t, "Subject_ID", response.CreatedProperties[0].Name)
+	assert.Equal(t, models.DataType{Type: models.DOUBLE}, response.CreatedProperties[1].DataType)
+
+	record, err := s.GetRecord(ctx, 1, 1, "Model_7", response.Results[1].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"Subject_ID": "s2", "Weight_kg": 31.0}, record.Props)
+
+	// Re-importing with upsert updates records matched on the model title, and ignores unknown columns.
+	rows[0][2] = "heavy"
+	response, err = s.ImportRecordsTx(ctx, 1, 1, "Model_7", header, rows,
+		models.ImportOptions{Upsert: true}, "N:User:1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, response.Updated)
+	assert.Equal(t, 1, response.Failed)
+	assert.Equal(t, []string{"Age"}, response.IgnoredColumns)
+	assert.Equal(t, "Weight_kg", response.Results[0].Errors[0].Property)
+
+	_, err = s.ImportRecordsTx(ctx, 1, 1, "Model_7", header, rows,
+		models.ImportOptions{Mapping: map[string]string{"Age": "age"}}, "N:User:1")
+	assert.Equal(t, &models.UnknownModelPropertyError{PropName: "age"}, err)
+
+	t.Cleanup(func() {
+		err := s.DeleteModelTx(context.Background(), 1, 1, model.ID, true)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	})
+}
+
+func testExportQuery(t *testing.T, s *ModelServiceStore) {
+	ctx := context.Background()
+
+	model, err := s.CreateModelTx(ctx, 1, 1, "N:Dataset:123", "N:Org:123",
+		"Model_8", "Model 8", "This is a description", "N:User:1")
+	assert.NoError(t, err)
+
+	_, err = s.UpdateModelPropertiesTx(ctx, 1, 1, model.ID, models.UpdateModelPropertiesRequestBody{
+		Properties: []models.ModelPropertyRequest{
+			{Name: "name", DataType: &models.DataType{Type: models.STRING}, IsModelTitle: true},
+			{Name: "scores", DataType: &models.DataType{Type: models.LONG, IsArray: true}},
+		},
+	})
+	assert.NoError(t, err)
+
+	var rows []models.RecordRequestBody
+	for i := 0; i < exportPageSize+5; i++ {
+		rows = append(rows, models.RecordRequestBody{
+			Props: map[string]interface{}{"name": fmt.Sprintf("r%d", i), "scores": []interface{}{1.0, 2.0}}})
+	}
+	_, err = s.CreateRecordsBatchTx(ctx, 1, 1, "Model_8", rows, false, "N:User:1")
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	count, err := s.ExportQueryGraph(ctx, query.QueryRequestBody{Model: "Model_8"}, 1, 1, &buf, query.CSV)
+	assert.NoError(t, err)
+	assert.Equal(t, exportPageSize+5, count)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, exportPageSize+6)
+	assert.Equal(t, "'@id,name,scores", lines[0])
+	assert.True(t, strings.HasSuffix(lines[1], ",r0,1;2"))
+
+	// Pages continue after the cursor of the previous page, so each record is written once
+	ids := map[string]bool{}
+	for _, line := range lines[1:] {
+		ids[strings.Split(line, ",")[0]] = true
+	}
+	assert.Len(t, ids, exportPageSize+5)
+
+	count, err = s.ExportQueryGraph(ctx, query.QueryRequestBody{Model: "Model_8", Limit: 3, Offset: 2}, 1, 1,
+		&bytes.Buffer{}, query.NDJSON)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	t.Cleanup(func() {
+		err := s.DeleteModelTx(context.Background(), 1, 1, model.ID, true)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	})
+}
+
+func testAggregateQuery(t *testing.T, s *ModelServiceStore) {
+	ctx := context.Background()
+
+	model, err := s.CreateModelTx(ctx, 1, 1, "N:Dataset:123", "N:Org:123",
+		"Model_9", "Model 9", "This is a description", "N:User:1")
+	assert.NoError(t, err)
+
+	_, err = s.UpdateModelPropertiesTx(ctx, 1, 1, model.ID, models.UpdateModelPropertiesRequestBody{
+		Properties: []models.ModelPropertyRequest{
+			{Name: "name", DataType: &models.DataType{Type: models.STRING}, IsModelTitle: true},
+			{Name: "site", DataType: &models.DataType{Type: models.STRING}},
+			{Name: "age", DataType: &models.DataType{Type: models.LONG}},
+		},
+	})
+	assert.NoError(t, err)
+
+	var rows []models.RecordRequestBody
+	for i, site := range []string{"A", "A", "B", "A", "B"} {
+		rows = append(rows, models.RecordRequestBody{
+			Props: map[string]interface{}{"name": fmt.Sprintf("r%d", i), "site": site, "age": float64(10 * (i + 1))}})
+	}
+	_, err = s.CreateRecordsBatchTx(ctx, 1, 1, "Model_9", rows, false, "N:User:1")
+	assert.NoError(t, err)
+
+	res, err := s.AggregateQueryGraph(ctx, query.QueryRequestBody{
+		Model: "Model_9",
+		Where: &query.FilterGroup{Filters: query.Filters{Model: "Model_9", Property: "age", Operator: "LESS_THAN", Value: 50.0}},
+		Aggregate: &query.Aggregate{
+			Aggregations: []query.Aggregation{
+				{Function: "count"},
+				{PropertyRef: query.PropertyRef{Property: "age"}, Function: "sum"},
+				{PropertyRef: query.PropertyRef{Property: "age"}, Function: "max"},
+			},
+			GroupBy: []query.PropertyRef{{Property: "site"}},
+		},
+	}, 1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []query.AggregateGroup{
+		{Keys: []interface{}{"A"}, Values: []interface{}{int64(3), int64(70), int64(40)}},
+		{Keys: []interface{}{"B"}, Values: []interface{}{int64(1), int64(30), int64(30)}},
+	}, res.Groups)
+
+	_, err = s.AggregateQueryGraph(ctx, query.QueryRequestBody{
+		Model:     "Model_9",
+		Aggregate: &query.Aggregate{Aggregations: []query.Aggregation{{Function: "count"}}, GroupBy: []query.PropertyRef{{Property: "weight"}}},
+	}, 1, 1)
+	assert.Equal(t, &models.UnknownModelPropertyError{PropName: "weight"}, err)
+
+	t.Cleanup(func() {
+		err := s.DeleteModelTx(context.Background(), 1, 1, model.ID, true)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	})
+}
+
+func testPackageAncestors(t *testing.T, s *ModelServiceStore) {
+
+	orgId := 2
+	datasetId := 1
+
+	s.WithOrg(orgId)
+
+	defer func() {
+		truncate(t, s.pgdb, orgId, "packages")
+		truncate(t, s.pgdb, orgId, "files")
+		truncate(t, s.pgdb, orgId, "package_storage")
+		truncate(t, s.pgdb, orgId, "organization_storage")
+		truncate(t, s.pgdb, orgId, "dataset_storage")
+	}()
+
+	// ADD FOLDER TO ROOT
+	uploadId, _ := uuid.NewUUID()
+	folderParams := pgdb2.PackageParams{
+		Name:         "Folder1",
+		PackageType:  packageType.Collection,
+		PackageState: packageState.Ready,
+		NodeId:       fmt.Sprintf("N:Package:%s", uploadId.String()),
+		ParentId:     -1,
+		DatasetId:    datasetId,
+		OwnerId:      1,
+		Size:         1000, // should be ignored
+		ImportId:     sql.NullString{String: uploadId.String(), Valid: true},
+		Attributes:   []packageInfo.PackageAttribute{},
+	}
+
+	folder1, err := s.pg.AddFolder(context.Background(), folderParams)
+	assert.NoError(t, err)
+
+	// ADD NESTED FOLDER
+	uploadId, _ = uuid.NewUUID()
+	folderParams = pgdb2.PackageParams{
+		Name:         "Folder2",
+		PackageType:  packageType.Collection,
+		PackageState: packageState.Ready,
+		NodeId:       fmt.Sprintf("N:Package:%s", uploadId.String()),
+		ParentId:     folder1.Id,
+		DatasetId:    datasetId,
+		OwnerId:      1,
+		Size:         1000, // should be ignored
+		ImportId:     sql.NullString{String: uploadId.String(), Valid: true},
+		Attributes:   []packageInfo.PackageAttribute{},
+	}
+
+	folder2, err := s.pg.AddFolder(context.Background(), folderParams)
+	assert.NoError(t, err)
+
+	// Test adding packages to root
+	testPackageNodeId := "N:Package:1"
+	testParams := []testPackageParams{
+		{Name: "package_7.txt", ParentId: folder2.Id, NodeId: testPackageNodeId},
+	}
+
+	insertParams := GenerateTestPackages(testParams, datasetId)
+	_, err = s.pg.AddPackages(context.Background(), insertParams)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	ancestors, err := s.pg.GetPackageAncestors(ctx, testPackageNodeId)
+	assert.NoError(t, err)
+	assert.Len(t, ancestors, 3)
+	assert.Equal(t, testPackageNodeId, ancestors[0].NodeId, "Expecting the first index of result to be the requested package")
+	assert.Equal(t, folderParams.NodeId, ancestors[1].NodeId, "Expecting 2nd index of result to be the nested folder")
+	assert.Equal(t, false, ancestors[2].ParentId.Valid, "Expecting 3rd index of result to be the root folder")
+
+}
+
+func testRecordPackages(t *testing.T, s *ModelServiceStore) {
+	ctx := context.Background()
+
+	orgId := 2
+	datasetId := 1
+
+	assert.NoError(t, s.WithOrg(orgId))
+	defer func() {
+		truncate(t, s.pgdb, orgId, "packages")
+	}()
+
+	packageNodeId := "N:Package:record-packages"
+	_, err := s.pg.AddPackages(ctx, GenerateTestPackages([]testPackageParams{
+		{Name: "sample.txt", ParentId: -1, NodeId: packageNodeId},
+	}, datasetId))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	model, err := s.CreateModelTx(ctx, 1, 1, "N:Dataset:123", "N:Org:123",
+		"Model_19", "Model_19", "This is a description", "N:User:1")
+	if !assert.NoError(t, err) {
+		return
+	}
+	t.Cleanup(func() {
+		err := s.DeleteModelTx(context.Background(), 1, 1, model.ID, true)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	})
+	_, err = s.UpdateModelPropertiesTx(ctx, 1, 1, model.ID, models.UpdateModelPropertiesRequestBody{
+		Properties: []models.ModelPropertyRequest{
+			{Name: "name", DataType: &models.DataType{Type: models.STRING}, IsModelTitle: true},
+		},
+	})
+	assert.NoError(t, err)
+	record, err := s.CreateRecordTx(ctx, 1, 1, "Model_19", map[string]interface{}{"name": "a"}, "N:User:1")
+	assert.NoError(t, err)
+
+	// A package node that is not in the dataset yet is reused instead of duplicated
+	pkg, err := s.pg.GetPackage(ctx, packageNodeId)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = s.neodb.Run(ctx, "CREATE (:Package{package_id: $packageId, package_node_id: $packageNodeId})",
+		map[string]any{"packageId": pkg.ID, "packageNodeId": packageNodeId})
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := s.neodb.Run(context.Background(), "MATCH (p:Package{package_id: $packageId}) DETACH DELETE p",
+			map[string]any{"packageId": pkg.ID})
+		if err != nil {
+			log.Fatalln(err)
+		}
+	})
+
+	linked, err := s.LinkRecordPackageTx(ctx, datasetId, 1, record.ID, packageNodeId, "N:User:1")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, record.ID, linked.RecordID)
+	assert.Equal(t, packageNodeId, linked.PackageNodeID)
+	assert.Equal(t, "N:User:1", linked.CreatedBy)
+
+	// Attaching the record again keeps the relationship
+	again, err := s.LinkRecordPackageTx(ctx, datasetId, 1, record.ID, packageNodeId, "N:User:2")
+	assert.NoError(t, err)
+	assert.Equal(t, linked.ID, again.ID)
+	assert.Equal(t, "N:User:2", again.UpdatedBy)
+
+	result, err := s.neodb.Run(ctx, "MATCH (p:Package{package_id: $packageId}) RETURN count(p) AS count",
+		map[string]any{"packageId": pkg.ID})
+	assert.NoError(t, err)
+	count, err := result.Single(ctx)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []any{int64(1)}, count.Values)
+	}
+
+	metadata, err := s.GetRecordsForPackage(ctx, datasetId, 1, packageNodeId, 1)
+	assert.NoError(t, err)
+	if assert.Len(t, metadata, 1) {
+		assert.Equal(t, record.ID, metadata[0].ID)
+	}
+
+	_, err = s.LinkRecordPackageTx(ctx, 2, 1, record.ID, packageNodeId, "N:User:1")
+	assert.IsType(t, &models.PackageNotInDatasetError{}, err)
+	_, err = s.LinkRecordPackageTx(ctx, datasetId, 1, record.ID, "N:Package:unknown", "N:User:1")
+	assert.IsType(t, &models.UnknownPackageError{}, err)
+	_, err = s.LinkRecordPackageTx(ctx, datasetId, 1, "unknown", packageNodeId, "N:User:1")
+	assert.IsType(t, &models.UnknownRecordError{}, err)
+
+	assert.NoError(t, s.UnlinkRecordPackageTx(ctx, datasetId, 1, record.ID, packageNodeId))
+	err = s.UnlinkRecordPackageTx(ctx, datasetId, 1, record.ID, packageNodeId)
+	assert.IsType(t, &models.UnknownRecordPackageError{}, err)
+}
+
+func testRecordPackagesAcrossOrgs(t *testing.T, s *ModelServiceStore) {
+	ctx := context.Background()
+
+	// Package ids are serial ids per organization, so packages in different organizations can have the same id.
+	var records []*models.Record
+	for org, name := range map[int]string{1: "Model_24", 2: "Model_25"} {
+		model, err := s.CreateModelTx(ctx, 1, org, fmt.Sprintf("N:Dataset:org-%d", org), fmt.Sprintf("N:Org:org-%d", org),
+			name, name, "This is a description", "N:User:1")
+		if !assert.NoError(t, err) {
+			return
+		}
+		t.Cleanup(func() {
+			err := s.DeleteModelTx(context.Background(), 1, org, model.ID, true)
+			if err != nil {
+				log.Fatalln(err)
+			}
+		})
+		_, err = s.UpdateModelPropertiesTx(ctx, 1, org, model.ID, models.UpdateModelPropertiesRequestBody{
+			Properties: []models.ModelPropertyRequest{
+				{Name: "name", DataType: &models.DataType{Type: models.STRING}, IsModelTitle: true},
+			},
+		})
+		assert.NoError(t, err)
+		record, err := s.CreateRecordTx(ctx, 1, org, name, map[string]interface{}{"name": "a"}, "N:User:1")
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		pkg := models.Package{ID: 424242, NodeID: fmt.Sprintf("N:Package:org-%d", org)}
+		linked, err := s.neo.LinkRecordPackage(ctx, 1, org, record.ID, pkg, "N:User:1")
+		if assert.NoError(t, err) {
+			assert.Equal(t, pkg.NodeID, linked.PackageNodeID)
+		}
+		records = append(records, record)
+	}
+	t.Cleanup(func() {
+		_, err := s.neodb.Run(context.Background(), "MATCH (p:Package{package_id: 424242}) DETACH DELETE p", nil)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	})
+	if !assert.Len(t, records, 2) {
+		return
+	}
+
+	result, err := s.neodb.Run(ctx, "MATCH (p:Package{package_id: 424242}) RETURN count(p) AS count", nil)
+	assert.NoError(t, err)
+	count, err := result.Single(ctx)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []any{int64(2)}, count.Values)
+	}
+
+	// Each organization only gets the records attached to its own package.
+	for org := 1; org <= 2; org++ {
+		metadata, err := s.neo.GetRecordsForPackage(ctx, 1, org, []int{424242}, 1)
+		assert.NoError(t, err)
+		if assert.Len(t, metadata, 1) {
+			assert.Equal(t, fmt.Sprintf("N:Package:org-%d", org), metadata[0].Origin.NodeId)
+		}
+	}
+}
+
+type testPackageParams struct {
+	Name     string
+	ParentId int64
+	NodeId   string
+}
+
+func truncate(t *testing.T, db *sql.DB, orgID int, table string) {
+
+	var query string
+
+	switch table {
+	case "organization_storage":
+		query = fmt.Sprintf("TRUNCATE TABLE pennsieve.%s CASCADE", table)
+	default:
+		query = fmt.Sprintf("TRUNCATE TABLE \"%d\".%s CASCADE", orgID, table)
+	}
+
+	_, err := db.Exec(query)
+	assert.NoError(t, err)
+}
+
+func GenerateTestPackages(params []testPackageParams, datasetId int) []pgdb2.PackageParams {
+
+	var result []pgdb2.PackageParams
+
+	attr := []packageInfo.PackageAttribute{
+		{
+			Key:      "subtype",
+			Fixed:    false,
+			Value:    "Image",
+			Hidden:   true,
+			Category: "Pennsieve",
+			DataType: "string",
+		}, {
+			Key:      "icon",
+			Fixed:    false,
+			Value:    "Microscope",
+			Hidden:   true,
+			Category: "Pennsieve",
+			DataType: "string",
+		},
+	}
+
+	for _, p := range params {
+		var uploadId string
+		var nodeId string
+		if p.NodeId == "" {
+			u, _ := uuid.NewUUID()
+			uploadId = u.String()
+			nodeId = fmt.Sprintf("N:Package:%s", u.String())
+		} else {
+			u, _ := uuid.NewUUID()
+			uploadId = u.String()
+			nodeId = p.NodeId
+		}
+
+		insertPackage := pgdb2.PackageParams{
+			Name:         p.Name,
+			PackageType:  packageType.Image,
+			PackageState: packageState.Unavailable,
+			NodeId:       nodeId,
+			ParentId:     p.ParentId,
+			DatasetId:    datasetId,
+			OwnerId:      1,
+			Size:         1000,
+			ImportId: sql.NullString{
+				String: uploadId,
+				Valid:  true,
+			},
+			Attributes: attr,
+		}
+
+		result = append(result, insertPackage)
 	}
 
 	return result
 }
+
+func testCompileFacet(t *testing.T, _ *ModelServiceStore) {
+	modelProps := map[string][]models.ModelProperty{
+		"samples": {
+			{Name: "tags", DataType: models.DataType{Type: models.STRING, IsArray: true}},
+			{Name: "weight", DataType: models.DataType{Type: models.DOUBLE}},
+		},
+		"visits": {{Name: "site", DataType: models.DataType{Type: models.STRING}}},
+	}
+	paths := []dbtype.Path{{
+		Nodes: []dbtype.Node{
+			{Props: map[string]any{"name": "samples", "id": "9609bfb8-c7a1-45d5-b683-de2e39788cc0"}},
+			{Props: map[string]any{"name": "visits", "id": "42eb7c3e-ac34-4ff1-ad20-672e5b7b97ee"}},
+		},
+		Relationships: []dbtype.Relationship{{Props: map[string]any{"type": "SAMPLE_BELONGS_TO_VISIT"}}},
+	}}
+	sourceModel := models.Model{ID: "9609bfb8-c7a1-45d5-b683-de2e39788cc0", Name: "samples"}
+	site := query.PropertyRef{Model: "visits", Property: "site"}
+
+	siteFilter := query.FilterGroup{Filters: query.Filters{Model: "visits", Property: "site", Operator: "=", Value: "A"}}
+	weightFilter := query.FilterGroup{Filters: query.Filters{Model: "samples", Property: "weight", Operator: ">", Value: 1}}
+
+	// Conditions that must all match are removed, alternatives are kept
+	assert.Nil(t, withoutPropertyFilters(&siteFilter, site))
+	assert.Equal(t, &weightFilter,
+		withoutPropertyFilters(&query.FilterGroup{And: []query.FilterGroup{siteFilter, weightFilter}}, site))
+	either := &query.FilterGroup{Or: []query.FilterGroup{siteFilter, weightFilter}}
+	assert.Equal(t, either, withoutPropertyFilters(either, site))
+	assert.Equal(t, &weightFilter, withoutPropertyFilters(&query.FilterGroup{And: []query.FilterGroup{
+		{And: []query.FilterGroup{siteFilter, siteFilter}}, weightFilter}}, site))
+
+	cql, params, err := generateQuery(sourceModel, paths, nil, &weightFilter, modelProps, nil,
+		query.FormatParams{ResultType: query.FACET, Facet: query.Facet{PropertyRef: site}}, 100, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "MATCH (`Msamples`:Model{id:$p0})<-[:`@INSTANCE_OF`]-(`samples`:Record)-[:`SAMPLE_BELONGS_TO_VISIT`]-"+
+		"(`visits`:Record)-[:`@INSTANCE_OF`]->(`Mvisits`:Model{id:$p1}) WHERE (`samples`.`weight` > $p2) "+
+		"WITH DISTINCT `samples`, `visits` WITH `samples`, `visits`.`site` AS `@value` WHERE `@value` IS NOT NULL "+
+		"RETURN `@value` AS value, count(DISTINCT `samples`) AS count ORDER BY count DESC, value LIMIT $p3", cql)
+	assert.Equal(t, query.DefaultFacetSize, params["p3"])
+
+	cql, params, err = generateQuery(sourceModel, nil, nil, nil, modelProps, nil,
+		query.FormatParams{ResultType: query.FACET, Facet: query.Facet{
+			PropertyRef: query.PropertyRef{Model: "samples", Property: "tags"}, Size: 1000}}, 100, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "MATCH (`Msamples`:Model{id:$p0})<-[:`@INSTANCE_OF`]-(`samples`:Record) "+
+		"WITH DISTINCT `samples` UNWIND `samples`.`tags` AS `@value` WITH `samples`, `@value` WHERE `@value` IS NOT NULL "+
+		"RETURN `@value` AS value, count(DISTINCT `samples`) AS count ORDER BY count DESC, value LIMIT $p1", cql)
+	assert.Equal(t, query.MaxFacetSize, params["p1"])
+
+	_, _, err = generateQuery(sourceModel, nil, nil, nil, modelProps, nil,
+		query.FormatParams{ResultType: query.FACET, Facet: query.Facet{
+			PropertyRef: query.PropertyRef{Model: "samples", Property: "color"}}}, 100, 0)
+	assert.IsType(t, &models.UnknownModelPropertyError{}, err)
+}
+
+func testCompileInclude(t *testing.T, _ *ModelServiceStore) {
+	sourceModel := models.Model{ID: "9609bfb8-c7a1-45d5-b683-de2e39788cc0", Name: "samples"}
+	include := []models.Model{
+		{ID: "42eb7c3e-ac34-4ff1-ad20-672e5b7b97ee", Name: "visits"},
+		{ID: "4f2c3e51-0a4c-4f5e-8a3f-6a1d4d0b2c11", Name: "patient"},
+	}
+
+	cql, params, err := generateQuery(sourceModel, nil, nil, nil, nil, nil,
+		query.FormatParams{ResultType: query.RESULTS, Include: include}, 20, 40)
+	assert.NoError(t, err)
+	assert.Equal(t, "MATCH (`Msamples`:Model{id:$p0})<-[:`@INSTANCE_OF`]-(`samples`:Record) "+
+		"WITH DISTINCT `samples` ORDER BY `samples`.`@sort_key` SKIP $p1 LIMIT $p2 "+
+		"OPTIONAL MATCH (`samples`)-[`@relationship`]-(`@linked`:Record)-[:`@INSTANCE_OF`]->(`@model`:Model) "+
+		"WHERE `@model`.id IN $p3 RETURN `samples` AS records, collect(DISTINCT {relationship: type(`@relationship`), "+
+		"model: `@model`.id, record: `@linked`})[..$p4] AS linked ORDER BY records.`@sort_key`", cql)
+	assert.Equal(t, []string{include[0].ID, include[1].ID}, params["p3"])
+	assert.Equal(t, query.MaxLinkedRecords+1, params["p4"])
+
+	visit := func(id string) dbtype.Node {
+		return dbtype.Node{Props: map[string]any{"@id": id, "@sort_key": int64(1), "site": "A"}}
+	}
+	linked, truncated := parseLinkedRecords([]interface{}{
+		map[string]interface{}{"relationship": "SAMPLE_BELONGS_TO_VISIT", "model": include[0].ID, "record": visit("v1")},
+		map[string]interface{}{"relationship": "SAMPLE_BELONGS_TO_VISIT", "model": include[0].ID, "record": visit("v2")},
+		map[string]interface{}{"relationship": "SAMPLE_FROM_PATIENT", "model": include[1].ID,
+			"record": dbtype.Node{Props: map[string]any{"@id": "p1", "name": "LIM031"}}},
+	}, include)
+	assert.Equal(t, map[string][]models.Record{
+		"SAMPLE_BELONGS_TO_VISIT": {
+			{ID: "v1", Model: "visits", Props: map[string]interface{}{"site": "A"}},
+			{ID: "v2", Model: "visits", Props: map[string]interface{}{"site": "A"}},
+		},
+		"SAMPLE_FROM_PATIENT": {{ID: "p1", Model: "patient", Props: map[string]interface{}{"name": "LIM031"}}},
+	}, linked)
+	assert.False(t, truncated)
+
+	// A record without linked records
+	linked, truncated = parseLinkedRecords([]interface{}{
+		map[string]interface{}{"relationship": nil, "model": nil, "record": nil},
+	}, include)
+	assert.Empty(t, linked)
+	assert.False(t, truncated)
+
+	// A record with more linked records than are returned
+	var values []interface{}
+	for i := 0; i <= query.MaxLinkedRecords; i++ {
+		values = append(values, map[string]interface{}{"relationship": "SAMPLE_BELONGS_TO_VISIT",
+			"model": include[0].ID, "record": visit(fmt.Sprintf("v%d", i))})
+	}
+	linked, truncated = parseLinkedRecords(values, include)
+	assert.Len(t, linked["SAMPLE_BELONGS_TO_VISIT"], query.MaxLinkedRecords)
+	assert.True(t, truncated)
+}
+
+func testCompileCursor(t *testing.T, _ *ModelServiceStore) {
+	sourceModel := models.Model{ID: "9609bfb8-c7a1-45d5-b683-de2e39788cc0", Name: "samples"}
+	modelProps := map[string][]models.ModelProperty{
+		"samples": {{Name: "weight", DataType: models.DataType{Type: models.DOUBLE}}},
+	}
+	where := &query.FilterGroup{Filters: query.Filters{Model: "samples", Property: "weight", Operator: ">", Value: 1}}
+	orderBy := query.OrderByList{{PropertyRef: query.PropertyRef{Model: "samples", Property: "weight"}}}
+	order := "samples.weight asc,samples.@sort_key asc"
+
+	after, err := decodeCursor(query.Cursor{Order: order, Keys: []interface{}{2, 41}}.Encode(), sourceModel, orderBy,
+		modelProps)
+	assert.NoError(t, err)
+	assert.Equal(t, &query.Cursor{Order: order, Keys: []interface{}{float64(2), int64(41)}}, after)
+
+	cql, params, err := generateQuery(sourceModel, nil, nil, where, modelProps, orderBy,
+		query.FormatParams{ResultType: query.RESULTS, After: after}, 20, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "MATCH (`Msamples`:Model{id:$p0})<-[:`@INSTANCE_OF`]-(`samples`:Record) "+
+		"WHERE (`samples`.`weight` > $p1) AND (((`samples`.`weight` > $p2 OR `samples`.`weight` IS NULL)) OR "+
+		"(`samples`.`weight` = $p2 AND (`samples`.`@sort_key` > $p3 OR `samples`.`@sort_key` IS NULL))) "+
+		"RETURN DISTINCT `samples` AS records ORDER BY `samples`.`weight`, `samples`.`@sort_key` SKIP $p4 LIMIT $p5", cql)
+	assert.Equal(t, float64(2), params["p2"])
+	assert.Equal(t, int64(41), params["p3"])
+
+	// Records without a value are ordered last
+	after, err = decodeCursor(query.Cursor{Order: order, Keys: []interface{}{nil, 41}}.Encode(), sourceModel, orderBy,
+		modelProps)
+	assert.NoError(t, err)
+	cql, _, err = generateQuery(sourceModel, nil, nil, nil, modelProps, orderBy,
+		query.FormatParams{ResultType: query.RESULTS, After: after}, 20, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "MATCH (`Msamples`:Model{id:$p0})<-[:`@INSTANCE_OF`]-(`samples`:Record) "+
+		"WHERE ((`samples`.`weight` IS NULL AND (`samples`.`@sort_key` > $p1 OR `samples`.`@sort_key` IS NULL))) "+
+		"RETURN DISTINCT `samples` AS records ORDER BY `samples`.`weight`, `samples`.`@sort_key` SKIP $p2 LIMIT $p3", cql)
+
+	// Cursors are only valid for the order of the query they were returned by
+	_, err = decodeCursor(query.Cursor{Order: "samples.@sort_key asc", Keys: []interface{}{41}}.Encode(), sourceModel,
+		orderBy, modelProps)
+	assert.IsType(t, &models.InvalidCursorError{}, err)
+	_, err = decodeCursor(query.Cursor{Order: order, Keys: []interface{}{"heavy", 41}}.Encode(), sourceModel, orderBy,
+		modelProps)
+	assert.IsType(t, &models.InvalidCursorError{}, err)
+}
+
+func testCompileOrder(t *testing.T, _ *ModelServiceStore) {
+	sourceModel := models.Model{ID: "9609bfb8-c7a1-45d5-b683-de2e39788cc0", Name: "samples"}
+	modelProps := map[string][]models.ModelProperty{
+		"samples": {{Name: "weight", DataType: models.DataType{Type: models.DOUBLE}}},
+		"visits":  {{Name: "date", DataType: models.DataType{Type: models.DATE}}},
+	}
+	paths := []dbtype.Path{{
+		Nodes: []dbtype.Node{
+			{Props: map[string]any{"name": "samples", "id": sourceModel.ID}},
+			{Props: map[string]any{"name": "visits", "id": "42eb7c3e-ac34-4ff1-ad20-672e5b7b97ee"}},
+		},
+		Relationships: []dbtype.Relationship{{Props: map[string]any{"type": "SAMPLE_BELONGS_TO_VISIT"}}},
+	}}
+	orderBy := query.OrderByList{
+		{PropertyRef: query.PropertyRef{Model: "visits", Property: "date"}, Direction: "DESC"},
+		{PropertyRef: query.PropertyRef{Property: "weight"}},
+	}.WithModel("samples")
+
+	// Records are ordered by the latest related visit, and records without visits are ordered last
+	cql, _, err := generateQuery(sourceModel, nil, paths, nil, modelProps, orderBy,
+		query.FormatParams{ResultType: query.RESULTS}, 20, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "MATCH (`Msamples`:Model{id:$p0})<-[:`@INSTANCE_OF`]-(`samples`:Record) "+
+		"OPTIONAL MATCH (`samples`)-[:`SAMPLE_BELONGS_TO_VISIT`]-(`visits`:Record)-[:`@INSTANCE_OF`]->"+
+		"(`Mvisits`:Model{id:$p1}) WITH `samples`, max(`visits`.`date`) AS `@o0` "+
+		"RETURN `samples` AS records, `@o0` ORDER BY `@o0` IS NULL, `@o0` DESC, `samples`.`weight`, "+
+		"`samples`.`@sort_key` SKIP $p2 LIMIT $p3", cql)
+
+	// Models in filters are joined like before, and order the records they match
+	visitFilter := &query.FilterGroup{Filters: query.Filters{Model: "visits", Property: "date", Operator: "IS NOT NULL"}}
+	cql, _, err = generateQuery(sourceModel, paths, nil, visitFilter, modelProps, orderBy,
+		query.FormatParams{ResultType: query.RESULTS}, 20, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "MATCH (`Msamples`:Model{id:$p0})<-[:`@INSTANCE_OF`]-(`samples`:Record)-[:`SAMPLE_BELONGS_TO_VISIT`]-"+
+		"(`visits`:Record)-[:`@INSTANCE_OF`]->(`Mvisits`:Model{id:$p1}) WHERE (`visits`.`date` IS NOT NULL) "+
+		"WITH `samples`, max(`visits`.`date`) AS `@o0` "+
+		"RETURN `samples` AS records, `@o0` ORDER BY `@o0` IS NULL, `@o0` DESC, `samples`.`weight`, "+
+		"`samples`.`@sort_key` SKIP $p2 LIMIT $p3", cql)
+
+	after := &query.Cursor{Keys: []interface{}{time.Date(2022, 1, 31, 0, 0, 0, 0, time.UTC), nil, int64(7)}}
+	cql, _, err = generateQuery(sourceModel, nil, paths, nil, modelProps, orderBy,
+		query.FormatParams{ResultType: query.RESULTS, After: after, Include: []models.Model{{ID: "42eb7c3e"}}}, 20, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "MATCH (`Msamples`:Model{id:$p0})<-[:`@INSTANCE_OF`]-(`samples`:Record) "+
+		"OPTIONAL MATCH (`samples`)-[:`SAMPLE_BELONGS_TO_VISIT`]-(`visits`:Record)-[:`@INSTANCE_OF`]->"+
+		"(`Mvisits`:Model{id:$p1}) WITH `samples`, max(`visits`.`date`) AS `@o0` "+
+		"WHERE (((`@o0` < $p2 OR `@o0` IS NULL)) OR (`@o0` = $p2 AND `samples`.`weight` IS NULL AND "+
+		"(`samples`.`@sort_key` > $p3 OR `samples`.`@sort_key` IS NULL))) WITH `samples`, `@o0` "+
+		"ORDER BY `@o0` IS NULL, `@o0` DESC, `samples`.`weight`, `samples`.`@sort_key` SKIP $p4 LIMIT $p5 "+
+		"OPTIONAL MATCH (`samples`)-[`@relationship`]-(`@linked`:Record)-[:`@INSTANCE_OF`]->(`@model`:Model) "+
+		"WHERE `@model`.id IN $p6 RETURN `samples` AS records, `@o0`, "+
+		"collect(DISTINCT {relationship: type(`@relationship`), model: `@model`.id, record: `@linked`})[..$p7] AS linked "+
+		"ORDER BY `@o0` IS NULL, `@o0` DESC, records.`weight`, records.`@sort_key`", cql)
+
+	// Records without a visit are only followed by records without a visit
+	after = &query.Cursor{Keys: []interface{}{nil, 2.5, int64(7)}}
+	cql, _, err = generateQuery(sourceModel, nil, paths, nil, modelProps, orderBy,
+		query.FormatParams{ResultType: query.RESULTS, After: after}, 20, 0)
+	assert.NoError(t, err)
+	assert.Contains(t, cql, "WHERE ((`@o0` IS NULL AND (`samples`.`weight` > $p2 OR `samples`.`weight` IS NULL)) OR "+
+		"(`@o0` IS NULL AND `samples`.`weight` = $p2 AND (`samples`.`@sort_key` > $p3 OR "+
+		"`samples`.`@sort_key` IS NULL))) ")
+
+	columns, err := orderColumns(sourceModel, orderBy, modelProps)
+	assert.NoError(t, err)
+	assert.Equal(t, "visits.date desc,samples.weight asc,samples.@sort_key asc", orderSignature(columns))
+
+	_, err = orderColumns(sourceModel, query.OrderByList{
+		{PropertyRef: query.PropertyRef{Model: "samples", Property: "weight"}, Direction: "up"}}, modelProps)
+	assert.EqualError(t, err, "Invalid order: unsupported direction: up")
+
+	_, err = orderColumns(sourceModel, query.OrderByList{
+		{PropertyRef: query.PropertyRef{Model: "visits", Property: "weight"}}}, modelProps)
+	assert.IsType(t, &models.UnknownModelPropertyError{}, err)
+}
+
+func testQueryGraphPages(t *testing.T, s *ModelServiceStore) {
+	ctx := context.Background()
+
+	model, err := s.CreateModelTx(ctx, 1, 1, "N:Dataset:123", "N:Org:123",
+		"Model_10", "Model 10", "This is a description", "N:User:1")
+	assert.NoError(t, err)
+
+	_, err = s.UpdateModelPropertiesTx(ctx, 1, 1, model.ID, models.UpdateModelPropertiesRequestBody{
+		Properties: []models.ModelPropertyRequest{
+			{Name: "name", DataType: &models.DataType{Type: models.STRING}, IsModelTitle: true},
+		},
+	})
+	assert.NoError(t, err)
+
+	var rows []models.RecordRequestBody
+	for i := 0; i < 5; i++ {
+		rows = append(rows, models.RecordRequestBody{Props: map[string]interface{}{"name": fmt.Sprintf("r%d", i)}})
+	}
+	_, err = s.CreateRecordsBatchTx(ctx, 1, 1, "Model_10", rows, false, "N:User:1")
+	assert.NoError(t, err)
+
+	res, err := s.QueryGraph(ctx, query.QueryRequestBody{Model: "Model_10", Limit: 2}, 1, 1)
+	assert.NoError(t, err)
+	assert.Len(t, res.Records, 2)
+	if assert.NotNil(t, res.Total) {
+		assert.Equal(t, 5, *res.Total)
+	}
+
+	// Follow the cursors to the last page
+	var names []interface{}
+	req := query.QueryRequestBody{Model: "Model_10", Limit: 2, SkipTotal: true}
+	for i := 0; i < 5; i++ {
+		res, err = s.QueryGraph(ctx, req, 1, 1)
+		assert.NoError(t, err)
+		assert.Nil(t, res.Total)
+		for _, r := range res.Records {
+			names = append(names, r.Props["name"])
+		}
+		if res.NextCursor == "" {
+			break
+		}
+		req.Cursor = res.NextCursor
+	}
+	assert.Equal(t, []interface{}{"r0", "r1", "r2", "r3", "r4"}, names)
+}
+
+// createSubjectsAndSamples creates a subjects model with a record per name, and a samples model with a sample of the
+// type for each subject that has a type. Samples are related to their subject by FROM_SUBJECT. The models are
+// deleted when the test ends.
+func createSubjectsAndSamples(t *testing.T, s *ModelServiceStore, subjects string, samples string,
+	names []string, types []string) {
+
+	ctx := context.Background()
+	for _, m := range []struct {
+		name string
+		prop string
+	}{{subjects, "name"}, {samples, "type"}} {
+		model, err := s.CreateModelTx(ctx, 1, 1, "N:Dataset:123", "N:Org:123",
+			m.name, m.name, "This is a description", "N:User:1")
+		if !assert.NoError(t, err) {
+			return
+		}
+		t.Cleanup(func() {
+			err := s.DeleteModelTx(context.Background(), 1, 1, model.ID, true)
+			if err != nil {
+				log.Fatalln(err)
+			}
+		})
+
+		_, err = s.UpdateModelPropertiesTx(ctx, 1, 1, model.ID, models.UpdateModelPropertiesRequestBody{
+			Properties: []models.ModelPropertyRequest{
+				{Name: m.prop, DataType: &models.DataType{Type: models.STRING}, IsModelTitle: true},
+			},
+		})
+		assert.NoError(t, err)
+	}
+
+	_, err := s.CreateModelRelationshipTx(ctx, 1, 1, models.CreateModelRelationshipRequestBody{
+		Type: "FROM_SUBJECT", From: samples, To: subjects}, "N:User:1")
+	assert.NoError(t, err)
+
+	for i, name := range names {
+		subject, err := s.CreateRecordTx(ctx, 1, 1, subjects, map[string]interface{}{"name": name}, "N:User:1")
+		assert.NoError(t, err)
+		if types[i] == "" {
+			continue
+		}
+		sample, err := s.CreateRecordTx(ctx, 1, 1, samples, map[string]interface{}{"type": types[i]}, "N:User:1")
+		assert.NoError(t, err)
+		_, err = s.CreateRelationships(ctx, models.PostRecordRelationshipRequestBody{
+			Relationship: models.ModelRelationShip{FromModel: samples, RelName: "FROM_SUBJECT", ToModel: subjects},
+			Records:      models.ToFromList{From: []string{sample.ID}, To: []string{subject.ID}},
+		}, 1, 1, "N:User:1")
+		assert.NoError(t, err)
+	}
+}
+
+func testQueryOrderOptional(t *testing.T, s *ModelServiceStore) {
+	ctx := context.Background()
+	createSubjectsAndSamples(t, s, "Model_20", "Model_21", []string{"a", "b", "c", "d"}, []string{"blood", "", "tissue", ""})
+
+	// Subjects without samples are ordered last in both directions, and are counted
+	for direction, expected := range map[string][]interface{}{
+		query.ASCENDING:  {"a", "c", "b", "d"},
+		query.DESCENDING: {"c", "a", "b", "d"},
+	} {
+		req := query.QueryRequestBody{Model: "Model_20", Limit: 10, OrderBy: query.OrderByList{
+			{PropertyRef: query.PropertyRef{Model: "Model_21", Property: "type"}, Direction: direction},
+			{PropertyRef: query.PropertyRef{Property: "name"}},
+		}}
+		res, err := s.QueryGraph(ctx, req, 1, 1)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		var names []interface{}
+		for _, r := range res.Records {
+			names = append(names, r.Props["name"])
+		}
+		assert.Equal(t, expected, names, direction)
+		if assert.NotNil(t, res.Total) {
+			assert.Equal(t, 4, *res.Total)
+		}
+
+		// Pages that follow the cursor continue after the subjects with samples
+		req.Limit = 3
+		res, err = s.QueryGraph(ctx, req, 1, 1)
+		assert.NoError(t, err)
+		req.Cursor = res.NextCursor
+		res, err = s.QueryGraph(ctx, req, 1, 1)
+		assert.NoError(t, err)
+		if assert.Len(t, res.Records, 1) {
+			assert.Equal(t, "d", res.Records[0].Props["name"])
+		}
+	}
+}
+
+func testAggregateOptional(t *testing.T, s *ModelServiceStore) {
+	ctx := context.Background()
+	createSubjectsAndSamples(t, s, "Model_22", "Model_23", []string{"a", "b", "c", "d"}, []string{"blood", "", "blood", ""})
+
+	// Subjects without samples are grouped by null, and have no samples to count
+	res, err := s.AggregateQueryGraph(ctx, query.QueryRequestBody{
+		Model: "Model_22",
+		Aggregate: &query.Aggregate{
+			Aggregations: []query.Aggregation{
+				{Function: "count"},
+				{PropertyRef: query.PropertyRef{Model: "Model_23"}, Function: "count"},
+			},
+			GroupBy: []query.PropertyRef{{Model: "Model_23", Property: "type"}},
+		},
+	}, 1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []query.AggregateGroup{
+		{Keys: []interface{}{"blood"}, Values: []interface{}{int64(2), int64(2)}},
+		{Keys: []interface{}{nil}, Values: []interface{}{int64(2), int64(0)}},
+	}, res.Groups)
+}
+
+func testModelPaths(t *testing.T, _ *ModelServiceStore) {
+	paths := []dbtype.Path{{
+		Nodes: []dbtype.Node{
+			{Props: map[string]any{"name": "samples"}},
+			{Props: map[string]any{"name": "visits"}},
+			{Props: map[string]any{"name": "patients"}},
+		},
+		Relationships: []dbtype.Relationship{
+			{Props: map[string]any{"type": "SAMPLE_BELONGS_TO_VISIT"}},
+			{Props: map[string]any{"type": "VISIT_OF_PATIENT"}},
+		},
+	}}
+
+	assert.Equal(t, []query.ModelPath{{
+		Models:        []string{"samples", "visits", "patients"},
+		Relationships: []string{"SAMPLE_BELONGS_TO_VISIT", "VISIT_OF_PATIENT"},
+	}}, modelPaths(paths))
+	assert.Equal(t, []query.ModelPath{}, modelPaths(nil))
+}
+
+func testExplainQueryGraph(t *testing.T, s *ModelServiceStore) {
+	ctx := context.Background()
+
+	model, err := s.CreateModelTx(ctx, 1, 1, "N:Dataset:123", "N:Org:123",
+		"Model_11", "Model 11", "This is a description", "N:User:1")
+	assert.NoError(t, err)
+
+	_, err = s.UpdateModelPropertiesTx(ctx, 1, 1, model.ID, models.UpdateModelPropertiesRequestBody{
+		Properties: []models.ModelPropertyRequest{
+			{Name: "name", DataType: &models.DataType{Type: models.STRING}, IsModelTitle: true},
+		},
+	})
+	assert.NoError(t, err)
+
+	req := query.ExplainRequestBody{QueryRequestBody: query.QueryRequestBody{
+		Model:   "Model_11",
+		Filters: []query.Filters{{Property: "name", Operator: "STARTS_WITH", Value: "r"}},
+	}}
+	res, err := s.ExplainQueryGraph(ctx, req, 1, 1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, model.ID, res.Model.ID)
+		assert.Empty(t, res.Paths)
+		assert.Contains(t, res.Cypher, "STARTS WITH")
+		assert.Contains(t, res.Params, "p0")
+		assert.Nil(t, res.Plan)
+	}
+
+	req.Plan = true
+	res, err = s.ExplainQueryGraph(ctx, req, 1, 1)
+	if assert.NoError(t, err) && assert.NotNil(t, res.Plan) {
+		assert.NotEmpty(t, res.Plan.Operator)
+	}
+
+	req.Model = "Unknown"
+	_, err = s.ExplainQueryGraph(ctx, req, 1, 1)
+	assert.IsType(t, &models.UnknownModelError{}, err)
+}
+
+func testSavedQueries(t *testing.T, s *ModelServiceStore) {
+	ctx := context.Background()
+
+	model, err := s.CreateModelTx(ctx, 1, 1, "N:Dataset:123", "N:Org:123",
+		"Model_12", "Model 12", "This is a description", "N:User:1")
+	assert.NoError(t, err)
+
+	_, err = s.UpdateModelPropertiesTx(ctx, 1, 1, model.ID, models.UpdateModelPropertiesRequestBody{
+		Properties: []models.ModelPropertyRequest{
+			{Name: "name", DataType: &models.DataType{Type: models.STRING}, IsModelTitle: true},
+		},
+	})
+	assert.NoError(t, err)
+
+	req := query.CreateSavedQueryRequestBody{
+		Name: " Names starting with r ",
+		Query: query.QueryRequestBody{
+			Model:   "Model_12",
+			Filters: []query.Filters{{Property: "name", Operator: "STARTS_WITH", Value: "r"}},
+			Cursor:  "abc",
+		},
+	}
+	saved, err := s.CreateSavedQueryTx(ctx, 1, 1, req, "N:User:1")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "Names starting with r", saved.Name)
+	assert.Equal(t, "N:User:1", saved.CreatedBy)
+	assert.Equal(t, "", saved.Query.Cursor)
+	assert.Equal(t, "r", saved.Query.Filters[0].Value)
+
+	_, err = s.CreateSavedQueryTx(ctx, 1, 1, req, "N:User:1")
+	assert.IsType(t, &models.SavedQueryNameCountError{}, err)
+
+	// Queries are validated against the models of the dataset
+	invalid := req
+	invalid.Name = "Invalid"
+	invalid.Query.Filters = []query.Filters{{Property: "unknown", Operator: "=", Value: "r"}}
+	_, err = s.CreateSavedQueryTx(ctx, 1, 1, invalid, "N:User:1")
+	assert.IsType(t, &models.UnknownModelPropertyError{}, err)
+
+	// Other users than the creator can only update the saved query when they manage the dataset
+	description := "Updated"
+	_, err = s.UpdateSavedQueryTx(ctx, 1, 1, saved.ID,
+		query.UpdateSavedQueryRequestBody{Description: &description}, "N:User:2", false)
+	assert.Equal(t, &models.SavedQueryCreatorError{ID: saved.ID}, err)
+
+	updated, err := s.UpdateSavedQueryTx(ctx, 1, 1, saved.ID,
+		query.UpdateSavedQueryRequestBody{Description: &description}, "N:User:2", true)
+	assert.NoError(t, err)
+	assert.Equal(t, "Names starting with r", updated.Name)
+	assert.Equal(t, "Updated", updated.Description)
+	assert.Equal(t, "N:User:1", updated.CreatedBy)
+	assert.Equal(t, "N:User:2", updated.UpdatedBy)
+
+	savedQueries, err := s.GetSavedQueries(ctx, 1, 1)
+	assert.NoError(t, err)
+	assert.Contains(t, savedQueries, *updated)
+
+	limit := 5
+	run, err := s.GetSavedQueryRequest(ctx, 1, 1, saved.ID, query.RunSavedQueryRequestBody{
+		Limit:  &limit,
+		Values: []query.Filters{{Property: "name", Value: "s"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 5, run.Limit)
+	assert.Equal(t, "s", run.Filters[0].Value)
+	_, err = s.QueryGraph(ctx, run, 1, 1)
+	assert.NoError(t, err)
+
+	// The last updater did not create the saved query
+	err = s.DeleteSavedQueryTx(ctx, 1, 1, saved.ID, "N:User:2", false)
+	assert.Equal(t, &models.SavedQueryCreatorError{ID: saved.ID}, err)
+
+	assert.NoError(t, s.DeleteSavedQueryTx(ctx, 1, 1, saved.ID, "N:User:1", false))
+	_, err = s.GetSavedQuery(ctx, 1, 1, saved.ID)
+	assert.IsType(t, &models.UnknownSavedQueryError{}, err)
+	assert.IsType(t, &models.UnknownSavedQueryError{}, s.DeleteSavedQueryTx(ctx, 1, 1, saved.ID, "N:User:1", false))
+}
+
+func testValidateRelationshipType(t *testing.T, _ *ModelServiceStore) {
+	relType, err := validateRelationshipType(" SAMPLE_OF ")
+	assert.NoError(t, err)
+	assert.Equal(t, "SAMPLE_OF", relType)
+
+	for _, reserved := range []string{"@INSTANCE_OF", "@related_to", "IN_DATASET"} {
+		_, err = validateRelationshipType(reserved)
+		assert.IsType(t, &models.ReservedNameError{}, err, reserved)
+	}
+
+	_, err = validateRelationshipType("")
+	assert.IsType(t, &models.EmptyError{}, err)
+	_, err = validateRelationshipType("belongs to")
+	assert.IsType(t, &models.ValidationError{}, err)
+}
+
+func testModelRelationships(t *testing.T, s *ModelServiceStore) {
+	ctx := context.Background()
+
+	var modelIds []string
+	for _, name := range []string{"Model_13", "Model_14"} {
+		model, err := s.CreateModelTx(ctx, 1, 1, "N:Dataset:123", "N:Org:123",
+			name, name, "This is a description", "N:User:1")
+		assert.NoError(t, err)
+		_, err = s.UpdateModelPropertiesTx(ctx, 1, 1, model.ID, models.UpdateModelPropertiesRequestBody{
+			Properties: []models.ModelPropertyRequest{
+				{Name: "name", DataType: &models.DataType{Type: models.STRING}, IsModelTitle: true},
+			},
+		})
+		assert.NoError(t, err)
+		modelIds = append(modelIds, model.ID)
+	}
+
+	req := models.CreateModelRelationshipRequestBody{Type: "DERIVED_FROM", From: "Model_13", To: modelIds[1],
+		Cardinality: "n:m:k"}
+	_, err := s.CreateModelRelationshipTx(ctx, 1, 1, req, "N:User:1")
+	assert.IsType(t, &models.InvalidCardinalityError{}, err)
+
+	req.Cardinality = models.OneToOne
+	relationship, err := s.CreateModelRelationshipTx(ctx, 1, 1, req, "N:User:1")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "DERIVED_FROM", relationship.Type)
+	assert.Equal(t, "DERIVED_FROM", relationship.DisplayName)
+	assert.Equal(t, modelIds[0], relationship.From)
+	assert.Equal(t, modelIds[1], relationship.To)
+	assert.Equal(t, models.OneToOne, relationship.Cardinality)
+
+	_, err = s.CreateModelRelationshipTx(ctx, 1, 1, req, "N:User:1")
+	assert.IsType(t, &models.ModelRelationshipExistsError{}, err)
+
+	req.Type = "@INSTANCE_OF"
+	_, err = s.CreateModelRelationshipTx(ctx, 1, 1, req, "N:User:1")
+	assert.IsType(t, &models.ReservedNameError{}, err)
+
+	// Relationships that store a one_to_many flag instead of a cardinality are read as the cardinality of the flag,
+	// and renaming them stores the cardinality
+	_, err = s.neodb.Run(ctx, "MATCH (:Model)-[r:`@RELATED_TO`{id: $id}]->(:Model) "+
+		"SET r.one_to_many = false REMOVE r.cardinality", map[string]any{"id": relationship.ID})
+	assert.NoError(t, err)
+	relationships, err := s.GetModelRelationships(ctx, 1, 1)
+	assert.NoError(t, err)
+	assert.Contains(t, relationships, *relationship)
+
+	renamed, err := s.UpdateModelRelationshipTx(ctx, 1, 1, relationship.ID,
+		models.UpdateModelRelationshipRequestBody{DisplayName: "derived from"}, "N:User:2")
+	assert.NoError(t, err)
+	assert.Equal(t, "derived from", renamed.DisplayName)
+	assert.Equal(t, "DERIVED_FROM", renamed.Type)
+	assert.Equal(t, models.OneToOne, renamed.Cardinality)
+	assert.Equal(t, "N:User:2", renamed.UpdatedBy)
+
+	result, err := s.neodb.Run(ctx, "MATCH (:Model)-[r:`@RELATED_TO`{id: $id}]->(:Model) "+
+		"RETURN r.cardinality AS cardinality, r.one_to_many AS oneToMany", map[string]any{"id": relationship.ID})
+	assert.NoError(t, err)
+	stored, err := result.Single(ctx)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []any{models.OneToOne, nil}, stored.Values)
+	}
+
+	relationships, err = s.GetModelRelationships(ctx, 1, 1)
+	assert.NoError(t, err)
+	assert.Contains(t, relationships, *renamed)
+
+	// Records are related by the relationship, which cannot be deleted while they are
+	from, err := s.CreateRecordTx(ctx, 1, 1, "Model_13", map[string]interface{}{"name": "a"}, "N:User:1")
+	assert.NoError(t, err)
+	to, err := s.CreateRecordTx(ctx, 1, 1, "Model_14", map[string]interface{}{"name": "b"}, "N:User:1")
+	assert.NoError(t, err)
+	_, err = s.CreateRelationships(ctx, models.PostRecordRelationshipRequestBody{
+		Relationship: models.ModelRelationShip{FromModel: "Model_13", RelName: "derived from", ToModel: "Model_14"},
+		Records:      models.ToFromList{From: []string{from.ID}, To: []string{to.ID}},
+	}, 1, 1, "N:User:1")
+	assert.NoError(t, err)
+
+	err = s.DeleteModelRelationshipTx(ctx, 1, 1, relationship.ID)
+	assert.IsType(t, &models.ModelRelationshipInUseError{}, err)
+
+	assert.NoError(t, s.DeleteRecordTx(ctx, 1, 1, "Model_13", from.ID))
+	assert.NoError(t, s.DeleteModelRelationshipTx(ctx, 1, 1, relationship.ID))
+	err = s.DeleteModelRelationshipTx(ctx, 1, 1, relationship.ID)
+	assert.IsType(t, &models.UnknownModelRelationshipError{}, err)
+}
+
+func testParseRecordRelationship(t *testing.T, _ *ModelServiceStore) {
+	createdAt := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	rec := &neo4j.Record{
+		Keys: []string{"e", "from", "to", "name"},
+		Values: []any{
+			dbtype.Relationship{Type: "DERIVED_FROM", Props: map[string]any{
+				"id": "rel-1", "model_relationship_id": "model-rel-1", "created_by": "N:User:1",
+				"created_at": createdAt, "updated_by": "N:User:2", "updated_at": createdAt,
+			}},
+			"record-1", "record-2", "derived from",
+		},
+	}
+
+	assert.Equal(t, models.RecordRelationShip{
+		ID:         "rel-1",
+		From:       "record-1",
+		To:         "record-2",
+		RelType:    "DERIVED_FROM",
+		ModelRelID: "model-rel-1",
+		Name:       "derived from",
+		Direction:  models.RelationshipOutgoing,
+		CreatedAt:  createdAt,
+		CreatedBy:  "N:User:1",
+		UpdatedAt:  createdAt,
+		UpdatedBy:  "N:User:2",
+	}, parseRecordRelationship(rec, "record-1"))
+	assert.Equal(t, models.RelationshipIncoming, parseRecordRelationship(rec, "record-2").Direction)
+}
+
+func testRecordRelationships(t *testing.T, s *ModelServiceStore) {
+	ctx := context.Background()
+
+	for _, name := range []string{"Model_15", "Model_16"} {
+		model, err := s.CreateModelTx(ctx, 1, 1, "N:Dataset:123", "N:Org:123",
+			name, name, "This is a description", "N:User:1")
+		assert.NoError(t, err)
+		_, err = s.UpdateModelPropertiesTx(ctx, 1, 1, model.ID, models.UpdateModelPropertiesRequestBody{
+			Properties: []models.ModelPropertyRequest{
+				{Name: "name", DataType: &models.DataType{Type: models.STRING}, IsModelTitle: true},
+			},
+		})
+		assert.NoError(t, err)
+	}
+
+	var modelRelIds []string
+	for _, relType := range []string{"SOURCE_OF", "ANALYZED_BY"} {
+		rel, err := s.CreateModelRelationshipTx(ctx, 1, 1, models.CreateModelRelationshipRequestBody{
+			Type: relType, From: "Model_15", To: "Model_16"}, "N:User:1")
+		if !assert.NoError(t, err) {
+			return
+		}
+		modelRelIds = append(modelRelIds, rel.ID)
+	}
+
+	source, err := s.CreateRecordTx(ctx, 1, 1, "Model_15", map[string]interface{}{"name": "source"}, "N:User:1")
+	assert.NoError(t, err)
+	var targets []string
+	for i := 0; i < 3; i++ {
+		r, err := s.CreateRecordTx(ctx, 1, 1, "Model_16", map[string]interface{}{"name": fmt.Sprint(i)}, "N:User:1")
+		assert.NoError(t, err)
+		targets = append(targets, r.ID)
+	}
+
+	created, err := s.CreateRelationships(ctx, models.PostRecordRelationshipRequestBody{
+		Relationship: models.ModelRelationShip{FromModel: "Model_15", RelName: "SOURCE_OF", ToModel: "Model_16"},
+		Records:      models.ToFromList{From: []string{source.ID, source.ID, source.ID}, To: targets},
+	}, 1, 1, "N:User:1")
+	assert.NoError(t, err)
+	_, err = s.CreateRelationships(ctx, models.PostRecordRelationshipRequestBody{
+		Relationship: models.ModelRelationShip{FromModel: "Model_15", RelName: "ANALYZED_BY", ToModel: "Model_16"},
+		Records:      models.ToFromList{From: []string{source.ID}, To: []string{targets[0]}},
+	}, 1, 1, "N:User:1")
+	assert.NoError(t, err)
+
+	res, err := s.GetRecordRelationships(ctx, 1, 1, source.ID, "", 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, query.DefaultPageSize, res.Limit)
+	assert.Len(t, res.Relationships, 4)
+
+	res, err = s.GetRecordRelationships(ctx, 1, 1, source.ID, "SOURCE_OF", 2, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, res.Relationships, 2) {
+		r := res.Relationships[0]
+		assert.Equal(t, "SOURCE_OF", r.Name)
+		assert.Equal(t, modelRelIds[0], r.ModelRelID)
+		assert.Equal(t, models.RelationshipOutgoing, r.Direction)
+		assert.Equal(t, "N:User:1", r.CreatedBy)
+	}
+
+	res, err = s.GetRecordRelationships(ctx, 1, 1, targets[0], "", 10, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, res.Relationships, 2) {
+		assert.Equal(t, models.RelationshipIncoming, res.Relationships[0].Direction)
+	}
+
+	_, err = s.GetRecordRelationships(ctx, 1, 1, "unknown", "", 10, 0)
+	assert.IsType(t, &models.UnknownRecordError{}, err)
+
+	// Delete a relationship by id, and the SOURCE_OF relationship between a pair of records
+	var lastId string
+	for _, r := range created {
+		if r.To == targets[2] {
+			lastId = r.ID
+		}
+	}
+	deleted, err := s.DeleteRecordRelationshipsTx(ctx, 1, 1, models.DeleteRecordRelationshipsRequestBody{
+		IDs:     []string{lastId},
+		Records: models.ToFromList{From: []string{source.ID}, To: []string{targets[0]}},
+		RelName: "SOURCE_OF",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), deleted.Deleted)
+
+	res, err = s.GetRecordRelationships(ctx, 1, 1, source.ID, "", 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, res.Relationships, 2)
+
+	_, err = s.DeleteRecordRelationshipsTx(ctx, 1, 1, models.DeleteRecordRelationshipsRequestBody{
+		Records: models.ToFromList{From: []string{source.ID}}})
+	assert.IsType(t, &models.InvalidRecordRelationshipsError{}, err)
+}
+
+func testPropertyConversionExpression(t *testing.T, _ *ModelServiceStore) {
+	assert.Equal(t, "CASE WHEN (r.`age` >= '') IS NOT NULL OR (r.`age` >= 0) IS NOT NULL THEN toInteger(r.`age`) END",
+		propertyConversions[models.LONG].expression("r.`age`"))
+	assert.Equal(t, "CASE WHEN (r.`age` >= '') IS NOT NULL OR (r.`age` >= false) IS NOT NULL THEN toBoolean(r.`age`) END",
+		propertyConversions[models.BOOLEAN].expression("r.`age`"))
+}
+
+func testRelationshipCardinality(t *testing.T, _ *ModelServiceStore) {
+	assert.Equal(t, models.OneToOne, relationshipCardinality(models.OneToOne, nil))
+	assert.Equal(t, models.ManyToMany, relationshipCardinality(models.ManyToMany, false))
+	assert.Equal(t, models.OneToMany, relationshipCardinality(nil, true))
+	assert.Equal(t, models.OneToOne, relationshipCardinality(nil, false))
+	assert.Equal(t, models.ManyToMany, relationshipCardinality(nil, nil))
+}
+
+func testPropertyValueKey(t *testing.T, _ *ModelServiceStore) {
+	long := models.DataType{Type: models.LONG}
+	assert.Equal(t, propertyValueKey(long, int64(1)), propertyValueKey(long, 1.0))
+
+	double := models.DataType{Type: models.DOUBLE}
+	assert.Equal(t, propertyValueKey(double, 1.0), propertyValueKey(double, int64(1)))
+	assert.NotEqual(t, propertyValueKey(double, 1.0), propertyValueKey(double, 1.5))
+
+	date := models.DataType{Type: models.DATE}
+	utc := time.Date(2021, 3, 4, 10, 0, 0, 0, time.UTC)
+	assert.Equal(t, propertyValueKey(date, utc), propertyValueKey(date, utc.In(time.FixedZone("EST", -5*3600))))
+	assert.Equal(t, propertyValueKey(date, utc), propertyValueKey(date, "2021-03-04T05:00:00.000-05:00"))
+	assert.NotEqual(t, propertyValueKey(date, utc), propertyValueKey(date, utc.Add(time.Millisecond)))
+
+	str := models.DataType{Type: models.STRING}
+	assert.NotEqual(t, propertyValueKey(str, "1"), propertyValueKey(str, "1.0"))
+}
+
+func testCardinalityViolations(t *testing.T, _ *ModelServiceStore) {
+	origins := []string{"a", "a", "b", "c", "a"}
+	targets := []string{"x", "x", "x", "y", "z"}
+
+	violations := cardinalityViolations(models.OneToMany, origins, targets)
+	if assert.Len(t, violations, 1) {
+		assert.Equal(t, 2, violations[0].Index)
+		assert.Equal(t, "record x is related to record a earlier in the request", violations[0].Reason)
+	}
+
+	violations = cardinalityViolations(models.OneToOne, origins, targets)
+	if assert.Len(t, violations, 2) {
+		assert.Equal(t, 2, violations[0].Index)
+		assert.Equal(t, 4, violations[1].Index)
+		assert.Equal(t, "record a is related to record x earlier in the request", violations[1].Reason)
+	}
+}
+
+func testRecordRelationshipCardinality(t *testing.T, s *ModelServiceStore) {
+	ctx := context.Background()
+
+	for _, name := range []string{"Model_17", "Model_18"} {
+		model, err := s.CreateModelTx(ctx, 1, 1, "N:Dataset:123", "N:Org:123",
+			name, name, "This is a description", "N:User:1")
+		if !assert.NoError(t, err) {
+			return
+		}
+		t.Cleanup(func() {
+			err := s.DeleteModelTx(context.Background(), 1, 1, model.ID, true)
+			if err != nil {
+				log.Fatalln(err)
+			}
+		})
+
+		_, err = s.UpdateModelPropertiesTx(ctx, 1, 1, model.ID, models.UpdateModelPropertiesRequestBody{
+			Properties: []models.ModelPropertyRequest{
+				{Name: "name", DataType: &models.DataType{Type: models.STRING}, IsModelTitle: true},
+			},
+		})
+		assert.NoError(t, err)
+	}
+
+	_, err := s.CreateModelRelationshipTx(ctx, 1, 1, models.CreateModelRelationshipRequestBody{
+		Type: "PAIRED_WITH", From: "Model_17", To: "Model_18", Cardinality: models.OneToOne}, "N:User:1")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var from, to []string
+	for i := 0; i < 2; i++ {
+		r, err := s.CreateRecordTx(ctx, 1, 1, "Model_17", map[string]interface{}{"name": fmt.Sprint(i)}, "N:User:1")
+		assert.NoError(t, err)
+		from = append(from, r.ID)
+		r, err = s.CreateRecordTx(ctx, 1, 1, "Model_18", map[string]interface{}{"name": fmt.Sprint(i)}, "N:User:1")
+		assert.NoError(t, err)
+		to = append(to, r.ID)
+	}
+
+	link := func(from []string, to []string, replace bool) error {
+		_, err := s.CreateRelationships(ctx, models.PostRecordRelationshipRequestBody{
+			Relationship: models.ModelRelationShip{FromModel: "Model_17", RelName: "PAIRED_WITH", ToModel: "Model_18"},
+			Records:      models.ToFromList{From: from, To: to},
+			Replace:      replace,
+		}, 1, 1, "N:User:1")
+		return err
+	}
+
+	// Pairs in a request cannot relate a record to two records
+	err = link([]string{from[0], from[0]}, []string{to[0], to[1]}, false)
+	if assert.IsType(t, &models.CardinalityError{}, err) {
+		violations := err.(*models.CardinalityError).Violations
+		if assert.Len(t, violations, 1) {
+			assert.Equal(t, 1, violations[0].Index)
+			assert.Equal(t, to[1], violations[0].To)
+		}
+	}
+
+	// Relating a record again is allowed, relating it to another record is not
+	assert.NoError(t, link([]string{from[0]}, []string{to[0]}, false))
+	assert.NoError(t, link([]string{from[0]}, []string{to[0]}, false))
+	err = link([]string{from[1], from[0]}, []string{to[0], to[1]}, false)
+	if assert.IsType(t, &models.CardinalityError{}, err) {
+		violations := err.(*models.CardinalityError).Violations
+		if assert.Len(t, violations, 2) {
+			assert.Equal(t, 0, violations[0].Index)
+			assert.Equal(t, 1, violations[1].Index)
+		}
+	}
+
+	// Replacing removes the existing relationship of the record
+	assert.NoError(t, link([]string{from[1]}, []string{to[0]}, true))
+	res, err := s.GetRecordRelationships(ctx, 1, 1, to[0], "", 10, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, res.Relationships, 1) {
+		assert.Equal(t, from[1], res.Relationships[0].From)
+	}
+	res, err = s.GetRecordRelationships(ctx, 1, 1, from[0], "", 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, res.Relationships, 0)
+
+	// Concurrent requests that relate a record to two records wait for each other, so only one of them succeeds
+	var targets []string
+	for i := 2; i < 4; i++ {
+		r, err := s.CreateRecordTx(ctx, 1, 1, "Model_18", map[string]interface{}{"name": fmt.Sprint(i)}, "N:User:1")
+		assert.NoError(t, err)
+		targets = append(targets, r.ID)
+	}
+	errs := make(chan error, len(targets))
+	for _, target := range targets {
+		go func(target string) {
+			session := shared.NewNeo4jSession(neo4jDriver.NewSession(ctx, neo4j.SessionConfig{
+				AccessMode: neo4j.AccessModeWrite,
+			}))
+			defer session.Close(ctx)
+
+			_, err := NewModelServiceStore(s.pgdb, session).CreateRelationships(ctx,
+				models.PostRecordRelationshipRequestBody{
+					Relationship: models.ModelRelationShip{FromModel: "Model_17", RelName: "PAIRED_WITH",
+						ToModel: "Model_18"},
+					Records: models.ToFromList{From: []string{from[0]}, To: []string{target}},
+				}, 1, 1, "N:User:1")
+			errs <- err
+		}(target)
+	}
+	var failed int
+	for range targets {
+		if err := <-errs; err != nil {
+			assert.IsType(t, &models.CardinalityError{}, err)
+			failed++
+		}
+	}
+	assert.Equal(t, 1, failed)
+}
+
+func testReadConcurrently(t *testing.T, s *ModelServiceStore) {
+	failed := errors.New("query failed")
+
+	// The error of the failing query is returned, not the error of a query that sees the cancellation first
+	for i := 0; i < 50; i++ {
+		cancelled := make(chan error, 1)
+		err := s.readConcurrently(context.Background(),
+			func(ctx context.Context, q *NeoQueries) error {
+				return failed
+			},
+			func(ctx context.Context, q *NeoQueries) error {
+				<-ctx.Done()
+				cancelled <- ctx.Err()
+				return ctx.Err()
+			},
+		)
+		assert.Equal(t, failed, err)
+		assert.Equal(t, context.Canceled, <-cancelled)
+	}
+}
+
+// BenchmarkQueryGraph compares running the page and count queries of a query one after the other on the session of
+// the store with running them concurrently on separate sessions.
+func BenchmarkQueryGraph(b *testing.B) {
+	ctx := context.Background()
+
+	session := shared.NewNeo4jSession(neo4jDriver.NewSession(ctx, neo4j.SessionConfig{
+		AccessMode: neo4j.AccessModeWrite,
+	}))
+	b.Cleanup(func() { session.Close(ctx) })
+
+	pgdbClient, err := pgdb.ConnectENV()
+	if err != nil {
+		b.Fatal("cannot connect to db:", err)
+	}
+	b.Cleanup(func() { pgdbClient.Close() })
+
+	s := NewModelServiceStore(pgdbClient, session)
+	model, err := s.CreateModelTx(ctx, 2, 1, "N:Dataset:456", "N:Org:123",
+		"Benchmark", "Benchmark", "This is a description", "N:User:1")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	// Cleanups run in reverse order, so the model is deleted before the session is closed
+	b.Cleanup(func() {
+		err := s.DeleteModelTx(context.Background(), 2, 1, model.ID, true)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	})
+	_, err = s.UpdateModelPropertiesTx(ctx, 2, 1, model.ID, models.UpdateModelPropertiesRequestBody{
+		Properties: []models.ModelPropertyRequest{
+			{Name: "name", DataType: &models.DataType{Type: models.STRING}, IsModelTitle: true},
+			{Name: "age", DataType: &models.DataType{Type: models.LONG}},
+		},
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var rows []models.RecordRequestBody
+	for i := 0; i < 10000; i++ {
+		rows = append(rows, models.RecordRequestBody{
+			Props: map[string]interface{}{"name": fmt.Sprintf("r%d", i), "age": float64(i % 100)}})
+	}
+	if _, err = s.CreateRecordsBatchTx(ctx, 2, 1, "Benchmark", rows, false, "N:User:1"); err != nil {
+		b.Fatal(err)
+	}
+
+	req := query.QueryRequestBody{
+		Model: "Benchmark",
+		Where: &query.FilterGroup{Filters: query.Filters{
+			Model: "Benchmark", Property: "age", Operator: "GREATER_THAN", Value: 20}},
+		Limit: 100,
+	}
+	for _, bm := range []struct {
+		name  string
+		store *ModelServiceStore
+	}{
+		{"sequential", NewModelServiceStore(pgdbClient, session)},
+		{"concurrent", NewModelServiceStore(pgdbClient, session).WithDriver(neo4jDriver)},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := bm.store.QueryGraph(ctx, req, 2, 1); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
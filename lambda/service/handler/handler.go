@@ -3,21 +3,49 @@ package handler
 import (
 	"context"
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
 	"github.com/pennsieve/model-service-serverless/api/shared"
 	"github.com/pennsieve/model-service-serverless/api/store"
 	"github.com/pennsieve/pennsieve-go-core/pkg/authorizer"
 	"github.com/pennsieve/pennsieve-go-core/pkg/models/permissions"
+	"github.com/pennsieve/pennsieve-go-core/pkg/models/role"
 	pgQueries "github.com/pennsieve/pennsieve-go-core/pkg/queries/pgdb"
 	log "github.com/sirupsen/logrus"
 	"os"
 	"regexp"
+	"strconv"
 	"time"
 )
 
+// explainQueryRole is the lowest dataset role that can explain queries. The Cypher of a query exposes the internal
+// structure of the graph, so by default only dataset managers can explain queries. EXPLAIN_QUERY_ROLE sets another
+// role, independent of the permissions to manage the graph schema.
+var explainQueryRole = parseExplainQueryRole(os.Getenv("EXPLAIN_QUERY_ROLE"))
+
+// parseExplainQueryRole returns the role with the name, or the manager role when the name is not a role.
+func parseExplainQueryRole(name string) role.Role {
+	if r, ok := role.RoleFromString(name); ok {
+		return r
+	}
+	return role.Manager
+}
+
+// canExplainQuery returns whether the user of the claims can explain queries.
+func canExplainQuery(claims *authorizer.Claims) bool {
+	return claims.DatasetClaim.Role.Implies(explainQueryRole)
+}
+
+// maxRecordLinks is the maximum number of pairs of records that a request relates. The store uses its default when
+// MAX_RECORD_LINKS is not set.
+var maxRecordLinks, _ = strconv.Atoi(os.Getenv("MAX_RECORD_LINKS"))
+
 var neo4jDriver neo4j.DriverWithContext
+var s3Client *s3.Client
+var s3Presigner *s3.PresignClient
 
-// init runs on cold start of lambda and fetches variables and created neo4j driver.
+// init runs on cold start of lambda and fetches variables and creates the neo4j driver and S3 clients.
 func init() {
 
 	log.SetFormatter(&log.JSONFormatter{})
@@ -47,6 +75,13 @@ func init() {
 
 	// We are not closing the driver to allow the driver to be used across lambda calls while lambda is hot. We will
 	// need to depend on neo4j to close stale connections after a time-out.
+
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		log.Fatalln(err)
+	}
+	s3Client = s3.NewFromConfig(cfg)
+	s3Presigner = s3.NewPresignClient(s3Client)
 }
 
 func ModelServiceHandler(request events.APIGatewayV2HTTPRequest) (*events.APIGatewayV2HTTPResponse, error) {
@@ -60,9 +95,13 @@ func ModelServiceHandler(request events.APIGatewayV2HTTPRequest) (*events.APIGat
 	claims := authorizer.ParseClaims(request.RequestContext.Authorizer.Lambda)
 	authorized := false
 
-	// Initiate NEO4j session
+	// Initiate NEO4j session; only GET requests are guaranteed not to write to the graph.
+	accessMode := neo4j.AccessModeWrite
+	if request.RequestContext.HTTP.Method == "GET" {
+		accessMode = neo4j.AccessModeRead
+	}
 	neoDb := shared.NewNeo4jSession(neo4jDriver.NewSession(context.Background(), neo4j.SessionConfig{
-		AccessMode: neo4j.AccessModeRead,
+		AccessMode: accessMode,
 	}))
 	defer neoDb.Close(context.Background())
 
@@ -73,7 +112,7 @@ func ModelServiceHandler(request events.APIGatewayV2HTTPRequest) (*events.APIGat
 	}
 
 	// Create GraphStore object with initiated db.
-	graphStore := store.NewModelServiceStore(db, neoDb)
+	graphStore := store.NewModelServiceStore(db, neoDb).WithDriver(neo4jDriver).WithMaxRecordLinks(maxRecordLinks)
 
 	switch routeKey {
 	case "/metadata_legacy/models":
@@ -83,6 +122,86 @@ func ModelServiceHandler(request events.APIGatewayV2HTTPRequest) (*events.APIGat
 			if authorized = authorizer.HasRole(*claims, permissions.ViewGraphSchema); authorized {
 				apiResponse, err = getDatasetModelsRoute(graphStore, request, claims)
 			}
+		case "POST":
+			if authorized = authorizer.HasRole(*claims, permissions.ManageGraphSchema); authorized {
+				apiResponse, err = postModelRoute(graphStore, request, claims)
+			}
+		}
+	case "/metadata_legacy/models/{id}":
+		switch request.RequestContext.HTTP.Method {
+		case "PUT":
+			if authorized = authorizer.HasRole(*claims, permissions.ManageGraphSchema); authorized {
+				apiResponse, err = putModelRoute(graphStore, request, claims)
+			}
+		case "DELETE":
+			if authorized = authorizer.HasRole(*claims, permissions.ManageGraphSchema); authorized {
+				apiResponse, err = deleteModelRoute(graphStore, request, claims)
+			}
+		}
+	case "/metadata_legacy/models/{id}/properties":
+		switch request.RequestContext.HTTP.Method {
+		case "PUT":
+			if authorized = authorizer.HasRole(*claims, permissions.ManageGraphSchema); authorized {
+				apiResponse, err = putModelPropertiesRoute(graphStore, request, claims)
+			}
+		}
+	case "/metadata_legacy/relationships":
+		switch request.RequestContext.HTTP.Method {
+		case "GET":
+			if authorized = authorizer.HasRole(*claims, permissions.ViewGraphSchema); authorized {
+				apiResponse, err = getModelRelationshipsRoute(graphStore, request, claims)
+			}
+		case "POST":
+			if authorized = authorizer.HasRole(*claims, permissions.ManageGraphSchema); authorized {
+				apiResponse, err = postModelRelationshipRoute(graphStore, request, claims)
+			}
+		}
+	case "/metadata_legacy/relationships/{id}":
+		switch request.RequestContext.HTTP.Method {
+		case "PUT":
+			if authorized = authorizer.HasRole(*claims, permissions.ManageGraphSchema); authorized {
+				apiResponse, err = putModelRelationshipRoute(graphStore, request, claims)
+			}
+		case "DELETE":
+			if authorized = authorizer.HasRole(*claims, permissions.ManageGraphSchema); authorized {
+				apiResponse, err = deleteModelRelationshipRoute(graphStore, request, claims)
+			}
+		}
+	case "/metadata_legacy/models/{model}/records":
+		switch request.RequestContext.HTTP.Method {
+		case "POST":
+			if authorized = authorizer.HasRole(*claims, permissions.CreateDeleteRecord); authorized {
+				apiResponse, err = postRecordRoute(graphStore, request, claims)
+			}
+		}
+	case "/metadata_legacy/models/{model}/records/batch":
+		switch request.RequestContext.HTTP.Method {
+		case "POST":
+			if authorized = authorizer.HasRole(*claims, permissions.CreateDeleteRecord); authorized {
+				apiResponse, err = postRecordsBatchRoute(graphStore, request, claims)
+			}
+		}
+	case "/metadata_legacy/models/{model}/records/import":
+		switch request.RequestContext.HTTP.Method {
+		case "POST":
+			if authorized = authorizer.HasRole(*claims, permissions.CreateDeleteRecord); authorized {
+				apiResponse, err = postRecordsImportRoute(graphStore, request, claims)
+			}
+		}
+	case "/metadata_legacy/models/{model}/records/{id}":
+		switch request.RequestContext.HTTP.Method {
+		case "GET":
+			if authorized = authorizer.HasRole(*claims, permissions.ViewRecords); authorized {
+				apiResponse, err = getRecordRoute(graphStore, request, claims)
+			}
+		case "PUT":
+			if authorized = authorizer.HasRole(*claims, permissions.EditRecords); authorized {
+				apiResponse, err = putRecordRoute(graphStore, request, claims)
+			}
+		case "DELETE":
+			if authorized = authorizer.HasRole(*claims, permissions.CreateDeleteRecord); authorized {
+				apiResponse, err = deleteRecordRoute(graphStore, request, claims)
+			}
 		}
 	case "/metadata_legacy/query":
 		switch request.RequestContext.HTTP.Method {
@@ -91,6 +210,13 @@ func ModelServiceHandler(request events.APIGatewayV2HTTPRequest) (*events.APIGat
 				apiResponse, err = postGraphQueryRoute(graphStore, request, claims)
 			}
 		}
+	case "/metadata_legacy/query/explain":
+		switch request.RequestContext.HTTP.Method {
+		case "POST":
+			if authorized = canExplainQuery(claims); authorized {
+				apiResponse, err = postGraphQueryExplainRoute(graphStore, request, claims)
+			}
+		}
 	case "/metadata_legacy/query/autocomplete":
 		switch request.RequestContext.HTTP.Method {
 		case "POST":
@@ -98,6 +224,39 @@ func ModelServiceHandler(request events.APIGatewayV2HTTPRequest) (*events.APIGat
 				apiResponse, err = postAutocompleteRoute(graphStore, request, claims)
 			}
 		}
+	case "/metadata_legacy/queries":
+		switch request.RequestContext.HTTP.Method {
+		case "GET":
+			if authorized = authorizer.HasRole(*claims, permissions.ViewRecords); authorized {
+				apiResponse, err = getSavedQueriesRoute(graphStore, request, claims)
+			}
+		case "POST":
+			if authorized = authorizer.HasRole(*claims, permissions.EditRecords); authorized {
+				apiResponse, err = postSavedQueryRoute(graphStore, request, claims)
+			}
+		}
+	case "/metadata_legacy/queries/{id}":
+		switch request.RequestContext.HTTP.Method {
+		case "GET":
+			if authorized = authorizer.HasRole(*claims, permissions.ViewRecords); authorized {
+				apiResponse, err = getSavedQueryRoute(graphStore, request, claims)
+			}
+		case "PUT":
+			if authorized = authorizer.HasRole(*claims, permissions.EditRecords); authorized {
+				apiResponse, err = putSavedQueryRoute(graphStore, request, claims)
+			}
+		case "DELETE":
+			if authorized = authorizer.HasRole(*claims, permissions.EditRecords); authorized {
+				apiResponse, err = deleteSavedQueryRoute(graphStore, request, claims)
+			}
+		}
+	case "/metadata_legacy/queries/{id}/run":
+		switch request.RequestContext.HTTP.Method {
+		case "POST":
+			if authorized = authorizer.HasRole(*claims, permissions.ViewRecords); authorized {
+				apiResponse, err = postRunSavedQueryRoute(graphStore, request, claims)
+			}
+		}
 
 	case "/metadata_legacy/records/relationships":
 		switch request.RequestContext.HTTP.Method {
@@ -105,6 +264,28 @@ func ModelServiceHandler(request events.APIGatewayV2HTTPRequest) (*events.APIGat
 			if authorized = authorizer.HasRole(*claims, permissions.CreateDeleteRecord); authorized {
 				apiResponse, err = postGraphRecordRelationshipRoute(graphStore, request, claims)
 			}
+		case "DELETE":
+			if authorized = authorizer.HasRole(*claims, permissions.CreateDeleteRecord); authorized {
+				apiResponse, err = deleteGraphRecordRelationshipRoute(graphStore, request, claims)
+			}
+		}
+	case "/metadata_legacy/records/{id}/relationships":
+		switch request.RequestContext.HTTP.Method {
+		case "GET":
+			if authorized = authorizer.HasRole(*claims, permissions.ViewRecords); authorized {
+				apiResponse, err = getRecordRelationshipsRoute(graphStore, request, claims)
+			}
+		}
+	case "/metadata_legacy/records/{id}/packages/{packageId}":
+		switch request.RequestContext.HTTP.Method {
+		case "POST":
+			if authorized = authorizer.HasRole(*claims, permissions.CreateDeleteRecord); authorized {
+				apiResponse, err = postRecordPackageRoute(graphStore, request, claims)
+			}
+		case "DELETE":
+			if authorized = authorizer.HasRole(*claims, permissions.CreateDeleteRecord); authorized {
+				apiResponse, err = deleteRecordPackageRoute(graphStore, request, claims)
+			}
 		}
 
 	case "/metadata_legacy/package":
@@ -1,8 +1,25 @@
 package handler
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/pennsieve/model-service-serverless/api/models"
+	"github.com/pennsieve/model-service-serverless/api/models/query"
+	"github.com/pennsieve/pennsieve-go-core/pkg/authorizer"
+	"github.com/pennsieve/pennsieve-go-core/pkg/models/dataset"
+	"github.com/pennsieve/pennsieve-go-core/pkg/models/permissions"
+	"github.com/pennsieve/pennsieve-go-core/pkg/models/role"
+	"github.com/stretchr/testify/assert"
+	"io"
 	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -46,3 +63,181 @@ func TestMain(m *testing.M) {
 	// return
 	os.Exit(code)
 }
+
+// localS3 is a stand-in for S3 that serves objects from memory.
+type localS3 map[string]string
+
+func (l localS3) GetObject(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	content, found := l[*params.Bucket+"/"+*params.Key]
+	if !found {
+		return nil, errors.New("NoSuchKey")
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader([]byte(content)))}, nil
+}
+
+func (l localS3) CreateMultipartUpload(_ context.Context, params *s3.CreateMultipartUploadInput, _ ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	l[*params.Bucket+"/"+*params.Key] = ""
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String("upload")}, nil
+}
+
+func (l localS3) UploadPart(_ context.Context, params *s3.UploadPartInput, _ ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	content, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	l[*params.Bucket+"/"+*params.Key] += string(content)
+	return &s3.UploadPartOutput{ETag: aws.String(fmt.Sprint(params.PartNumber))}, nil
+}
+
+func (l localS3) CompleteMultipartUpload(_ context.Context, params *s3.CompleteMultipartUploadInput, _ ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (l localS3) AbortMultipartUpload(_ context.Context, params *s3.AbortMultipartUploadInput, _ ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	delete(l, *params.Bucket+"/"+*params.Key)
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func (l localS3) PresignGetObject(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error) {
+	return &v4.PresignedHTTPRequest{URL: "https://local/" + *params.Bucket + "/" + *params.Key}, nil
+}
+
+func TestParseImportRequest(t *testing.T) {
+	ctx := context.Background()
+	importBucket = "imports"
+	api := localS3{
+		"imports/1/2/subjects.tsv": "name\tage\nJoe\t42\n",
+		"imports/1/3/subjects.tsv": "name\tage\nJane\t7\n",
+	}
+	keyPrefix := importKeyPrefix(1, 2)
+
+	header, rows, opts, err := parseImportRequest(ctx, api, events.APIGatewayV2HTTPRequest{
+		Headers:               map[string]string{"Content-Type": "text/csv; charset=utf-8"},
+		QueryStringParameters: map[string]string{"dry_run": "true"},
+		Body:                  "\xef\xbb\xbfname,age\n\"Doe, Jane\",7\n",
+	}, keyPrefix)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"name", "age"}, header)
+	assert.Equal(t, [][]string{{"Doe, Jane", "7"}}, rows)
+	assert.True(t, opts.DryRun)
+
+	header, rows, opts, err = parseImportRequest(ctx, api, events.APIGatewayV2HTTPRequest{
+		Body: `{"source": {"bucket": "imports", "key": "1/2/subjects.tsv"}, "mapping": {"age": "years"}}`,
+	}, keyPrefix)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"name", "age"}, header)
+	assert.Equal(t, [][]string{{"Joe", "42"}}, rows)
+	assert.Equal(t, models.ImportOptions{Mapping: map[string]string{"age": "years"}}, opts)
+
+	_, _, _, err = parseImportRequest(ctx, api, events.APIGatewayV2HTTPRequest{
+		Body: `{"source": {"bucket": "imports", "key": "1/2/missing.csv"}}`,
+	}, keyPrefix)
+	assert.Error(t, err)
+
+	_, _, _, err = parseImportRequest(ctx, api, events.APIGatewayV2HTTPRequest{
+		Body: `{"source": {"bucket": "other", "key": "1/2/subjects.tsv"}}`,
+	}, keyPrefix)
+	assert.EqualError(t, err, "cannot import from bucket other")
+
+	// Files of other datasets cannot be imported
+	_, _, _, err = parseImportRequest(ctx, api, events.APIGatewayV2HTTPRequest{
+		Body: `{"source": {"bucket": "imports", "key": "1/3/subjects.tsv"}}`,
+	}, keyPrefix)
+	assert.EqualError(t, err, "cannot import from key 1/3/subjects.tsv")
+
+	_, _, _, err = parseImportRequest(ctx, api, events.APIGatewayV2HTTPRequest{
+		Body: `{"source": {"bucket": "imports", "key": "1/2/../3/subjects.tsv"}}`,
+	}, keyPrefix)
+	assert.EqualError(t, err, "cannot import from key 1/2/../3/subjects.tsv")
+
+	_, _, _, err = parseImportRequest(ctx, api, events.APIGatewayV2HTTPRequest{
+		Body: `{"content": "name\nJoe", "format": "xlsx"}`,
+	}, keyPrefix)
+	assert.EqualError(t, err, "unsupported format: xlsx")
+}
+
+func TestExportResponse(t *testing.T) {
+	ctx := context.Background()
+	exportBucket = "exports"
+	api := localS3{}
+
+	w := newExportWriter(ctx, api, 1, "patient.csv", "text/csv")
+	_, err := w.Write([]byte("@id\n1\n"))
+	assert.NoError(t, err)
+	response, err := exportResponse(ctx, api, w)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, "text/csv", response.Headers["Content-Type"])
+	assert.Equal(t, "@id\n1\n", response.Body)
+	assert.Empty(t, api)
+
+	// Large exports are uploaded in parts while they are written
+	w = newExportWriter(ctx, api, 1, "patient.csv", "text/csv")
+	chunk := bytes.Repeat([]byte("a"), 3<<20)
+	for i := 0; i < 4; i++ {
+		_, err = w.Write(chunk)
+		assert.NoError(t, err)
+		assert.Less(t, w.buf.Len(), exportPartSize)
+	}
+	assert.Len(t, w.parts, 2)
+
+	response, err = exportResponse(ctx, api, w)
+	assert.NoError(t, err)
+	assert.Equal(t, 303, response.StatusCode)
+	assert.Len(t, w.parts, 3)
+	assert.Len(t, api, 1)
+	for key, content := range api {
+		assert.Equal(t, "https://local/"+key, response.Headers["Location"])
+		assert.Equal(t, strings.Repeat("a", 4*(3<<20)), content)
+	}
+
+	// Failed exports are removed
+	assert.NoError(t, w.abort())
+	assert.Empty(t, api)
+}
+
+func TestExportFormat(t *testing.T) {
+	format, err := exportFormat(events.APIGatewayV2HTTPRequest{}, "TSV")
+	assert.NoError(t, err)
+	assert.Equal(t, query.TSV, format)
+
+	format, err = exportFormat(events.APIGatewayV2HTTPRequest{
+		Headers: map[string]string{"accept": "application/x-ndjson;q=0.9, */*"},
+	}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, query.NDJSON, format)
+
+	format, err = exportFormat(events.APIGatewayV2HTTPRequest{}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, query.JSON, format)
+
+	_, err = exportFormat(events.APIGatewayV2HTTPRequest{}, "xlsx")
+	assert.EqualError(t, err, "unsupported format: xlsx")
+}
+
+func TestSavedQueryCreator(t *testing.T) {
+	editor := &authorizer.Claims{DatasetClaim: &dataset.Claim{Role: role.Editor}}
+	manager := &authorizer.Claims{DatasetClaim: &dataset.Claim{Role: role.Manager}}
+	assert.False(t, managesSavedQueries(editor))
+	assert.True(t, managesSavedQueries(manager))
+
+	// Users that did not create a saved query are refused
+	response := savedQueryErrorResponse(&models.SavedQueryCreatorError{ID: "q1"})
+	assert.Equal(t, 403, response.StatusCode)
+}
+
+func TestExplainQueryRole(t *testing.T) {
+	editor := &authorizer.Claims{DatasetClaim: &dataset.Claim{Role: role.Editor}}
+	manager := &authorizer.Claims{DatasetClaim: &dataset.Claim{Role: role.Manager}}
+
+	explainQueryRole = parseExplainQueryRole("")
+	assert.False(t, canExplainQuery(editor))
+	assert.True(t, canExplainQuery(manager))
+
+	// Explaining queries can be granted without managing the graph schema
+	explainQueryRole = parseExplainQueryRole("Editor")
+	assert.True(t, canExplainQuery(editor))
+	assert.False(t, authorizer.HasRole(*editor, permissions.ManageGraphSchema))
+
+	explainQueryRole = role.Manager
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pennsieve/model-service-serverless/api/models"
+	"github.com/pennsieve/model-service-serverless/api/store"
+	"github.com/pennsieve/pennsieve-go-core/pkg/authorizer"
+	"github.com/pennsieve/pennsieve-go-core/pkg/models/gateway"
+	log "github.com/sirupsen/logrus"
+)
+
+// postRecordPackageRoute attaches a record to a package of the dataset
+func postRecordPackageRoute(s *store.ModelServiceStore, request events.APIGatewayV2HTTPRequest,
+	claims *authorizer.Claims) (*events.APIGatewayV2HTTPResponse, error) {
+
+	ctx := context.Background()
+
+	recordPackage, err := s.LinkRecordPackageTx(ctx, int(claims.DatasetClaim.IntId), int(claims.OrgClaim.IntId),
+		request.PathParameters["id"], request.PathParameters["packageId"], claims.UserClaim.NodeId)
+	if err != nil {
+		return recordPackageErrorResponse(err), nil
+	}
+
+	// CREATING API RESPONSE
+	jsonBody, _ := json.Marshal(recordPackage)
+	apiResponse := events.APIGatewayV2HTTPResponse{Body: string(jsonBody), StatusCode: 200}
+
+	return &apiResponse, nil
+}
+
+// deleteRecordPackageRoute removes the attachment of a record to a package of the dataset
+func deleteRecordPackageRoute(s *store.ModelServiceStore, request events.APIGatewayV2HTTPRequest,
+	claims *authorizer.Claims) (*events.APIGatewayV2HTTPResponse, error) {
+
+	ctx := context.Background()
+
+	err := s.UnlinkRecordPackageTx(ctx, int(claims.DatasetClaim.IntId), int(claims.OrgClaim.IntId),
+		request.PathParameters["id"], request.PathParameters["packageId"])
+	if err != nil {
+		return recordPackageErrorResponse(err), nil
+	}
+
+	apiResponse := events.APIGatewayV2HTTPResponse{StatusCode: 204}
+	return &apiResponse, nil
+}
+
+// recordPackageErrorResponse returns the API response for errors from attaching records to packages.
+func recordPackageErrorResponse(err error) *events.APIGatewayV2HTTPResponse {
+	var apiResponse events.APIGatewayV2HTTPResponse
+
+	switch err.(type) {
+	case *models.UnknownRecordError, *models.UnknownPackageError, *models.UnknownRecordPackageError:
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage(err.Error(), 404), StatusCode: 404}
+	case *models.PackageNotInDatasetError:
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage(err.Error(), 400), StatusCode: 400}
+	default:
+		log.Println(err)
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage("Internal Server Error", 500), StatusCode: 500}
+	}
+
+	return &apiResponse
+}
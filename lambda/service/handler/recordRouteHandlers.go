@@ -0,0 +1,367 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pennsieve/model-service-serverless/api/models"
+	"github.com/pennsieve/model-service-serverless/api/store"
+	"github.com/pennsieve/pennsieve-go-core/pkg/authorizer"
+	"github.com/pennsieve/pennsieve-go-core/pkg/models/gateway"
+	"github.com/pennsieve/pennsieve-go-core/pkg/models/permissions"
+	log "github.com/sirupsen/logrus"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// validationErrorMessage is an error response that includes the validation errors per property.
+type validationErrorMessage struct {
+	Code    int                            `json:"code"`
+	Message string                         `json:"message"`
+	Errors  []models.ValidationErrorDetail `json:"errors"`
+}
+
+// postRecordRoute creates a record for a model
+func postRecordRoute(s *store.ModelServiceStore, request events.APIGatewayV2HTTPRequest,
+	claims *authorizer.Claims) (*events.APIGatewayV2HTTPResponse, error) {
+	apiResponse := events.APIGatewayV2HTTPResponse{}
+
+	parsedRequestBody := models.RecordRequestBody{}
+	if err := json.Unmarshal([]byte(request.Body), &parsedRequestBody); err != nil {
+		message := "Error: Unable to parse body: " + fmt.Sprint(err)
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage(message, 400), StatusCode: 400}
+		return &apiResponse, nil
+	}
+
+	ctx := context.Background()
+
+	record, err := s.CreateRecordTx(ctx, int(claims.DatasetClaim.IntId), int(claims.OrgClaim.IntId),
+		request.PathParameters["model"], parsedRequestBody.Props, claims.UserClaim.NodeId)
+	if err != nil {
+		return recordErrorResponse(err), nil
+	}
+
+	// CREATING API RESPONSE
+	jsonBody, _ := json.Marshal(record)
+	apiResponse = events.APIGatewayV2HTTPResponse{Body: string(jsonBody), StatusCode: 201}
+
+	return &apiResponse, nil
+}
+
+// getRecordRoute returns a single record of a model
+func getRecordRoute(s *store.ModelServiceStore, request events.APIGatewayV2HTTPRequest,
+	claims *authorizer.Claims) (*events.APIGatewayV2HTTPResponse, error) {
+
+	ctx := context.Background()
+
+	record, err := s.GetRecord(ctx, int(claims.DatasetClaim.IntId), int(claims.OrgClaim.IntId),
+		request.PathParameters["model"], request.PathParameters["id"])
+	if err != nil {
+		return recordErrorResponse(err), nil
+	}
+
+	// CREATING API RESPONSE
+	jsonBody, _ := json.Marshal(record)
+	apiResponse := events.APIGatewayV2HTTPResponse{Body: string(jsonBody), StatusCode: 200}
+
+	return &apiResponse, nil
+}
+
+// putRecordRoute replaces the values of a record
+func putRecordRoute(s *store.ModelServiceStore, request events.APIGatewayV2HTTPRequest,
+	claims *authorizer.Claims) (*events.APIGatewayV2HTTPResponse, error) {
+	apiResponse := events.APIGatewayV2HTTPResponse{}
+
+	parsedRequestBody := models.RecordRequestBody{}
+	if err := json.Unmarshal([]byte(request.Body), &parsedRequestBody); err != nil {
+		message := "Error: Unable to parse body: " + fmt.Sprint(err)
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage(message, 400), StatusCode: 400}
+		return &apiResponse, nil
+	}
+
+	ctx := context.Background()
+
+	record, err := s.UpdateRecordTx(ctx, int(claims.DatasetClaim.IntId), int(claims.OrgClaim.IntId),
+		request.PathParameters["model"], request.PathParameters["id"], parsedRequestBody.Props, claims.UserClaim.NodeId)
+	if err != nil {
+		return recordErrorResponse(err), nil
+	}
+
+	// CREATING API RESPONSE
+	jsonBody, _ := json.Marshal(record)
+	apiResponse = events.APIGatewayV2HTTPResponse{Body: string(jsonBody), StatusCode: 200}
+
+	return &apiResponse, nil
+}
+
+// deleteRecordRoute deletes a record and its relationships
+func deleteRecordRoute(s *store.ModelServiceStore, request events.APIGatewayV2HTTPRequest,
+	claims *authorizer.Claims) (*events.APIGatewayV2HTTPResponse, error) {
+
+	ctx := context.Background()
+
+	err := s.DeleteRecordTx(ctx, int(claims.DatasetClaim.IntId), int(claims.OrgClaim.IntId),
+		request.PathParameters["model"], request.PathParameters["id"])
+	if err != nil {
+		return recordErrorResponse(err), nil
+	}
+
+	apiResponse := events.APIGatewayV2HTTPResponse{StatusCode: 204}
+	return &apiResponse, nil
+}
+
+// postRecordsBatchRoute creates or upserts a batch of records for a model.
+// The body is either a JSON array of records or, with an NDJSON content type, one record per line.
+func postRecordsBatchRoute(s *store.ModelServiceStore, request events.APIGatewayV2HTTPRequest,
+	claims *authorizer.Claims) (*events.APIGatewayV2HTTPResponse, error) {
+	apiResponse := events.APIGatewayV2HTTPResponse{}
+
+	upsert := false
+	if value, found := request.QueryStringParameters["upsert"]; found {
+		var err error
+		if upsert, err = strconv.ParseBool(value); err != nil {
+			message := "Error: Invalid value for upsert: " + value
+			apiResponse = events.APIGatewayV2HTTPResponse{
+				Body: gateway.CreateErrorMessage(message, 400), StatusCode: 400}
+			return &apiResponse, nil
+		}
+	}
+
+	body, err := requestBody(request)
+	if err != nil {
+		message := "Error: Unable to decode body: " + fmt.Sprint(err)
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage(message, 400), StatusCode: 400}
+		return &apiResponse, nil
+	}
+
+	var rows []models.RecordRequestBody
+	switch contentType(request) {
+	case "application/x-ndjson", "application/ndjson":
+		rows, err = parseNDJSONRecords(body)
+	default:
+		err = json.Unmarshal(body, &rows)
+	}
+	if err != nil {
+		message := "Error: Unable to parse body: " + fmt.Sprint(err)
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage(message, 400), StatusCode: 400}
+		return &apiResponse, nil
+	}
+
+	ctx := context.Background()
+
+	response, err := s.CreateRecordsBatchTx(ctx, int(claims.DatasetClaim.IntId), int(claims.OrgClaim.IntId),
+		request.PathParameters["model"], rows, upsert, claims.UserClaim.NodeId)
+	if err != nil {
+		return recordErrorResponse(err), nil
+	}
+
+	// CREATING API RESPONSE
+	jsonBody, _ := json.Marshal(response)
+	apiResponse = events.APIGatewayV2HTTPResponse{Body: string(jsonBody), StatusCode: 200}
+
+	return &apiResponse, nil
+}
+
+// parseNDJSONRecords parses a body with a JSON record on each line. Empty lines are ignored.
+func parseNDJSONRecords(body []byte) ([]models.RecordRequestBody, error) {
+	var rows []models.RecordRequestBody
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), len(body)+1)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var row models.RecordRequestBody
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, scanner.Err()
+}
+
+// postRecordsImportRoute imports the rows of a CSV or TSV file as records of a model.
+// The file is the body of the request, or is referenced in a JSON body that can also contain a column mapping.
+func postRecordsImportRoute(s *store.ModelServiceStore, request events.APIGatewayV2HTTPRequest,
+	claims *authorizer.Claims) (*events.APIGatewayV2HTTPResponse, error) {
+	apiResponse := events.APIGatewayV2HTTPResponse{}
+
+	ctx := context.Background()
+
+	header, rows, opts, err := parseImportRequest(ctx, s3Client, request,
+		importKeyPrefix(claims.OrgClaim.IntId, claims.DatasetClaim.IntId))
+	if err != nil {
+		message := "Error: Unable to parse import: " + fmt.Sprint(err)
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage(message, 400), StatusCode: 400}
+		return &apiResponse, nil
+	}
+
+	// Creating properties changes the schema of the model.
+	if opts.CreateProperties && !authorizer.HasRole(*claims, permissions.ManageGraphSchema) {
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			StatusCode: 403,
+			Body:       `{"message": "User is not authorized to perform this action on the dataset."}`,
+		}
+		return &apiResponse, nil
+	}
+
+	response, err := s.ImportRecordsTx(ctx, int(claims.DatasetClaim.IntId), int(claims.OrgClaim.IntId),
+		request.PathParameters["model"], header, rows, opts, claims.UserClaim.NodeId)
+	if err != nil {
+		return recordErrorResponse(err), nil
+	}
+
+	// CREATING API RESPONSE
+	jsonBody, _ := json.Marshal(response)
+	apiResponse = events.APIGatewayV2HTTPResponse{Body: string(jsonBody), StatusCode: 200}
+
+	return &apiResponse, nil
+}
+
+// parseImportRequest returns the header, rows and import options of an import request.
+// A CSV or TSV body takes its options from the query parameters. A JSON body contains the options and either the
+// file content or a reference to an S3 object that is fetched with the provided api. The key of the object must start
+// with the key prefix.
+func parseImportRequest(ctx context.Context, api S3GetObjectAPI, request events.APIGatewayV2HTTPRequest,
+	keyPrefix string) (
+	[]string, [][]string, models.ImportOptions, error) {
+
+	var opts models.ImportOptions
+
+	body, err := requestBody(request)
+	if err != nil {
+		return nil, nil, opts, err
+	}
+
+	var format string
+	switch contentType(request) {
+	case "text/csv":
+		format = "csv"
+	case "text/tab-separated-values", "text/tsv":
+		format = "tsv"
+	}
+
+	if format != "" {
+		for name, value := range map[string]*bool{
+			"dry_run":           &opts.DryRun,
+			"create_properties": &opts.CreateProperties,
+			"upsert":            &opts.Upsert,
+		} {
+			if v, found := request.QueryStringParameters[name]; found {
+				if *value, err = strconv.ParseBool(v); err != nil {
+					return nil, nil, opts, fmt.Errorf("invalid value for %s: %s", name, v)
+				}
+			}
+		}
+	} else {
+		var parsed models.ImportRecordsRequestBody
+		if err = json.Unmarshal(body, &parsed); err != nil {
+			return nil, nil, opts, err
+		}
+		opts = parsed.ImportOptions
+
+		switch {
+		case parsed.Source != nil && parsed.Content != "":
+			return nil, nil, opts, errors.New("provide either content or source, not both")
+		case parsed.Source != nil:
+			if body, err = getImportObject(ctx, api, *parsed.Source, keyPrefix); err != nil {
+				return nil, nil, opts, err
+			}
+		default:
+			body = []byte(parsed.Content)
+		}
+
+		format = strings.ToLower(parsed.Format)
+		if format == "" && parsed.Source != nil {
+			format = strings.TrimPrefix(strings.ToLower(path.Ext(parsed.Source.Key)), ".")
+		}
+		if format == "" {
+			format = "csv"
+		}
+	}
+
+	header, rows, err := parseDelimited(body, format)
+	return header, rows, opts, err
+}
+
+// parseDelimited parses a CSV or TSV file and returns the header and the rows of the file.
+func parseDelimited(body []byte, format string) ([]string, [][]string, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(body, []byte("\xef\xbb\xbf"))))
+	switch format {
+	case "csv":
+	case "tsv", "tab":
+		reader.Comma = '\t'
+		reader.LazyQuotes = true
+	default:
+		return nil, nil, fmt.Errorf("unsupported format: %s", format)
+	}
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil, errors.New("file has no header")
+	}
+
+	return records[0], records[1:], nil
+}
+
+// requestBody returns the body of the request, decoding it when API Gateway has base64 encoded the body.
+func requestBody(request events.APIGatewayV2HTTPRequest) ([]byte, error) {
+	if request.IsBase64Encoded {
+		return base64.StdEncoding.DecodeString(request.Body)
+	}
+	return []byte(request.Body), nil
+}
+
+// contentType returns the media type of the request body without parameters.
+func contentType(request events.APIGatewayV2HTTPRequest) string {
+	for k, v := range request.Headers {
+		if strings.EqualFold(k, "content-type") {
+			return strings.TrimSpace(strings.ToLower(strings.Split(v, ";")[0]))
+		}
+	}
+	return ""
+}
+
+// recordErrorResponse returns the API response for errors from creating, reading, updating or deleting records.
+func recordErrorResponse(err error) *events.APIGatewayV2HTTPResponse {
+	var apiResponse events.APIGatewayV2HTTPResponse
+
+	switch e := err.(type) {
+	case *models.UnknownModelError, *models.UnknownRecordError:
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage(err.Error(), 404), StatusCode: 404}
+	case *models.ImportError, *models.UnknownModelPropertyError, *models.InvalidPropertyError, *models.ReservedNameError,
+		*models.EmptyError, *models.NameTooLongError, *models.ValidationError, *models.ModelTitleError:
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage(err.Error(), 400), StatusCode: 400}
+	case *models.RecordValidationError:
+		jsonBody, _ := json.Marshal(validationErrorMessage{Code: 400, Message: e.Error(), Errors: e.Details})
+		apiResponse = events.APIGatewayV2HTTPResponse{Body: string(jsonBody), StatusCode: 400}
+	default:
+		log.Println(err)
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage("Internal Server Error", 500), StatusCode: 500}
+	}
+
+	return &apiResponse
+}
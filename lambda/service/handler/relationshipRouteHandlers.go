@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pennsieve/model-service-serverless/api/models"
+	"github.com/pennsieve/model-service-serverless/api/store"
+	"github.com/pennsieve/pennsieve-go-core/pkg/authorizer"
+	"github.com/pennsieve/pennsieve-go-core/pkg/models/gateway"
+	log "github.com/sirupsen/logrus"
+)
+
+// getModelRelationshipsRoute returns the relationships between the models of the dataset
+func getModelRelationshipsRoute(s *store.ModelServiceStore, request events.APIGatewayV2HTTPRequest,
+	claims *authorizer.Claims) (*events.APIGatewayV2HTTPResponse, error) {
+
+	ctx := context.Background()
+
+	relationships, err := s.GetModelRelationships(ctx, int(claims.DatasetClaim.IntId), int(claims.OrgClaim.IntId))
+	if err != nil {
+		return modelRelationshipErrorResponse(err), nil
+	}
+
+	// CREATING API RESPONSE
+	jsonBody, _ := json.Marshal(relationships)
+	apiResponse := events.APIGatewayV2HTTPResponse{Body: string(jsonBody), StatusCode: 200}
+
+	return &apiResponse, nil
+}
+
+// postModelRelationshipRoute creates a relationship between two models of the dataset
+func postModelRelationshipRoute(s *store.ModelServiceStore, request events.APIGatewayV2HTTPRequest,
+	claims *authorizer.Claims) (*events.APIGatewayV2HTTPResponse, error) {
+	apiResponse := events.APIGatewayV2HTTPResponse{}
+
+	parsedRequestBody := models.CreateModelRelationshipRequestBody{}
+	if err := json.Unmarshal([]byte(request.Body), &parsedRequestBody); err != nil {
+		message := "Error: Unable to parse body: " + fmt.Sprint(err)
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage(message, 400), StatusCode: 400}
+		return &apiResponse, nil
+	}
+
+	ctx := context.Background()
+
+	relationship, err := s.CreateModelRelationshipTx(ctx, int(claims.DatasetClaim.IntId), int(claims.OrgClaim.IntId),
+		parsedRequestBody, claims.UserClaim.NodeId)
+	if err != nil {
+		return modelRelationshipErrorResponse(err), nil
+	}
+
+	// CREATING API RESPONSE
+	jsonBody, _ := json.Marshal(relationship)
+	apiResponse = events.APIGatewayV2HTTPResponse{Body: string(jsonBody), StatusCode: 201}
+
+	return &apiResponse, nil
+}
+
+// putModelRelationshipRoute renames a relationship between models
+func putModelRelationshipRoute(s *store.ModelServiceStore, request events.APIGatewayV2HTTPRequest,
+	claims *authorizer.Claims) (*events.APIGatewayV2HTTPResponse, error) {
+	apiResponse := events.APIGatewayV2HTTPResponse{}
+
+	parsedRequestBody := models.UpdateModelRelationshipRequestBody{}
+	if err := json.Unmarshal([]byte(request.Body), &parsedRequestBody); err != nil {
+		message := "Error: Unable to parse body: " + fmt.Sprint(err)
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage(message, 400), StatusCode: 400}
+		return &apiResponse, nil
+	}
+
+	ctx := context.Background()
+
+	relationship, err := s.UpdateModelRelationshipTx(ctx, int(claims.DatasetClaim.IntId), int(claims.OrgClaim.IntId),
+		request.PathParameters["id"], parsedRequestBody, claims.UserClaim.NodeId)
+	if err != nil {
+		return modelRelationshipErrorResponse(err), nil
+	}
+
+	// CREATING API RESPONSE
+	jsonBody, _ := json.Marshal(relationship)
+	apiResponse = events.APIGatewayV2HTTPResponse{Body: string(jsonBody), StatusCode: 200}
+
+	return &apiResponse, nil
+}
+
+// deleteModelRelationshipRoute deletes a relationship between models that no records have
+func deleteModelRelationshipRoute(s *store.ModelServiceStore, request events.APIGatewayV2HTTPRequest,
+	claims *authorizer.Claims) (*events.APIGatewayV2HTTPResponse, error) {
+
+	ctx := context.Background()
+
+	err := s.DeleteModelRelationshipTx(ctx, int(claims.DatasetClaim.IntId), int(claims.OrgClaim.IntId),
+		request.PathParameters["id"])
+	if err != nil {
+		return modelRelationshipErrorResponse(err), nil
+	}
+
+	apiResponse := events.APIGatewayV2HTTPResponse{StatusCode: 204}
+	return &apiResponse, nil
+}
+
+// modelRelationshipErrorResponse returns the API response for errors from managing model relationships.
+func modelRelationshipErrorResponse(err error) *events.APIGatewayV2HTTPResponse {
+	var apiResponse events.APIGatewayV2HTTPResponse
+
+	switch err.(type) {
+	case *models.UnknownModelRelationshipError:
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage(err.Error(), 404), StatusCode: 404}
+	case *models.UnknownModelError, *models.EmptyError, *models.NameTooLongError, *models.ValidationError,
+		*models.ReservedNameError, *models.InvalidCardinalityError:
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage(err.Error(), 400), StatusCode: 400}
+	case *models.ModelRelationshipExistsError, *models.ModelRelationshipInUseError:
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage(err.Error(), 409), StatusCode: 409}
+	default:
+		log.Println(err)
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage("Internal Server Error", 500), StatusCode: 500}
+	}
+
+	return &apiResponse
+}
@@ -11,6 +11,8 @@ import (
 	"github.com/pennsieve/pennsieve-go-core/pkg/authorizer"
 	"github.com/pennsieve/pennsieve-go-core/pkg/models/gateway"
 	log "github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
 )
 
 func getDatasetModelsRoute(s *store.ModelServiceStore, request events.APIGatewayV2HTTPRequest,
@@ -33,11 +35,12 @@ func getDatasetModelsRoute(s *store.ModelServiceStore, request events.APIGateway
 	return &apiResponse, nil
 }
 
-func postGraphQueryRoute(s *store.ModelServiceStore, request events.APIGatewayV2HTTPRequest,
+// postModelRoute creates a new model in the dataset
+func postModelRoute(s *store.ModelServiceStore, request events.APIGatewayV2HTTPRequest,
 	claims *authorizer.Claims) (*events.APIGatewayV2HTTPResponse, error) {
 	apiResponse := events.APIGatewayV2HTTPResponse{}
 
-	parsedRequestBody := query.QueryRequestBody{}
+	parsedRequestBody := models.CreateModelRequestBody{}
 	if err := json.Unmarshal([]byte(request.Body), &parsedRequestBody); err != nil {
 		message := "Error: Unable to parse body: " + fmt.Sprint(err)
 		apiResponse = events.APIGatewayV2HTTPResponse{
@@ -47,19 +50,149 @@ func postGraphQueryRoute(s *store.ModelServiceStore, request events.APIGatewayV2
 
 	ctx := context.Background()
 
-	response, err := s.QueryGraph(ctx, parsedRequestBody, int(claims.DatasetClaim.IntId), int(claims.OrgClaim.IntId))
+	model, err := s.CreateModelTx(ctx, int(claims.DatasetClaim.IntId), int(claims.OrgClaim.IntId),
+		claims.DatasetClaim.NodeId, claims.OrgClaim.NodeId, parsedRequestBody.Name, parsedRequestBody.DisplayName,
+		parsedRequestBody.Description, claims.UserClaim.NodeId)
 
 	if err != nil {
 		switch err.(type) {
-		case *models.UnknownModelPropertyError:
+		case *models.EmptyError, *models.NameTooLongError, *models.ValidationError, *models.ReservedNameError:
 			apiResponse = events.APIGatewayV2HTTPResponse{
 				Body: gateway.CreateErrorMessage(err.Error(), 400), StatusCode: 400}
+		case *models.ModelNameCountError:
+			apiResponse = events.APIGatewayV2HTTPResponse{
+				Body: gateway.CreateErrorMessage(err.Error(), 409), StatusCode: 409}
+		default:
+			log.Println(err)
+			apiResponse = events.APIGatewayV2HTTPResponse{
+				Body: gateway.CreateErrorMessage("Internal Server Error", 500), StatusCode: 500}
+		}
+
+		return &apiResponse, nil
+	}
+
+	// CREATING API RESPONSE
+	jsonBody, _ := json.Marshal(model)
+	apiResponse = events.APIGatewayV2HTTPResponse{Body: string(jsonBody), StatusCode: 201}
+
+	return &apiResponse, nil
+}
+
+// putModelRoute updates the display name and description of a model
+func putModelRoute(s *store.ModelServiceStore, request events.APIGatewayV2HTTPRequest,
+	claims *authorizer.Claims) (*events.APIGatewayV2HTTPResponse, error) {
+	apiResponse := events.APIGatewayV2HTTPResponse{}
+
+	modelId := request.PathParameters["id"]
+
+	parsedRequestBody := models.UpdateModelRequestBody{}
+	if err := json.Unmarshal([]byte(request.Body), &parsedRequestBody); err != nil {
+		message := "Error: Unable to parse body: " + fmt.Sprint(err)
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage(message, 400), StatusCode: 400}
+		return &apiResponse, nil
+	}
+
+	ctx := context.Background()
+
+	model, err := s.UpdateModelTx(ctx, int(claims.DatasetClaim.IntId), int(claims.OrgClaim.IntId), modelId,
+		parsedRequestBody.DisplayName, parsedRequestBody.Description, claims.UserClaim.NodeId)
+
+	if err != nil {
+		switch err.(type) {
 		case *models.UnknownModelError:
 			apiResponse = events.APIGatewayV2HTTPResponse{
-				Body: gateway.CreateErrorMessage(err.Error(), 400), StatusCode: 400}
-		case *models.UnsupportedOperatorError:
+				Body: gateway.CreateErrorMessage(err.Error(), 404), StatusCode: 404}
+		default:
+			log.Println(err)
+			apiResponse = events.APIGatewayV2HTTPResponse{
+				Body: gateway.CreateErrorMessage("Internal Server Error", 500), StatusCode: 500}
+		}
+
+		return &apiResponse, nil
+	}
+
+	// CREATING API RESPONSE
+	jsonBody, _ := json.Marshal(model)
+	apiResponse = events.APIGatewayV2HTTPResponse{Body: string(jsonBody), StatusCode: 200}
+
+	return &apiResponse, nil
+}
+
+// deleteModelRoute deletes a model, and when the cascade parameter is set, all records of the model.
+func deleteModelRoute(s *store.ModelServiceStore, request events.APIGatewayV2HTTPRequest,
+	claims *authorizer.Claims) (*events.APIGatewayV2HTTPResponse, error) {
+	apiResponse := events.APIGatewayV2HTTPResponse{}
+
+	modelId := request.PathParameters["id"]
+
+	cascade := false
+	if value, found := request.QueryStringParameters["cascade"]; found {
+		var err error
+		if cascade, err = strconv.ParseBool(value); err != nil {
+			message := "Error: Invalid value for cascade: " + value
+			apiResponse = events.APIGatewayV2HTTPResponse{
+				Body: gateway.CreateErrorMessage(message, 400), StatusCode: 400}
+			return &apiResponse, nil
+		}
+	}
+
+	ctx := context.Background()
+
+	err := s.DeleteModelTx(ctx, int(claims.DatasetClaim.IntId), int(claims.OrgClaim.IntId), modelId, cascade)
+	if err != nil {
+		switch err.(type) {
+		case *models.UnknownModelError:
+			apiResponse = events.APIGatewayV2HTTPResponse{
+				Body: gateway.CreateErrorMessage(err.Error(), 404), StatusCode: 404}
+		case *models.ModelHasRecordsError:
+			apiResponse = events.APIGatewayV2HTTPResponse{
+				Body: gateway.CreateErrorMessage(err.Error(), 409), StatusCode: 409}
+		default:
+			log.Println(err)
+			apiResponse = events.APIGatewayV2HTTPResponse{
+				Body: gateway.CreateErrorMessage("Internal Server Error", 500), StatusCode: 500}
+		}
+
+		return &apiResponse, nil
+	}
+
+	apiResponse = events.APIGatewayV2HTTPResponse{StatusCode: 204}
+	return &apiResponse, nil
+}
+
+// putModelPropertiesRoute adds, replaces or removes the properties of a model
+func putModelPropertiesRoute(s *store.ModelServiceStore, request events.APIGatewayV2HTTPRequest,
+	claims *authorizer.Claims) (*events.APIGatewayV2HTTPResponse, error) {
+	apiResponse := events.APIGatewayV2HTTPResponse{}
+
+	modelId := request.PathParameters["id"]
+
+	parsedRequestBody := models.UpdateModelPropertiesRequestBody{}
+	if err := json.Unmarshal([]byte(request.Body), &parsedRequestBody); err != nil {
+		message := "Error: Unable to parse body: " + fmt.Sprint(err)
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage(message, 400), StatusCode: 400}
+		return &apiResponse, nil
+	}
+
+	ctx := context.Background()
+
+	props, err := s.UpdateModelPropertiesTx(ctx, int(claims.DatasetClaim.IntId), int(claims.OrgClaim.IntId), modelId,
+		parsedRequestBody)
+
+	if err != nil {
+		switch err.(type) {
+		case *models.UnknownModelError:
+			apiResponse = events.APIGatewayV2HTTPResponse{
+				Body: gateway.CreateErrorMessage(err.Error(), 404), StatusCode: 404}
+		case *models.UnknownModelPropertyError, *models.ReservedNameError, *models.EmptyError, *models.NameTooLongError,
+			*models.ValidationError, *models.ModelTitleError, *models.InvalidPropertyError:
 			apiResponse = events.APIGatewayV2HTTPResponse{
 				Body: gateway.CreateErrorMessage(err.Error(), 400), StatusCode: 400}
+		case *models.PropertyInUseError, *models.PropertyConversionError:
+			apiResponse = events.APIGatewayV2HTTPResponse{
+				Body: gateway.CreateErrorMessage(err.Error(), 409), StatusCode: 409}
 		default:
 			log.Println(err)
 			apiResponse = events.APIGatewayV2HTTPResponse{
@@ -67,7 +200,84 @@ func postGraphQueryRoute(s *store.ModelServiceStore, request events.APIGatewayV2
 		}
 
 		return &apiResponse, nil
+	}
+
+	// CREATING API RESPONSE
+	jsonBody, _ := json.Marshal(props)
+	apiResponse = events.APIGatewayV2HTTPResponse{Body: string(jsonBody), StatusCode: 200}
+
+	return &apiResponse, nil
+}
+
+// postGraphQueryRoute returns a page of records that match a query, or exports all matching records when a
+// CSV, TSV or NDJSON format is requested in the body or the Accept header.
+func postGraphQueryRoute(s *store.ModelServiceStore, request events.APIGatewayV2HTTPRequest,
+	claims *authorizer.Claims) (*events.APIGatewayV2HTTPResponse, error) {
+	apiResponse := events.APIGatewayV2HTTPResponse{}
+
+	parsedRequestBody := query.QueryRequestBody{}
+	if err := json.Unmarshal([]byte(request.Body), &parsedRequestBody); err != nil {
+		message := "Error: Unable to parse body: " + fmt.Sprint(err)
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage(message, 400), StatusCode: 400}
+		return &apiResponse, nil
+	}
+
+	return queryGraphResponse(s, request, claims, parsedRequestBody)
+}
+
+// queryGraphResponse runs a query, and returns the page of records that match the query, the groups of an aggregate
+// query, or an export of all matching records when a CSV, TSV or NDJSON format is requested in the query or the
+// Accept header.
+func queryGraphResponse(s *store.ModelServiceStore, request events.APIGatewayV2HTTPRequest, claims *authorizer.Claims,
+	parsedRequestBody query.QueryRequestBody) (*events.APIGatewayV2HTTPResponse, error) {
+	apiResponse := events.APIGatewayV2HTTPResponse{}
+
+	format, err := exportFormat(request, parsedRequestBody.Format)
+	if err != nil {
+		message := "Error: " + err.Error()
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage(message, 400), StatusCode: 400}
+		return &apiResponse, nil
+	}
+
+	ctx := context.Background()
+
+	if parsedRequestBody.Aggregate != nil {
+		if format != query.JSON {
+			message := "Error: aggregate queries cannot be exported as " + format.String()
+			apiResponse = events.APIGatewayV2HTTPResponse{
+				Body: gateway.CreateErrorMessage(message, 400), StatusCode: 400}
+			return &apiResponse, nil
+		}
+
+		response, err := s.AggregateQueryGraph(ctx, parsedRequestBody, int(claims.DatasetClaim.IntId), int(claims.OrgClaim.IntId))
+		if err != nil {
+			return queryErrorResponse(err), nil
+		}
+
+		jsonBody, _ := json.Marshal(response)
+		apiResponse = events.APIGatewayV2HTTPResponse{Body: string(jsonBody), StatusCode: 200}
+		return &apiResponse, nil
+	}
+
+	if format != query.JSON {
+		w := newExportWriter(ctx, s3Client, int(claims.DatasetClaim.IntId),
+			fmt.Sprintf("%s.%s", parsedRequestBody.Model, format), format.ContentType())
+		if _, err = s.ExportQueryGraph(ctx, parsedRequestBody, int(claims.DatasetClaim.IntId), int(claims.OrgClaim.IntId),
+			w, format); err != nil {
+			if err := w.abort(); err != nil {
+				log.Println(err)
+			}
+			return queryErrorResponse(err), nil
+		}
 
+		return exportResponse(ctx, s3Presigner, w)
+	}
+
+	response, err := s.QueryGraph(ctx, parsedRequestBody, int(claims.DatasetClaim.IntId), int(claims.OrgClaim.IntId))
+	if err != nil {
+		return queryErrorResponse(err), nil
 	}
 
 	// CREATING API RESPONSE
@@ -77,6 +287,110 @@ func postGraphQueryRoute(s *store.ModelServiceStore, request events.APIGatewayV2
 	return &apiResponse, nil
 }
 
+// maxResponseSize is the largest export in bytes that is returned in the body of a response, which stays below
+// the 6MB response limit of the lambda.
+const maxResponseSize = 5 << 20
+
+// exportResponse returns an export as the body of the response. Exports larger than maxResponseSize are uploaded to
+// S3 while they are written, and the response redirects to a pre-signed URL of the export.
+func exportResponse(ctx context.Context, presigner S3PresignGetObjectAPI, w *exportWriter) (
+	*events.APIGatewayV2HTTPResponse, error) {
+
+	if !w.uploaded() {
+		apiResponse := events.APIGatewayV2HTTPResponse{
+			Headers: map[string]string{
+				"Content-Type":        w.contentType,
+				"Content-Disposition": fmt.Sprintf("attachment; filename=%q", w.fileName),
+			},
+			Body:       w.buf.String(),
+			StatusCode: 200,
+		}
+		return &apiResponse, nil
+	}
+
+	err := w.complete()
+	if err != nil {
+		if err := w.abort(); err != nil {
+			log.Println(err)
+		}
+	}
+	url := ""
+	if err == nil {
+		url, err = presignExportObject(ctx, presigner, w)
+	}
+	if err != nil {
+		log.Println(err)
+		apiResponse := events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage("Internal Server Error", 500), StatusCode: 500}
+		return &apiResponse, nil
+	}
+
+	jsonBody, _ := json.Marshal(map[string]string{"url": url})
+	apiResponse := events.APIGatewayV2HTTPResponse{
+		Headers:    map[string]string{"Location": url, "Content-Type": "application/json"},
+		Body:       string(jsonBody),
+		StatusCode: 303,
+	}
+	return &apiResponse, nil
+}
+
+// exportFormat returns the requested export format of a query, which is set in the body or in the Accept header.
+func exportFormat(request events.APIGatewayV2HTTPRequest, format string) (query.ExportFormat, error) {
+	if format != "" {
+		f, found := query.StringToExportFormatDict[strings.ToLower(format)]
+		if !found {
+			return query.JSON, fmt.Errorf("unsupported format: %s", format)
+		}
+		return f, nil
+	}
+
+	for k, v := range request.Headers {
+		if !strings.EqualFold(k, "accept") {
+			continue
+		}
+		for _, mediaType := range strings.Split(v, ",") {
+			mediaType = strings.TrimSpace(strings.ToLower(strings.Split(mediaType, ";")[0]))
+			if f, found := query.MediaTypeToExportFormatDict[mediaType]; found {
+				return f, nil
+			}
+		}
+	}
+
+	return query.JSON, nil
+}
+
+// queryErrorResponse returns the API response for errors from querying records.
+func queryErrorResponse(err error) *events.APIGatewayV2HTTPResponse {
+	var apiResponse events.APIGatewayV2HTTPResponse
+
+	switch err.(type) {
+	case *models.UnknownModelPropertyError:
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage(err.Error(), 400), StatusCode: 400}
+	case *models.UnknownModelError:
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage(err.Error(), 400), StatusCode: 400}
+	case *models.UnsupportedOperatorError, *models.InvalidFilterError, *models.InvalidAggregateError,
+		*models.InvalidOrderByError, *models.InvalidCursorError:
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage(err.Error(), 400), StatusCode: 400}
+	default:
+		log.Println(err)
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage("Internal Server Error", 500), StatusCode: 500}
+	}
+
+	return &apiResponse
+}
+
+// cardinalityErrorMessage is an error response that includes the pairs of records that violate the cardinality of
+// a model relationship.
+type cardinalityErrorMessage struct {
+	Code    int                           `json:"code"`
+	Message string                        `json:"message"`
+	Errors  []models.CardinalityViolation `json:"errors"`
+}
+
 // postGraphRecordRelationshipRoute creates 1 or more relationships between existing records
 func postGraphRecordRelationshipRoute(s *store.ModelServiceStore, request events.APIGatewayV2HTTPRequest,
 	claims *authorizer.Claims) (*events.APIGatewayV2HTTPResponse, error) {
@@ -93,13 +407,50 @@ func postGraphRecordRelationshipRoute(s *store.ModelServiceStore, request events
 	ctx := context.Background()
 
 	response, err := s.CreateRelationships(ctx, parsedRequestBody, int(claims.DatasetClaim.IntId), int(claims.OrgClaim.IntId), claims.UserClaim.NodeId)
+	if e, ok := err.(*models.CardinalityError); ok {
+		jsonBody, _ := json.Marshal(cardinalityErrorMessage{Code: 409, Message: e.Error(), Errors: e.Violations})
+		apiResponse = events.APIGatewayV2HTTPResponse{Body: string(jsonBody), StatusCode: 409}
+		return &apiResponse, nil
+	}
 	if err != nil {
 		message := err.Error()
 		apiResponse = events.APIGatewayV2HTTPResponse{
 			Body: gateway.CreateErrorMessage(message, 400), StatusCode: 400}
 		return &apiResponse, nil
+	}
 
-		return nil, err
+	// CREATING API RESPONSE
+	jsonBody, _ := json.Marshal(response)
+	apiResponse = events.APIGatewayV2HTTPResponse{Body: string(jsonBody), StatusCode: 200}
+
+	return &apiResponse, nil
+}
+
+// getRecordRelationshipsRoute returns a page of the relationships of a record, optionally of a single relationship name
+func getRecordRelationshipsRoute(s *store.ModelServiceStore, request events.APIGatewayV2HTTPRequest,
+	claims *authorizer.Claims) (*events.APIGatewayV2HTTPResponse, error) {
+	apiResponse := events.APIGatewayV2HTTPResponse{}
+
+	page := map[string]int{}
+	for _, param := range []string{"limit", "offset"} {
+		if value, found := request.QueryStringParameters[param]; found {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				message := fmt.Sprintf("Error: Invalid value for %s: %s", param, value)
+				apiResponse = events.APIGatewayV2HTTPResponse{
+					Body: gateway.CreateErrorMessage(message, 400), StatusCode: 400}
+				return &apiResponse, nil
+			}
+			page[param] = n
+		}
+	}
+
+	ctx := context.Background()
+
+	response, err := s.GetRecordRelationships(ctx, int(claims.DatasetClaim.IntId), int(claims.OrgClaim.IntId),
+		request.PathParameters["id"], request.QueryStringParameters["name"], page["limit"], page["offset"])
+	if err != nil {
+		return recordRelationshipErrorResponse(err), nil
 	}
 
 	// CREATING API RESPONSE
@@ -109,11 +460,12 @@ func postGraphRecordRelationshipRoute(s *store.ModelServiceStore, request events
 	return &apiResponse, nil
 }
 
-func postAutocompleteRoute(s *store.ModelServiceStore, request events.APIGatewayV2HTTPRequest,
+// deleteGraphRecordRelationshipRoute deletes relationships between records by their ids or by pairs of records
+func deleteGraphRecordRelationshipRoute(s *store.ModelServiceStore, request events.APIGatewayV2HTTPRequest,
 	claims *authorizer.Claims) (*events.APIGatewayV2HTTPResponse, error) {
 	apiResponse := events.APIGatewayV2HTTPResponse{}
 
-	parsedRequestBody := query.AutocompleteRequestBody{}
+	parsedRequestBody := models.DeleteRecordRelationshipsRequestBody{}
 	if err := json.Unmarshal([]byte(request.Body), &parsedRequestBody); err != nil {
 		message := "Error: Unable to parse body: " + fmt.Sprint(err)
 		apiResponse = events.APIGatewayV2HTTPResponse{
@@ -123,27 +475,83 @@ func postAutocompleteRoute(s *store.ModelServiceStore, request events.APIGateway
 
 	ctx := context.Background()
 
-	values, err := s.Autocomplete(ctx, parsedRequestBody, int(claims.DatasetClaim.IntId), int(claims.OrgClaim.IntId))
+	response, err := s.DeleteRecordRelationshipsTx(ctx, int(claims.DatasetClaim.IntId), int(claims.OrgClaim.IntId),
+		parsedRequestBody)
+	if err != nil {
+		return recordRelationshipErrorResponse(err), nil
+	}
+
+	// CREATING API RESPONSE
+	jsonBody, _ := json.Marshal(response)
+	apiResponse = events.APIGatewayV2HTTPResponse{Body: string(jsonBody), StatusCode: 200}
 
+	return &apiResponse, nil
+}
+
+// recordRelationshipErrorResponse returns the API response for errors from listing and deleting record relationships.
+func recordRelationshipErrorResponse(err error) *events.APIGatewayV2HTTPResponse {
+	var apiResponse events.APIGatewayV2HTTPResponse
+
+	switch err.(type) {
+	case *models.UnknownRecordError:
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage(err.Error(), 404), StatusCode: 404}
+	case *models.InvalidRecordRelationshipsError:
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage(err.Error(), 400), StatusCode: 400}
+	default:
+		log.Println(err)
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage("Internal Server Error", 500), StatusCode: 500}
+	}
+
+	return &apiResponse
+}
+
+// postGraphQueryExplainRoute returns the Cypher that a query runs, and the execution plan of the query when it is
+// requested, without running the query.
+func postGraphQueryExplainRoute(s *store.ModelServiceStore, request events.APIGatewayV2HTTPRequest,
+	claims *authorizer.Claims) (*events.APIGatewayV2HTTPResponse, error) {
+	apiResponse := events.APIGatewayV2HTTPResponse{}
+
+	parsedRequestBody := query.ExplainRequestBody{}
+	if err := json.Unmarshal([]byte(request.Body), &parsedRequestBody); err != nil {
+		message := "Error: Unable to parse body: " + fmt.Sprint(err)
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage(message, 400), StatusCode: 400}
+		return &apiResponse, nil
+	}
+
+	ctx := context.Background()
+
+	response, err := s.ExplainQueryGraph(ctx, parsedRequestBody, int(claims.DatasetClaim.IntId), int(claims.OrgClaim.IntId))
 	if err != nil {
-		switch err.(type) {
-		case *models.UnknownModelPropertyError:
-			apiResponse = events.APIGatewayV2HTTPResponse{
-				Body: gateway.CreateErrorMessage(err.Error(), 400), StatusCode: 400}
-		case *models.UnknownModelError:
-			apiResponse = events.APIGatewayV2HTTPResponse{
-				Body: gateway.CreateErrorMessage(err.Error(), 400), StatusCode: 400}
-		case *models.UnsupportedOperatorError:
-			apiResponse = events.APIGatewayV2HTTPResponse{
-				Body: gateway.CreateErrorMessage(err.Error(), 400), StatusCode: 400}
-		default:
-			log.Println(err)
-			apiResponse = events.APIGatewayV2HTTPResponse{
-				Body: gateway.CreateErrorMessage("Internal Server Error", 500), StatusCode: 500}
-		}
+		return queryErrorResponse(err), nil
+	}
 
+	jsonBody, _ := json.Marshal(response)
+	apiResponse = events.APIGatewayV2HTTPResponse{Body: string(jsonBody), StatusCode: 200}
+
+	return &apiResponse, nil
+}
+
+func postAutocompleteRoute(s *store.ModelServiceStore, request events.APIGatewayV2HTTPRequest,
+	claims *authorizer.Claims) (*events.APIGatewayV2HTTPResponse, error) {
+	apiResponse := events.APIGatewayV2HTTPResponse{}
+
+	parsedRequestBody := query.AutocompleteRequestBody{}
+	if err := json.Unmarshal([]byte(request.Body), &parsedRequestBody); err != nil {
+		message := "Error: Unable to parse body: " + fmt.Sprint(err)
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage(message, 400), StatusCode: 400}
 		return &apiResponse, nil
+	}
 
+	ctx := context.Background()
+
+	values, err := s.Autocomplete(ctx, parsedRequestBody, int(claims.DatasetClaim.IntId), int(claims.OrgClaim.IntId))
+	if err != nil {
+		return queryErrorResponse(err), nil
 	}
 
 	// CREATING API RESPONSE
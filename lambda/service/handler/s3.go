@@ -0,0 +1,236 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/google/uuid"
+	"github.com/pennsieve/model-service-serverless/api/models"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// S3GetObjectAPI defines the interface for the GetObject function.
+// We use this interface to test the import of files using a local stand-in for S3.
+type S3GetObjectAPI interface {
+	GetObject(ctx context.Context,
+		params *s3.GetObjectInput,
+		optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// S3MultipartUploadAPI defines the interface for the functions of a multipart upload.
+// We use this interface to test the export of files using a local stand-in for S3.
+type S3MultipartUploadAPI interface {
+	CreateMultipartUpload(ctx context.Context,
+		params *s3.CreateMultipartUploadInput,
+		optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	UploadPart(ctx context.Context,
+		params *s3.UploadPartInput,
+		optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error)
+	CompleteMultipartUpload(ctx context.Context,
+		params *s3.CompleteMultipartUploadInput,
+		optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(ctx context.Context,
+		params *s3.AbortMultipartUploadInput,
+		optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+}
+
+// S3PresignGetObjectAPI defines the interface for the PresignGetObject function.
+type S3PresignGetObjectAPI interface {
+	PresignGetObject(ctx context.Context,
+		params *s3.GetObjectInput,
+		optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error)
+}
+
+// maxImportSize is the maximum size in bytes of a file that is imported from S3.
+const maxImportSize = 20 << 20
+
+// importBucket is the only S3 bucket that files can be imported from.
+var importBucket = os.Getenv("IMPORT_BUCKET")
+
+// importKeyPrefix returns the prefix of the keys of the files that can be imported into a dataset of an
+// organization. Files of other datasets in the import bucket cannot be imported.
+func importKeyPrefix(organizationId int64, datasetId int64) string {
+	return fmt.Sprintf("%d/%d/", organizationId, datasetId)
+}
+
+// getImportObject returns the contents of the S3 object that contains a file to import. The key of the object must
+// start with the key prefix.
+func getImportObject(ctx context.Context, api S3GetObjectAPI, source models.ImportSource, keyPrefix string) (
+	[]byte, error) {
+
+	if source.Bucket == "" || source.Key == "" {
+		return nil, errors.New("source requires a bucket and key")
+	}
+	if source.Bucket != importBucket {
+		return nil, fmt.Errorf("cannot import from bucket %s", source.Bucket)
+	}
+	for _, segment := range strings.Split(source.Key, "/") {
+		if segment == ".." {
+			return nil, fmt.Errorf("cannot import from key %s", source.Key)
+		}
+	}
+	if !strings.HasPrefix(source.Key, keyPrefix) {
+		return nil, fmt.Errorf("cannot import from key %s", source.Key)
+	}
+
+	output, err := api.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(source.Bucket),
+		Key:    aws.String(source.Key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer output.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(output.Body, maxImportSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxImportSize {
+		return nil, fmt.Errorf("file is larger than %d bytes", maxImportSize)
+	}
+
+	return body, nil
+}
+
+// exportBucket is the S3 bucket that stores exports that are too large to return in a response.
+var exportBucket = os.Getenv("EXPORT_BUCKET")
+
+// exportURLExpiration is the time that a pre-signed URL of an export is valid.
+const exportURLExpiration = time.Hour
+
+// exportPartSize is the size in bytes of the parts of an export that is uploaded to S3, which is the smallest size
+// that S3 allows for all but the last part.
+const exportPartSize = 5 << 20
+
+// exportWriter writes an export in memory until it is larger than maxResponseSize. A larger export is uploaded to S3
+// in parts while it is written, so at most a part of the export is kept in memory.
+type exportWriter struct {
+	ctx         context.Context
+	api         S3MultipartUploadAPI
+	key         string
+	fileName    string
+	contentType string
+	buf         bytes.Buffer
+	uploadId    *string
+	parts       []types.CompletedPart
+}
+
+// newExportWriter returns a writer for an export of a dataset, which is stored in S3 when it is too large to return
+// in a response.
+func newExportWriter(ctx context.Context, api S3MultipartUploadAPI, datasetId int, fileName string,
+	contentType string) *exportWriter {
+
+	return &exportWriter{
+		ctx:         ctx,
+		api:         api,
+		key:         fmt.Sprintf("exports/%d/%s/%s", datasetId, uuid.NewString(), fileName),
+		fileName:    fileName,
+		contentType: contentType,
+	}
+}
+
+// Write adds p to the export. Once the export is larger than maxResponseSize, it starts a multipart upload and
+// uploads every full part.
+func (w *exportWriter) Write(p []byte) (int, error) {
+	n, _ := w.buf.Write(p)
+	if w.uploadId == nil && w.buf.Len() <= maxResponseSize {
+		return n, nil
+	}
+
+	if w.uploadId == nil {
+		output, err := w.api.CreateMultipartUpload(w.ctx, &s3.CreateMultipartUploadInput{
+			Bucket:      aws.String(exportBucket),
+			Key:         aws.String(w.key),
+			ContentType: aws.String(w.contentType),
+		})
+		if err != nil {
+			return 0, err
+		}
+		w.uploadId = output.UploadId
+	}
+
+	for w.buf.Len() >= exportPartSize {
+		if err := w.uploadPart(w.buf.Next(exportPartSize)); err != nil {
+			return 0, err
+		}
+	}
+
+	return n, nil
+}
+
+// uploadPart uploads the next part of the export.
+func (w *exportWriter) uploadPart(part []byte) error {
+	partNumber := int32(len(w.parts) + 1)
+	output, err := w.api.UploadPart(w.ctx, &s3.UploadPartInput{
+		Bucket:     aws.String(exportBucket),
+		Key:        aws.String(w.key),
+		UploadId:   w.uploadId,
+		PartNumber: partNumber,
+		Body:       bytes.NewReader(part),
+	})
+	if err != nil {
+		return err
+	}
+
+	w.parts = append(w.parts, types.CompletedPart{ETag: output.ETag, PartNumber: partNumber})
+	return nil
+}
+
+// uploaded returns whether the export is uploaded to S3 instead of kept in memory.
+func (w *exportWriter) uploaded() bool {
+	return w.uploadId != nil
+}
+
+// complete uploads the last part of an export that is uploaded to S3, and completes the upload.
+func (w *exportWriter) complete() error {
+	if w.buf.Len() > 0 {
+		if err := w.uploadPart(w.buf.Next(w.buf.Len())); err != nil {
+			return err
+		}
+	}
+
+	_, err := w.api.CompleteMultipartUpload(w.ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(exportBucket),
+		Key:             aws.String(w.key),
+		UploadId:        w.uploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: w.parts},
+	})
+	return err
+}
+
+// abort removes the parts of an export that failed, so S3 does not keep them.
+func (w *exportWriter) abort() error {
+	if !w.uploaded() {
+		return nil
+	}
+
+	_, err := w.api.AbortMultipartUpload(w.ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(exportBucket),
+		Key:      aws.String(w.key),
+		UploadId: w.uploadId,
+	})
+	return err
+}
+
+// presignExportObject returns a pre-signed URL to download an export that is stored in S3.
+func presignExportObject(ctx context.Context, presigner S3PresignGetObjectAPI, w *exportWriter) (string, error) {
+	request, err := presigner.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket:                     aws.String(exportBucket),
+		Key:                        aws.String(w.key),
+		ResponseContentDisposition: aws.String(fmt.Sprintf("attachment; filename=%q", w.fileName)),
+	}, s3.WithPresignExpires(exportURLExpiration))
+	if err != nil {
+		return "", err
+	}
+
+	return request.URL, nil
+}
@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pennsieve/model-service-serverless/api/models"
+	"github.com/pennsieve/model-service-serverless/api/models/query"
+	"github.com/pennsieve/model-service-serverless/api/store"
+	"github.com/pennsieve/pennsieve-go-core/pkg/authorizer"
+	"github.com/pennsieve/pennsieve-go-core/pkg/models/gateway"
+	"github.com/pennsieve/pennsieve-go-core/pkg/models/role"
+	"strings"
+)
+
+// getSavedQueriesRoute returns the saved queries of the dataset
+func getSavedQueriesRoute(s *store.ModelServiceStore, request events.APIGatewayV2HTTPRequest,
+	claims *authorizer.Claims) (*events.APIGatewayV2HTTPResponse, error) {
+
+	ctx := context.Background()
+
+	savedQueries, err := s.GetSavedQueries(ctx, int(claims.DatasetClaim.IntId), int(claims.OrgClaim.IntId))
+	if err != nil {
+		return savedQueryErrorResponse(err), nil
+	}
+
+	// CREATING API RESPONSE
+	jsonBody, _ := json.Marshal(savedQueries)
+	apiResponse := events.APIGatewayV2HTTPResponse{Body: string(jsonBody), StatusCode: 200}
+
+	return &apiResponse, nil
+}
+
+// postSavedQueryRoute saves a query in the dataset
+func postSavedQueryRoute(s *store.ModelServiceStore, request events.APIGatewayV2HTTPRequest,
+	claims *authorizer.Claims) (*events.APIGatewayV2HTTPResponse, error) {
+	apiResponse := events.APIGatewayV2HTTPResponse{}
+
+	parsedRequestBody := query.CreateSavedQueryRequestBody{}
+	if err := json.Unmarshal([]byte(request.Body), &parsedRequestBody); err != nil {
+		message := "Error: Unable to parse body: " + fmt.Sprint(err)
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage(message, 400), StatusCode: 400}
+		return &apiResponse, nil
+	}
+
+	ctx := context.Background()
+
+	savedQuery, err := s.CreateSavedQueryTx(ctx, int(claims.DatasetClaim.IntId), int(claims.OrgClaim.IntId),
+		parsedRequestBody, claims.UserClaim.NodeId)
+	if err != nil {
+		return savedQueryErrorResponse(err), nil
+	}
+
+	// CREATING API RESPONSE
+	jsonBody, _ := json.Marshal(savedQuery)
+	apiResponse = events.APIGatewayV2HTTPResponse{Body: string(jsonBody), StatusCode: 201}
+
+	return &apiResponse, nil
+}
+
+// getSavedQueryRoute returns a single saved query
+func getSavedQueryRoute(s *store.ModelServiceStore, request events.APIGatewayV2HTTPRequest,
+	claims *authorizer.Claims) (*events.APIGatewayV2HTTPResponse, error) {
+
+	ctx := context.Background()
+
+	savedQuery, err := s.GetSavedQuery(ctx, int(claims.DatasetClaim.IntId), int(claims.OrgClaim.IntId),
+		request.PathParameters["id"])
+	if err != nil {
+		return savedQueryErrorResponse(err), nil
+	}
+
+	// CREATING API RESPONSE
+	jsonBody, _ := json.Marshal(savedQuery)
+	apiResponse := events.APIGatewayV2HTTPResponse{Body: string(jsonBody), StatusCode: 200}
+
+	return &apiResponse, nil
+}
+
+// putSavedQueryRoute updates the name, description or query of a saved query
+func putSavedQueryRoute(s *store.ModelServiceStore, request events.APIGatewayV2HTTPRequest,
+	claims *authorizer.Claims) (*events.APIGatewayV2HTTPResponse, error) {
+	apiResponse := events.APIGatewayV2HTTPResponse{}
+
+	parsedRequestBody := query.UpdateSavedQueryRequestBody{}
+	if err := json.Unmarshal([]byte(request.Body), &parsedRequestBody); err != nil {
+		message := "Error: Unable to parse body: " + fmt.Sprint(err)
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage(message, 400), StatusCode: 400}
+		return &apiResponse, nil
+	}
+
+	ctx := context.Background()
+
+	savedQuery, err := s.UpdateSavedQueryTx(ctx, int(claims.DatasetClaim.IntId), int(claims.OrgClaim.IntId),
+		request.PathParameters["id"], parsedRequestBody, claims.UserClaim.NodeId, managesSavedQueries(claims))
+	if err != nil {
+		return savedQueryErrorResponse(err), nil
+	}
+
+	// CREATING API RESPONSE
+	jsonBody, _ := json.Marshal(savedQuery)
+	apiResponse = events.APIGatewayV2HTTPResponse{Body: string(jsonBody), StatusCode: 200}
+
+	return &apiResponse, nil
+}
+
+// deleteSavedQueryRoute deletes a saved query
+func deleteSavedQueryRoute(s *store.ModelServiceStore, request events.APIGatewayV2HTTPRequest,
+	claims *authorizer.Claims) (*events.APIGatewayV2HTTPResponse, error) {
+
+	ctx := context.Background()
+
+	err := s.DeleteSavedQueryTx(ctx, int(claims.DatasetClaim.IntId), int(claims.OrgClaim.IntId),
+		request.PathParameters["id"], claims.UserClaim.NodeId, managesSavedQueries(claims))
+	if err != nil {
+		return savedQueryErrorResponse(err), nil
+	}
+
+	apiResponse := events.APIGatewayV2HTTPResponse{StatusCode: 204}
+	return &apiResponse, nil
+}
+
+// postRunSavedQueryRoute runs a saved query with the limit, offset, cursor, format and filter values in the body,
+// like a query that is posted to the query route.
+func postRunSavedQueryRoute(s *store.ModelServiceStore, request events.APIGatewayV2HTTPRequest,
+	claims *authorizer.Claims) (*events.APIGatewayV2HTTPResponse, error) {
+	apiResponse := events.APIGatewayV2HTTPResponse{}
+
+	// The overrides are optional
+	parsedRequestBody := query.RunSavedQueryRequestBody{}
+	if strings.TrimSpace(request.Body) != "" {
+		if err := json.Unmarshal([]byte(request.Body), &parsedRequestBody); err != nil {
+			message := "Error: Unable to parse body: " + fmt.Sprint(err)
+			apiResponse = events.APIGatewayV2HTTPResponse{
+				Body: gateway.CreateErrorMessage(message, 400), StatusCode: 400}
+			return &apiResponse, nil
+		}
+	}
+
+	ctx := context.Background()
+
+	req, err := s.GetSavedQueryRequest(ctx, int(claims.DatasetClaim.IntId), int(claims.OrgClaim.IntId),
+		request.PathParameters["id"], parsedRequestBody)
+	if err != nil {
+		return savedQueryErrorResponse(err), nil
+	}
+
+	return queryGraphResponse(s, request, claims, req)
+}
+
+// managesSavedQueries returns whether the user can update and delete saved queries that other users created, which
+// dataset managers can.
+func managesSavedQueries(claims *authorizer.Claims) bool {
+	return claims.DatasetClaim.Role.Implies(role.Manager)
+}
+
+// savedQueryErrorResponse returns the API response for errors from saving and running queries.
+func savedQueryErrorResponse(err error) *events.APIGatewayV2HTTPResponse {
+	var apiResponse events.APIGatewayV2HTTPResponse
+
+	switch err.(type) {
+	case *models.UnknownSavedQueryError:
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage(err.Error(), 404), StatusCode: 404}
+	case *models.EmptyError, *models.NameTooLongError:
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage(err.Error(), 400), StatusCode: 400}
+	case *models.SavedQueryCreatorError:
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage(err.Error(), 403), StatusCode: 403}
+	case *models.SavedQueryNameCountError:
+		apiResponse = events.APIGatewayV2HTTPResponse{
+			Body: gateway.CreateErrorMessage(err.Error(), 409), StatusCode: 409}
+	default:
+		// Saved queries are validated like posted queries
+		return queryErrorResponse(err)
+	}
+
+	return &apiResponse
+}
@@ -80,6 +80,30 @@ data "aws_iam_policy_document" "model_service_iam_policy_document" {
 
     resources = ["arn:aws:ssm:${data.aws_region.current_region.name}:${data.aws_caller_identity.current.account_id}:parameter/${var.environment_name}/${var.service_name}/*"]
   }
+
+  statement {
+    sid    = "S3ImportPermissions"
+    effect = "Allow"
+
+    actions = [
+      "s3:GetObject",
+    ]
+
+    resources = ["arn:aws:s3:::${var.import_bucket}/*"]
+  }
+
+  statement {
+    sid    = "S3ExportPermissions"
+    effect = "Allow"
+
+    actions = [
+      "s3:GetObject",
+      "s3:PutObject",
+      "s3:AbortMultipartUpload",
+    ]
+
+    resources = ["arn:aws:s3:::${var.export_bucket}/exports/*"]
+  }
 }
 
 
@@ -24,6 +24,10 @@ resource "aws_lambda_function" "service_lambda" {
       REGION = var.aws_region,
       RDS_PROXY_ENDPOINT = data.terraform_remote_state.pennsieve_postgres.outputs.rds_proxy_endpoint
       LOG_LEVEL = "info"
+      IMPORT_BUCKET = var.import_bucket
+      EXPORT_BUCKET = var.export_bucket
+      MAX_RECORD_LINKS = var.max_record_links
+      EXPLAIN_QUERY_ROLE = var.explain_query_role
     }
   }
 }
\ No newline at end of file
@@ -18,6 +18,18 @@ variable "neo4j_bolt_user" {
 
 variable "image_tag" {}
 
+variable "import_bucket" {}
+
+variable "export_bucket" {}
+
+variable "max_record_links" {
+  default = "10000"
+}
+
+variable "explain_query_role" {
+  default = "manager"
+}
+
 variable "lambda_bucket" {
   default = "pennsieve-cc-lambda-functions-use1"
 }